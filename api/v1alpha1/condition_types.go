@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of a Condition
+type ConditionType string
+
+const (
+	// ConditionPlunderReachable is true when the Plunder server answers with the credentials it has been given
+	ConditionPlunderReachable = ConditionType("PlunderReachable")
+
+	// ConditionHostClaimed is true when a PlunderHost has been claimed for a machine
+	ConditionHostClaimed = ConditionType("HostClaimed")
+
+	// ConditionOSProvisioned is true when the Operating System has been installed and the host is reachable
+	ConditionOSProvisioned = ConditionType("OSProvisioned")
+
+	// ConditionKubernetesInstalled is true when Kubernetes has been installed and the machine has joined the cluster
+	ConditionKubernetesInstalled = ConditionType("KubernetesInstalled")
+
+	// ConditionDeprovisioned is true when the host of a deleted machine has been removed from the Plunder server
+	ConditionDeprovisioned = ConditionType("Deprovisioned")
+
+	// ConditionEndpointReachable is true when the control plane endpoint of a cluster answers, it is checked after
+	// the cluster is ready so an endpoint that stops answering is reported
+	ConditionEndpointReachable = ConditionType("EndpointReachable")
+)
+
+// Condition describes one aspect of the state of a resource
+type Condition struct {
+	// Type of the condition
+	Type ConditionType `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is when the condition last changed status
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a CamelCase reason for the last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the last transition
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// SetCondition - adds or updates a condition in the list, the transition time is only changed when the status of
+// the condition changes
+func SetCondition(conditions *[]Condition, t ConditionType, status corev1.ConditionStatus, reason, message string) {
+	for i := range *conditions {
+		c := &(*conditions)[i]
+		if c.Type != t {
+			continue
+		}
+		if c.Status != status {
+			c.LastTransitionTime = metav1.Now()
+		}
+		c.Status = status
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	*conditions = append(*conditions, Condition{
+		Type:               t,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// FindCondition - returns the condition of a type, nil is returned if it isn't in the list
+func FindCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
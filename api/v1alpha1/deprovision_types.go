@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeprovisionMode describes how the disks of a host are cleaned when its machine is deleted
+type DeprovisionMode string
+
+const (
+	// DeprovisionModeNone leaves the disks and the Operating System as they are, only the deployment is removed
+	// from the Plunder server
+	DeprovisionModeNone = DeprovisionMode("None")
+
+	// DeprovisionModeQuick removes the partition tables and filesystem signatures and zeroes the start of every
+	// disk, which is enough for the host to PXE boot again. This is the default.
+	DeprovisionModeQuick = DeprovisionMode("Quick")
+
+	// DeprovisionModeFull zeroes the whole of every disk, this can take hours on large disks
+	DeprovisionModeFull = DeprovisionMode("Full")
+
+	// DeprovisionModeSecureErase erases every disk with the ATA security erase (hdparm --security-erase), disks
+	// that aren't ATA need to support a secure discard (blkdiscard -s). A disk that supports neither (or whose
+	// ATA security has been frozen by the firmware) fails the deprovisioning rather than being partially erased.
+	// NVMe disks generally don't support a secure discard, so need a Custom policy (such as nvme format -s1).
+	DeprovisionModeSecureErase = DeprovisionMode("SecureErase")
+
+	// DeprovisionModeCustom runs the actions of the policy
+	DeprovisionModeCustom = DeprovisionMode("Custom")
+)
+
+// DeprovisionPolicy is how a host is cleaned when its machine is deleted, the host is rebooted afterwards so
+// that it PXE boots and can be provisioned again
+type DeprovisionPolicy struct {
+	// Mode is how the disks are cleaned, it defaults to Quick
+	// +kubebuilder:validation:Enum=None;Quick;Full;SecureErase;Custom
+	// +optional
+	Mode DeprovisionMode `json:"mode,omitempty"`
+
+	// Disks are the devices that are cleaned (such as /dev/sda or /dev/nvme0n1), every disk found on the host
+	// is cleaned if none are set
+	// +optional
+	Disks []string `json:"disks,omitempty"`
+
+	// Actions are the commands ran, in order, when the mode is Custom
+	// +optional
+	Actions []DeprovisionAction `json:"actions,omitempty"`
+
+	// SkipReboot leaves the host running once it has been cleaned
+	// +optional
+	SkipReboot bool `json:"skipReboot,omitempty"`
+}
+
+// DeprovisionAction is a command that is ran on the host as root by parlay
+type DeprovisionAction struct {
+	// Name is the name of the action, it is shown in the parlay logs
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Command is the command that is ran
+	// +kubebuilder:validation:MinLength=1
+	Command string `json:"command"`
+
+	// IgnoreFailure carries on with the next action if this one fails
+	// +optional
+	IgnoreFailure bool `json:"ignoreFailure,omitempty"`
+
+	// TimeoutSeconds is how long the command can run for, there is no limit if it isn't set
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// DeprovisionStatus is the progress of cleaning the host of a deleted machine
+type DeprovisionStatus struct {
+	// Mode is the mode the host is being cleaned with
+	Mode DeprovisionMode `json:"mode"`
+
+	// Host is the address of the host being cleaned
+	Host string `json:"host"`
+
+	// DrainStarted is when the node of the machine was cordoned and the draining started
+	// +optional
+	DrainStarted *metav1.Time `json:"drainStarted,omitempty"`
+
+	// NodeRemoved denotes that the node has been drained (or the drain has timed out) and removed from the
+	// workload cluster
+	// +optional
+	NodeRemoved bool `json:"nodeRemoved,omitempty"`
+
+	// Submitted denotes that the Plunder server has accepted the actions that clean the host
+	// +optional
+	Submitted bool `json:"submitted,omitempty"`
+
+	// Started is when the actions were submitted
+	// +optional
+	Started *metav1.Time `json:"started,omitempty"`
+
+	// Completed is when the host was cleaned and its deployment removed
+	// +optional
+	Completed *metav1.Time `json:"completed,omitempty"`
+
+	// Failures is how many attempts to remove the host have failed, a failed attempt is retried with a backoff
+	// +optional
+	Failures int32 `json:"failures,omitempty"`
+
+	// LastFailure is when the last attempt to remove the host failed
+	// +optional
+	LastFailure *metav1.Time `json:"lastFailure,omitempty"`
+
+	// LastError describes why the last attempt to remove the host failed
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// FailedAction is the name of the action that failed
+	// +optional
+	FailedAction string `json:"failedAction,omitempty"`
+
+	// FailedActionOutput is the error and output of the action that failed
+	// +optional
+	FailedActionOutput string `json:"failedActionOutput,omitempty"`
+}
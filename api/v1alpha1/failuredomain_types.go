@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FailureDomainServerAttribute is the attribute of a reported failure domain that names its PlunderServer
+const FailureDomainServerAttribute = "plunderServer"
+
+// FailureDomainSpec is a set of hosts that can fail together, such as a rack, row or site
+type FailureDomainSpec struct {
+	// Name is the name of the failure domain, machines request a failure domain by name
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// ControlPlane denotes that control plane machines can be placed in the failure domain, control plane
+	// machines that don't request a failure domain are spread across these
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+
+	// HostSelector selects the PlunderHosts that are in the failure domain, every host of the Plunder server
+	// is in it if this isn't set
+	// +optional
+	HostSelector *metav1.LabelSelector `json:"hostSelector,omitempty"`
+
+	// PlunderServerRef is the PlunderServer the hosts of the failure domain are provisioned through, it
+	// defaults to the server of the cluster
+	// +optional
+	PlunderServerRef *corev1.LocalObjectReference `json:"plunderServerRef,omitempty"`
+}
+
+// FailureDomain is a failure domain as reported to Cluster API
+type FailureDomain struct {
+	// ControlPlane denotes that control plane machines can be placed in the failure domain
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+
+	// Attributes are extra information about the failure domain, such as its PlunderServer
+	// +optional
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// FailureDomains is the failure domains of a cluster, keyed by name
+type FailureDomains map[string]FailureDomain
+
+// FindFailureDomain - returns the failure domain of the cluster with the name, nil is returned if there isn't one
+func (s *PlunderClusterSpec) FindFailureDomain(name string) *FailureDomainSpec {
+	for i := range s.FailureDomains {
+		if s.FailureDomains[i].Name == name {
+			return &s.FailureDomains[i]
+		}
+	}
+	return nil
+}
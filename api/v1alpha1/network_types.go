@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// NetworkConfig is the network configuration of a host, any field that is left blank on a PlunderMachine is
+// taken from the PlunderCluster (and then the PlunderIPPool the address came from)
+type NetworkConfig struct {
+	// Interface is the network interface the host is provisioned through e.g. eno1
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// Gateway is the default gateway
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// PrefixLength is the size of the subnet e.g. 24
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	// +optional
+	PrefixLength *int32 `json:"prefixLength,omitempty"`
+
+	// Nameservers are the addresses of the DNS servers
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// SearchDomains are the DNS search domains
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty"`
+
+	// VLANID is the VLAN that the address is configured on, the VLAN is created on the bond (if there is one)
+	// or the Interface
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	VLANID *int32 `json:"vlanID,omitempty"`
+
+	// Bond will bond interfaces together once the Operating System has been installed
+	// +optional
+	Bond *BondConfig `json:"bond,omitempty"`
+}
+
+// BondConfig is the configuration of a bonded interface
+type BondConfig struct {
+	// Interfaces are the interfaces that are members of the bond
+	// +kubebuilder:validation:MinItems=1
+	Interfaces []string `json:"interfaces"`
+
+	// Mode is the bonding mode
+	// +kubebuilder:validation:Enum=balance-rr;active-backup;balance-xor;broadcast;802.3ad;balance-tlb;balance-alb
+	// +optional
+	Mode string `json:"mode,omitempty"`
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
@@ -37,8 +39,80 @@ type PlunderClusterSpec struct {
 	// StaticMAC denotes that the machine is ready
 	StaticMAC string `json:"staticMAC,omitempty"`
 
-	// StaticIp denotes that the machine is ready
+	// StaticIP is a stable address for the control plane (such as a load balancer), it is used as the
+	// ControlPlaneEndpoint (on port 6443) when that isn't set.
 	StaticIP string `json:"staticIP,omitempty"`
+
+	// ControlPlaneEndpoint is the stable endpoint that is used to reach the control plane. If neither it or
+	// StaticIP is set, the address of the first control plane is used.
+	// +optional
+	ControlPlaneEndpoint *ControlPlaneEndpoint `json:"controlPlaneEndpoint,omitempty"`
+
+	// PlunderServerRef is the PlunderServer that the cluster is provisioned through, if it isn't set then the
+	// plunderclient.yaml of the controller is used
+	// +optional
+	PlunderServerRef *corev1.LocalObjectReference `json:"plunderServerRef,omitempty"`
+
+	// IPPoolRef is the PlunderIPPool that machines in the cluster are given addresses from, when they don't
+	// have an address or pool of their own
+	// +optional
+	IPPoolRef *corev1.LocalObjectReference `json:"ipPoolRef,omitempty"`
+
+	// Network is the default network configuration for machines in the cluster
+	// +optional
+	Network *NetworkConfig `json:"network,omitempty"`
+
+	// FailureDomains are the racks, rows or sites that the machines of the cluster can be placed in
+	// +optional
+	FailureDomains []FailureDomainSpec `json:"failureDomains,omitempty"`
+
+	// Deprovision is how the hosts of deleted machines are cleaned, machines can set their own policy
+	// +optional
+	Deprovision *DeprovisionPolicy `json:"deprovision,omitempty"`
+}
+
+// EndpointType describes how the control plane endpoint is provided
+type EndpointType string
+
+const (
+	// EndpointTypeStatic is an endpoint that is managed outside of the cluster, such as a load balancer
+	EndpointTypeStatic = EndpointType("Static")
+
+	// EndpointTypeKubeVIP is a virtual IP that is advertised by kube-vip running on the control plane machines
+	EndpointTypeKubeVIP = EndpointType("KubeVIP")
+
+	// KubeVIPImageDefault is the kube-vip image used when one isn't set
+	KubeVIPImageDefault = "plndr/kube-vip:0.3.1"
+
+	// APIServerPortDefault is the port the API server is reached on when one isn't set
+	APIServerPortDefault = 6443
+)
+
+// ControlPlaneEndpoint is the endpoint used to reach the control plane of a cluster
+type ControlPlaneEndpoint struct {
+	// Host is the address (or hostname) of the endpoint, for KubeVIP this is the virtual IP
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// Port is the port of the endpoint, it defaults to 6443
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Type is how the endpoint is provided, it defaults to Static
+	// +kubebuilder:validation:Enum=Static;KubeVIP
+	// +optional
+	Type EndpointType `json:"type,omitempty"`
+
+	// Interface is the network interface that kube-vip advertises the virtual IP on, it defaults to the
+	// interface from the network configuration of the machine
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	// KubeVIPImage is the kube-vip image that is ran on the control plane machines
+	// +optional
+	KubeVIPImage string `json:"kubeVIPImage,omitempty"`
 }
 
 // PlunderClusterStatus defines the observed state of PlunderCluster
@@ -49,6 +123,31 @@ type PlunderClusterStatus struct {
 	// APIEndpoints represents the endpoints to communicate with the control plane.
 	// +optional
 	APIEndpoints []APIEndpoint `json:"apiEndpoints,omitempty"`
+
+	// FailureDomains are the failure domains that machines can be placed in
+	// +optional
+	FailureDomains FailureDomains `json:"failureDomains,omitempty"`
+
+	// Conditions are the current state of the cluster
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// FailureReason is set when the cluster can't be reconciled until its spec is changed
+	// +optional
+	FailureReason *capierrors.ClusterStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage is a description of why the cluster can't be reconciled
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// ErrorReason is the FailureReason in the form read by the Cluster API cluster controller, so that the
+	// Cluster is marked as failed
+	// +optional
+	ErrorReason *capierrors.ClusterStatusError `json:"errorReason,omitempty"`
+
+	// ErrorMessage is the FailureMessage in the form read by the Cluster API cluster controller
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
 }
 
 // APIEndpoint represents a reachable Kubernetes API endpoint.
@@ -61,6 +160,7 @@ type APIEndpoint struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // PlunderCluster is the Schema for the plunderclusters API
 type PlunderCluster struct {
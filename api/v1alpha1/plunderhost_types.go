@@ -0,0 +1,178 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// HostDiscoveredLabel is added to PlunderHosts that were created from the Plunder DHCP server
+	HostDiscoveredLabel = "plunderhost.infrastructure.cluster.x-k8s.io/discovered"
+
+	// HostServerLabel is the name of the PlunderServer that a host is provisioned through, hosts without it
+	// belong to the default server
+	HostServerLabel = "plunderhost.infrastructure.cluster.x-k8s.io/server"
+)
+
+// HostState describes what a PlunderHost is currently being used for
+type HostState string
+
+const (
+	// HostStateAvailable means the host is free to be claimed by a PlunderMachine
+	HostStateAvailable = HostState("Available")
+
+	// HostStateClaimed means a PlunderMachine has claimed the host but not started provisioning it
+	HostStateClaimed = HostState("Claimed")
+
+	// HostStateProvisioning means the host is being provisioned for its PlunderMachine
+	HostStateProvisioning = HostState("Provisioning")
+
+	// HostStateProvisioned means the host has been provisioned and is in use by its PlunderMachine
+	HostStateProvisioned = HostState("Provisioned")
+
+	// HostStateDeprovisioning means the host is being wiped after its PlunderMachine has been removed, once the
+	// wipe has completed it stays Deprovisioning until the host is seen PXE booting again
+	HostStateDeprovisioning = HostState("Deprovisioning")
+
+	// HostStateOrphaned means the PlunderMachine of the host was force removed before the host was cleaned, the
+	// host won't be claimed again until its state is set back to Available
+	HostStateOrphaned = HostState("Orphaned")
+)
+
+// PlunderHostSpec defines the desired state of PlunderHost
+type PlunderHostSpec struct {
+	// MACAddress is the physical address of the interface the host boots from
+	MACAddress string `json:"macaddress"`
+
+	// BMC is the details of the baseboard management controller for the host
+	// +optional
+	BMC *BMCDetails `json:"bmc,omitempty"`
+
+	// Hardware is the hardware that the host has
+	// +optional
+	Hardware *HardwareDetails `json:"hardware,omitempty"`
+
+	// ConsumerRef is the PlunderMachine that has claimed this host
+	// +optional
+	ConsumerRef *corev1.ObjectReference `json:"consumerRef,omitempty"`
+}
+
+// BMCDetails contains the details needed to connect to a baseboard management controller, a host with a BMC is
+// powered on (and PXE booted) when it is provisioned and powered off once it has been deprovisioned
+type BMCDetails struct {
+	// Address is the address of the BMC, the scheme is the protocol used to talk to it: ipmi://host[:port],
+	// redfish://host[:port][/redfish/v1/Systems/<id>] or redfish+http://host[:port][/redfish/v1/Systems/<id>].
+	// A Redfish address without a system uses the first system of the BMC. IPMI needs ipmitool, which isn't in
+	// the controller image.
+	Address string `json:"address"`
+
+	// CredentialsName is the name of a Secret, in the same namespace, containing the username and password
+	// +optional
+	CredentialsName string `json:"credentialsName,omitempty"`
+
+	// DisableCertificateVerification skips verifying the certificate of a Redfish BMC, which are often self signed
+	// +optional
+	DisableCertificateVerification bool `json:"disableCertificateVerification,omitempty"`
+}
+
+// HardwareDetails describes the hardware that is installed in a host
+type HardwareDetails struct {
+	// CPUCores is the number of CPU cores in the host
+	// +optional
+	CPUCores int32 `json:"cpuCores,omitempty"`
+
+	// MemoryMiB is the amount of memory in the host in MiB
+	// +optional
+	MemoryMiB int64 `json:"memoryMiB,omitempty"`
+
+	// Disks are the storage devices in the host
+	// +optional
+	Disks []Disk `json:"disks,omitempty"`
+
+	// NICs are the network interfaces in the host
+	// +optional
+	NICs []NIC `json:"nics,omitempty"`
+}
+
+// Disk describes a storage device
+type Disk struct {
+	// Name is the name of the device e.g. sda
+	Name string `json:"name"`
+
+	// SizeGiB is the size of the device in GiB
+	SizeGiB int64 `json:"sizeGiB"`
+}
+
+// NIC describes a network interface
+type NIC struct {
+	// Name is the name of the interface e.g. eth0
+	Name string `json:"name"`
+
+	// MACAddress is the physical address of the interface
+	// +optional
+	MACAddress string `json:"macaddress,omitempty"`
+}
+
+// PlunderHostStatus defines the observed state of PlunderHost
+type PlunderHostStatus struct {
+	// State is what the host is currently being used for
+	// +optional
+	State HostState `json:"state,omitempty"`
+
+	// LastSeen is the last time the Plunder server saw the host looking for a DHCP lease
+	// +optional
+	LastSeen *metav1.Time `json:"lastSeen,omitempty"`
+
+	// LastUsed is when the host was last released by a PlunderMachine
+	// +optional
+	LastUsed *metav1.Time `json:"lastUsed,omitempty"`
+
+	// RecycleCount is how many times the host has been cleaned and made available again after being used
+	// +optional
+	RecycleCount int32 `json:"recycleCount,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="MAC",type="string",JSONPath=".spec.macaddress",description="Physical address of the host"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="What the host is being used for"
+// +kubebuilder:printcolumn:name="Consumer",type="string",JSONPath=".spec.consumerRef.name",description="PlunderMachine using the host"
+// +kubebuilder:printcolumn:name="Recycled",type="integer",JSONPath=".status.recycleCount",description="Times the host has been reused"
+
+// PlunderHost is the Schema for the plunderhosts API, the status is written with the spec (there is no status
+// subresource) so that a claim can be made atomically using the resourceVersion
+type PlunderHost struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlunderHostSpec   `json:"spec,omitempty"`
+	Status PlunderHostStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PlunderHostList contains a list of PlunderHost
+type PlunderHostList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PlunderHost `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlunderHost{}, &PlunderHostList{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PlunderIPPoolSpec defines the desired state of PlunderIPPool
+type PlunderIPPoolSpec struct {
+	// CIDR is the network that addresses are allocated from e.g. 192.168.1.0/24
+	// +kubebuilder:validation:MinLength=1
+	CIDR string `json:"cidr"`
+
+	// Ranges limits allocation to these ranges within the CIDR, if none are set then every address in the CIDR
+	// can be allocated
+	// +optional
+	Ranges []IPRange `json:"ranges,omitempty"`
+
+	// Gateway is the default gateway for the network, it is never allocated
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// DNS is the list of nameservers for the network
+	// +optional
+	DNS []string `json:"dns,omitempty"`
+
+	// Exclusions are addresses (or CIDRs) that will never be allocated
+	// +optional
+	Exclusions []string `json:"exclusions,omitempty"`
+}
+
+// IPRange is an inclusive range of addresses
+type IPRange struct {
+	// Start is the first address in the range
+	Start string `json:"start"`
+
+	// End is the last address in the range
+	End string `json:"end"`
+}
+
+// PlunderIPPoolStatus defines the observed state of PlunderIPPool
+type PlunderIPPoolStatus struct {
+	// Allocations are the addresses that are in use
+	// +optional
+	Allocations []IPAllocation `json:"allocations,omitempty"`
+}
+
+// IPAllocation records an address that has been allocated to a PlunderMachine
+type IPAllocation struct {
+	// Address is the allocated address
+	Address string `json:"address"`
+
+	// MachineName is the name of the PlunderMachine using the address
+	MachineName string `json:"machineName"`
+
+	// MachineUID is the UID of the PlunderMachine using the address
+	MachineUID types.UID `json:"machineUID"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="CIDR",type="string",JSONPath=".spec.cidr",description="Network addresses are allocated from"
+// +kubebuilder:printcolumn:name="Gateway",type="string",JSONPath=".spec.gateway",description="Default gateway for the network"
+
+// PlunderIPPool is the Schema for the plunderippools API, like PlunderHost the status is written with the spec
+// so that allocations are made atomically using the resourceVersion
+type PlunderIPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlunderIPPoolSpec   `json:"spec,omitempty"`
+	Status PlunderIPPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PlunderIPPoolList contains a list of PlunderIPPool
+type PlunderIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PlunderIPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlunderIPPool{}, &PlunderIPPoolList{})
+}
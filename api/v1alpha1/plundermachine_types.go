@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
@@ -25,6 +27,14 @@ const (
 	// removing it from the apiserver.
 	MachineFinalizer = "plundernmachine.infrastructure.cluster.x-k8s.io"
 
+	// SkipDrainAnnotation on a PlunderMachine (or its Machine) stops the node being drained when the machine is
+	// deleted, the node is still cordoned and removed
+	SkipDrainAnnotation = "plundermachine.infrastructure.cluster.x-k8s.io/skip-drain"
+
+	// ForceDeleteAnnotation on a PlunderMachine (or its Machine) lets it be removed without its host being
+	// cleaned, the host is recorded as orphaned so that it can be dealt with by hand
+	ForceDeleteAnnotation = "plundermachine.infrastructure.cluster.x-k8s.io/force-delete"
+
 	// DockerVersionDefault is the version of Docker that the provider will default to
 	DockerVersionDefault = "18.06.1~ce~3-0~ubuntu"
 
@@ -35,6 +45,47 @@ const (
 	DeploymentDefault = "preseed"
 )
 
+// MachinePhase describes the stage of provisioning that a PlunderMachine has reached
+type MachinePhase string
+
+const (
+	// MachinePhasePending is the initial phase, no hardware has been selected yet
+	MachinePhasePending = MachinePhase("")
+
+	// MachinePhaseHardwareClaimed means a physical host has been selected for the machine
+	MachinePhaseHardwareClaimed = MachinePhase("HardwareClaimed")
+
+	// MachinePhaseOSDeploying means Plunder is installing the Operating System on the host
+	MachinePhaseOSDeploying = MachinePhase("OSDeploying")
+
+	// MachinePhaseOSReady means the Operating System is installed and the host is reachable
+	MachinePhaseOSReady = MachinePhase("OSReady")
+
+	// MachinePhaseKubernetesInstalling means the Kubernetes deployment is being run against the host
+	MachinePhaseKubernetesInstalling = MachinePhase("KubernetesInstalling")
+
+	// MachinePhaseReady means the machine is provisioned and part of the cluster
+	MachinePhaseReady = MachinePhase("Ready")
+
+	// MachinePhaseFailed means provisioning has failed and needs intervention
+	MachinePhaseFailed = MachinePhase("Failed")
+
+	// MachinePhaseDeprovisioning means the machine has been deleted and its host is being cleaned
+	MachinePhaseDeprovisioning = MachinePhase("Deprovisioning")
+)
+
+// BootstrapMode describes how Kubernetes is installed on a machine
+type BootstrapMode string
+
+const (
+	// BootstrapModeParlay installs Kubernetes with the kubeadm actions built by the provider
+	BootstrapModeParlay = BootstrapMode("Parlay")
+
+	// BootstrapModeCloudInit installs Kubernetes by running the cloud-init bootstrap data of the Machine, which is
+	// generated by the Cluster API bootstrap provider
+	BootstrapModeCloudInit = BootstrapMode("CloudInit")
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -44,16 +95,32 @@ type PlunderMachineSpec struct {
 	// +optional
 	ProviderID *string `json:"providerID,omitempty"`
 
-	// ControlPlaneMac will be a pool of mac addresses for control plane nodes
+	// ControlPlaneMacPool is a pool of mac addresses for control plane nodes, a control plane machine with a pool
+	// will only use hosts in it and other machines won't use any host that is in a pool
 	// +optional
 	ControlPlaneMacPool []string `json:"controlPlaneMacPool,omitempty"`
 
 	// MACHINE Definition
 
-	// IPAddress is the address to be used IF IPAM isn't enabled (SPOILER IT ISN'T as i've not written it yet)
+	// IPAddress is the address to be used, if it is left blank an address will be allocated from the
+	// PlunderIPPool of the machine (or cluster)
 	// +optional
 	IPAddress *string `json:"ipaddress,omitempty"`
 
+	// IPPoolRef is the PlunderIPPool that the address is allocated from, it overrides the pool of the cluster
+	// +optional
+	IPPoolRef *corev1.LocalObjectReference `json:"ipPoolRef,omitempty"`
+
+	// Network is the network configuration of the machine, it overrides the configuration of the cluster
+	// +optional
+	Network *NetworkConfig `json:"network,omitempty"`
+
+	// BootstrapMode is how Kubernetes is installed once the Operating System has been provisioned, it defaults
+	// to Parlay
+	// +kubebuilder:validation:Enum=Parlay;CloudInit
+	// +optional
+	BootstrapMode BootstrapMode `json:"bootstrapMode,omitempty"`
+
 	// MACAddress is the physical network address of the if we don't auto detect
 	// +optional
 
@@ -65,6 +132,77 @@ type PlunderMachineSpec struct {
 	// DeploymentType defines what will be deployed on the new machine
 	// +optional
 	DeploymentType *string `json:"deploymentType,omitempty"`
+
+	// FailureDomain is the failure domain of the PlunderCluster that the machine is placed in
+	// +optional
+	FailureDomain *string `json:"failureDomain,omitempty"`
+
+	// HostSelector restricts the PlunderHosts that can be claimed to those with matching labels
+	// +optional
+	HostSelector *metav1.LabelSelector `json:"hostSelector,omitempty"`
+
+	// HardwareRequirements is the minimum hardware a PlunderHost needs to be claimed
+	// +optional
+	HardwareRequirements *HardwareRequirements `json:"hardwareRequirements,omitempty"`
+
+	// Timeouts are how long each phase of provisioning can take, they override the defaults of the controller
+	// +optional
+	Timeouts *ProvisioningTimeouts `json:"timeouts,omitempty"`
+
+	// KubernetesInstallRetries is how many times the Kubernetes installation is submitted again after it fails,
+	// the host is reset with kubeadm before each retry. The default is to not retry.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KubernetesInstallRetries *int32 `json:"kubernetesInstallRetries,omitempty"`
+
+	// Deprovision is how the host is cleaned when the machine is deleted, it overrides the policy of the cluster
+	// +optional
+	Deprovision *DeprovisionPolicy `json:"deprovision,omitempty"`
+}
+
+// ProvisioningTimeouts are how long each phase of provisioning can take before the machine fails, a timeout of
+// zero means there is no limit
+type ProvisioningTimeouts struct {
+	// HardwareClaim is how long the machine can wait for a free PlunderHost
+	// +optional
+	HardwareClaim *metav1.Duration `json:"hardwareClaim,omitempty"`
+
+	// OSDeploy is how long the Operating System can take to be installed
+	// +optional
+	OSDeploy *metav1.Duration `json:"osDeploy,omitempty"`
+
+	// KubernetesInstall is how long the installation of Kubernetes can take
+	// +optional
+	KubernetesInstall *metav1.Duration `json:"kubernetesInstall,omitempty"`
+
+	// Drain is how long the node can take to be drained when the machine is deleted, once it has passed the
+	// node is removed and the host deprovisioned without waiting for the remaining pods
+	// +optional
+	Drain *metav1.Duration `json:"drain,omitempty"`
+}
+
+// HardwareRequirements is the minimum hardware that a machine needs, a requirement that is left as zero
+// isn't checked
+type HardwareRequirements struct {
+	// MinCPUCores is the fewest CPU cores the host can have
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinCPUCores int32 `json:"minCPUCores,omitempty"`
+
+	// MinMemoryMiB is the least memory the host can have in MiB
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinMemoryMiB int64 `json:"minMemoryMiB,omitempty"`
+
+	// MinDiskSizeGiB is the size in GiB that at least one of the host disks must be
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinDiskSizeGiB int64 `json:"minDiskSizeGiB,omitempty"`
+
+	// MinNICs is the fewest network interfaces the host can have
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinNICs int32 `json:"minNICs,omitempty"`
 }
 
 // PlunderMachineStatus defines the observed state of PlunderMachine
@@ -80,9 +218,157 @@ type PlunderMachineStatus struct {
 
 	// MachineName is the generated name for the provisioned name
 	MachineName string `json:"machineName"`
+
+	// HostRef is the PlunderHost that has been claimed for this machine, the host is in the namespace of the
+	// machine if the reference doesn't have one
+	// +optional
+	HostRef *corev1.ObjectReference `json:"hostRef,omitempty"`
+
+	// FailureDomain is the failure domain that the machine has been placed in
+	// +optional
+	FailureDomain string `json:"failureDomain,omitempty"`
+
+	// PlunderServer is the name of the PlunderServer that the machine is provisioned through, an empty name is
+	// the default server. It is recorded when hardware is claimed so the machine stays with its server.
+	// +optional
+	PlunderServer *string `json:"plunderServer,omitempty"`
+
+	// IPClaim is the address that has been allocated to this machine from a PlunderIPPool
+	// +optional
+	IPClaim *IPClaim `json:"ipClaim,omitempty"`
+
+	// Phase is the current stage of provisioning for this machine
+	// +optional
+	Phase MachinePhase `json:"phase,omitempty"`
+
+	// LastPhaseTransition is the time that the machine entered its current phase
+	// +optional
+	LastPhaseTransition *metav1.Time `json:"lastPhaseTransition,omitempty"`
+
+	// Deployment is the Operating System deployment that has been created on the Plunder server
+	// +optional
+	Deployment *PlunderDeployment `json:"deployment,omitempty"`
+
+	// ParlayJob is the most recent set of parlay actions submitted to the Plunder server
+	// +optional
+	ParlayJob *ParlayJob `json:"parlayJob,omitempty"`
+
+	// ParlayLogs is where the logs of the parlay actions ran in each phase of provisioning are kept
+	// +optional
+	ParlayLogs *ParlayLogsRef `json:"parlayLogs,omitempty"`
+
+	// Deprovision is the progress of cleaning the host once the machine has been deleted
+	// +optional
+	Deprovision *DeprovisionStatus `json:"deprovision,omitempty"`
+
+	// FailureReason is set when provisioning has failed in a way that needs the machine to be removed
+	// +optional
+	FailureReason *capierrors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage is a description of why provisioning has failed
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// ErrorReason is the FailureReason in the form read by the Cluster API machine controller, so that the
+	// Machine is marked as failed
+	// +optional
+	ErrorReason *capierrors.MachineStatusError `json:"errorReason,omitempty"`
+
+	// ErrorMessage is the FailureMessage in the form read by the Cluster API machine controller
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
+
+	// Conditions are the current state of each step of provisioning (HostClaimed, OSProvisioned,
+	// KubernetesInstalled, Deprovisioned) and of the connection to the Plunder server (PlunderReachable)
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// IPClaim records an address that has been allocated from a PlunderIPPool
+type IPClaim struct {
+	// PoolName is the name of the PlunderIPPool the address was allocated from
+	PoolName string `json:"poolName"`
+
+	// Address is the allocated address
+	Address string `json:"address"`
+}
+
+// PlunderDeployment records the deployment created on the Plunder server for a machine, it is recorded
+// before it is submitted so that an interrupted reconcile can find it again
+type PlunderDeployment struct {
+	// MACAddress is the physical address of the host being deployed
+	MACAddress string `json:"macaddress"`
+
+	// IPAddress is the address the host will be configured with
+	IPAddress string `json:"ipaddress"`
+
+	// Hostname is the name the host will be configured with
+	Hostname string `json:"hostname"`
+
+	// DeploymentType is the type of installation that Plunder will perform
+	DeploymentType string `json:"deploymentType"`
+
+	// Submitted denotes that the Plunder server has accepted the deployment
+	Submitted bool `json:"submitted"`
+
+	// PowerResets is how many times the host has been hard reset through its BMC because the installation was stuck
+	// +optional
+	PowerResets int32 `json:"powerResets,omitempty"`
+
+	// LastPowerReset is when the host was last powered on or reset through its BMC for this deployment
+	// +optional
+	LastPowerReset *metav1.Time `json:"lastPowerReset,omitempty"`
+}
+
+// ParlayJob records a set of parlay actions submitted to the Plunder server, Plunder records the logs
+// for the actions against the address of the host they run on
+type ParlayJob struct {
+	// Name is the name of the parlay deployment
+	Name string `json:"name"`
+
+	// Host is the address of the host that the actions are run on
+	Host string `json:"host"`
+
+	// Submitted denotes that the Plunder server has accepted the actions
+	Submitted bool `json:"submitted"`
+
+	// SubmittedTime is when the actions were submitted
+	// +optional
+	SubmittedTime *metav1.Time `json:"submittedTime,omitempty"`
+
+	// Attempt is how many times the actions have been submitted, it starts at 1 and goes up with each retry
+	// +optional
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// FailedAction is the name of the action that failed in the most recent attempt
+	// +optional
+	FailedAction string `json:"failedAction,omitempty"`
+
+	// FailedActionOutput is the error and output of the action that failed, it is truncated to the last
+	// few thousand characters
+	// +optional
+	FailedActionOutput string `json:"failedActionOutput,omitempty"`
+}
+
+// ParlayLogsRef points to the ConfigMap that holds the parlay logs captured for a machine, each key is the
+// logs of one phase in the form <sequence>-<phase>.json. Only the most recent captures are kept.
+type ParlayLogsRef struct {
+	// ConfigMapName is the name of the ConfigMap, it is in the namespace of the PlunderMachine
+	ConfigMapName string `json:"configMapName"`
+
+	// Latest is the key of the most recent capture
+	// +optional
+	Latest string `json:"latest,omitempty"`
+
+	// LastCaptured is when the logs were last captured
+	// +optional
+	LastCaptured *metav1.Time `json:"lastCaptured,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Provisioning phase of the machine"
+// +kubebuilder:printcolumn:name="MAC",type="string",JSONPath=".status.macaddress",description="Physical address of the host"
 
 // PlunderMachine is the Schema for the plundermachines API
 type PlunderMachine struct {
@@ -0,0 +1,101 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The keys of the Secret that holds the credentials of a Plunder server
+const (
+	// PlunderServerCAKey is the certificate the Plunder server is trusted with (PEM)
+	PlunderServerCAKey = "ca.crt"
+
+	// PlunderServerCertKey is an optional client certificate that is presented to the Plunder server (PEM)
+	PlunderServerCertKey = corev1.TLSCertKey
+
+	// PlunderServerKeyKey is the key of the client certificate (PEM)
+	PlunderServerKeyKey = corev1.TLSPrivateKeyKey
+)
+
+// PlunderServerSpec defines the desired state of PlunderServer
+type PlunderServerSpec struct {
+	// Address is the URL of the Plunder API server e.g. https://plunder.local:60443
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+
+	// CredentialsRef is the Secret with the certificate of the server (ca.crt) and optionally a client
+	// certificate (tls.crt and tls.key)
+	CredentialsRef corev1.SecretReference `json:"credentialsRef"`
+
+	// MaxConcurrentProvisions is how many machines can be provisioned (having their Operating System or
+	// Kubernetes installed) through the server at the same time, there is no limit if it isn't set
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrentProvisions *int32 `json:"maxConcurrentProvisions,omitempty"`
+}
+
+// PlunderServerStatus defines the observed state of PlunderServer
+type PlunderServerStatus struct {
+	// Conditions are the current state of the connection to the server
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// LastChecked is when the connection to the server was last checked
+	// +optional
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+
+	// Machines is how many PlunderMachines have been provisioned through the server
+	// +optional
+	Machines int32 `json:"machines,omitempty"`
+
+	// Provisioning is how many PlunderMachines are having their Operating System or Kubernetes installed
+	// +optional
+	Provisioning int32 `json:"provisioning,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Address",type="string",JSONPath=".spec.address",description="URL of the Plunder API server"
+// +kubebuilder:printcolumn:name="Reachable",type="string",JSONPath=".status.conditions[?(@.type==\"PlunderReachable\")].status",description="The server answers with its credentials"
+// +kubebuilder:printcolumn:name="Machines",type="integer",JSONPath=".status.machines",description="PlunderMachines provisioned through the server"
+// +kubebuilder:printcolumn:name="Provisioning",type="integer",JSONPath=".status.provisioning",description="PlunderMachines being provisioned through the server"
+
+// PlunderServer is the Schema for the plunderservers API, it is a Plunder server that clusters are provisioned
+// through
+type PlunderServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlunderServerSpec   `json:"spec,omitempty"`
+	Status PlunderServerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PlunderServerList contains a list of PlunderServer
+type PlunderServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PlunderServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlunderServer{}, &PlunderServerList{})
+}
@@ -0,0 +1,361 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	k8sfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// statusSubresources are the kinds whose status can only be written through the status subresource, and whose
+// status is left alone when the rest of the object is written
+var statusSubresources = map[string]bool{
+	"PlunderMachine": true,
+	"PlunderCluster": true,
+	"PlunderServer":  true,
+	"Cluster":        true,
+	"Machine":        true,
+}
+
+// apiServer is a client that behaves like an API server in the ways that the controllers rely on, the fake client
+// of controller-runtime stores whatever it is given so on its own it hides mistakes in how objects are written:
+//
+//   - every write changes the resourceVersion, and a write with an older resourceVersion is a conflict
+//   - the status of a kind with a status subresource is only written through Status(), which writes nothing else
+//   - a patch is applied to the stored object, so the fields it removes (such as a finalizer) are removed
+//   - deleting an object with finalizers marks it as being deleted, it is removed once the finalizers have gone
+//
+// The tests don't use envtest, which runs a real API server, as it needs etcd and kube-apiserver binaries and a
+// module (sigs.k8s.io/testing_frameworks) that isn't a dependency of this repository.
+type apiServer struct {
+	client.Client
+	scheme *runtime.Scheme
+
+	mu      sync.Mutex
+	version int
+
+	// races are ran (once) before the next write to an object of a kind, so that a test can have something else
+	// write the object first
+	races map[string]func()
+}
+
+// newAPIServer - returns an API server that already stores the objects
+func newAPIServer(scheme *runtime.Scheme, objs ...runtime.Object) *apiServer {
+	s := &apiServer{Client: k8sfake.NewFakeClientWithScheme(scheme), scheme: scheme, races: map[string]func(){}}
+	for _, obj := range objs {
+		if err := s.store(obj); err != nil {
+			panic(fmt.Errorf("unable to store %T [%v]", obj, err))
+		}
+	}
+	return s
+}
+
+// store - adds an object as it is, other than giving it a resourceVersion (and a UID if it doesn't have one)
+func (s *apiServer) store(obj runtime.Object) error {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.GetUID() == "" {
+		m.SetUID(types.UID(fmt.Sprintf("%s-uid", m.GetName())))
+	}
+	m.SetResourceVersion(s.nextVersion())
+	return s.Client.Create(context.TODO(), obj)
+}
+
+// race - runs write before the next write to an object of the kind
+func (s *apiServer) race(kind string, write func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.races[kind] = write
+}
+
+// runRace - runs the race for the kind of an object, if there is one
+func (s *apiServer) runRace(obj runtime.Object) {
+	gvk, err := apiutil.GVKForObject(obj, s.scheme)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	write := s.races[gvk.Kind]
+	delete(s.races, gvk.Kind)
+	s.mu.Unlock()
+	if write != nil {
+		write()
+	}
+}
+
+func (s *apiServer) nextVersion() string {
+	s.version++
+	return strconv.Itoa(s.version)
+}
+
+// Create - stores a new object, as the API server does the resourceVersion mustn't be set
+func (s *apiServer) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	s.runRace(obj)
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if m.GetResourceVersion() != "" {
+		return apierrors.NewBadRequest("resourceVersion should not be set on objects to be created")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.GetUID() == "" {
+		m.SetUID(types.UID(fmt.Sprintf("%s-uid-%d", m.GetName(), s.version)))
+	}
+	m.SetCreationTimestamp(metav1.Now())
+	m.SetResourceVersion(s.nextVersion())
+	if err := s.Client.Create(ctx, obj, opts...); err != nil {
+		m.SetResourceVersion("")
+		return err
+	}
+	return nil
+}
+
+// Delete - removes an object, or if it has finalizers marks it as being deleted
+func (s *apiServer) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	s.runRace(obj)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.current(ctx, obj)
+	if err != nil {
+		return err
+	}
+	m, err := meta.Accessor(current)
+	if err != nil {
+		return err
+	}
+	if len(m.GetFinalizers()) == 0 {
+		return s.Client.Delete(ctx, current, opts...)
+	}
+	if m.GetDeletionTimestamp() == nil {
+		now := metav1.Now()
+		m.SetDeletionTimestamp(&now)
+		m.SetResourceVersion(s.nextVersion())
+		return s.Client.Update(ctx, current)
+	}
+	return nil
+}
+
+// Update - replaces the object, other than its status if it has a status subresource
+func (s *apiServer) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return s.write(ctx, obj, false, func(current runtime.Object) (runtime.Object, error) {
+		return obj.DeepCopyObject(), nil
+	})
+}
+
+// Patch - applies a merge patch to the object, other than its status if it has a status subresource
+func (s *apiServer) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return s.write(ctx, obj, false, func(current runtime.Object) (runtime.Object, error) {
+		return applyPatch(current, obj, patch)
+	})
+}
+
+// Status - returns the writer for the status subresource
+func (s *apiServer) Status() client.StatusWriter {
+	return apiStatusWriter{s}
+}
+
+// apiStatusWriter writes the status subresource of an object
+type apiStatusWriter struct {
+	s *apiServer
+}
+
+func (w apiStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return w.s.write(ctx, obj, true, func(current runtime.Object) (runtime.Object, error) {
+		return obj.DeepCopyObject(), nil
+	})
+}
+
+func (w apiStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.s.write(ctx, obj, true, func(current runtime.Object) (runtime.Object, error) {
+		return applyPatch(current, obj, patch)
+	})
+}
+
+// current - returns the stored copy of an object
+func (s *apiServer) current(ctx context.Context, obj runtime.Object) (runtime.Object, error) {
+	key, err := client.ObjectKeyFromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	current := newObject(obj)
+	if err := s.Client.Get(ctx, key, current); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// write - replaces the stored object with the one returned by desired, either the status or everything other than
+// the status is written. The written object is copied back into obj, as a real client does with the response.
+func (s *apiServer) write(ctx context.Context, obj runtime.Object, status bool, desired func(current runtime.Object) (runtime.Object, error)) error {
+	s.runRace(obj)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gvk, err := apiutil.GVKForObject(obj, s.scheme)
+	if err != nil {
+		return err
+	}
+	current, err := s.current(ctx, obj)
+	if err != nil {
+		return err
+	}
+	m, _ := meta.Accessor(current)
+	if status && !statusSubresources[gvk.Kind] {
+		return apierrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind + "/status"}, m.GetName())
+	}
+
+	updated, err := desired(current)
+	if err != nil {
+		return apierrors.NewBadRequest(err.Error())
+	}
+	u, _ := meta.Accessor(updated)
+	if u.GetResourceVersion() != "" && u.GetResourceVersion() != m.GetResourceVersion() {
+		return apierrors.NewConflict(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, m.GetName(),
+			fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	switch {
+	case status:
+		// Only the status is written
+		if updated, err = copyStatus(current, updated); err != nil {
+			return err
+		}
+	case statusSubresources[gvk.Kind]:
+		// Everything but the status is written
+		if updated, err = copyStatus(updated, current); err != nil {
+			return err
+		}
+	}
+
+	// The fields the API server manages can't be changed by a write
+	u, _ = meta.Accessor(updated)
+	u.SetUID(m.GetUID())
+	u.SetCreationTimestamp(m.GetCreationTimestamp())
+	u.SetDeletionTimestamp(m.GetDeletionTimestamp())
+	u.SetResourceVersion(s.nextVersion())
+
+	if u.GetDeletionTimestamp() != nil && len(u.GetFinalizers()) == 0 {
+		err = s.Client.Delete(ctx, updated)
+	} else {
+		err = s.Client.Update(ctx, updated)
+	}
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(updated).Elem())
+	return nil
+}
+
+// newObject - returns an empty object of the same type
+func newObject(obj runtime.Object) runtime.Object {
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+}
+
+// copyStatus - returns obj with the status of from
+func copyStatus(obj, from runtime.Object) (runtime.Object, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	f, err := runtime.DefaultUnstructuredConverter.ToUnstructured(from)
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := f["status"]; ok {
+		u["status"] = st
+	} else {
+		delete(u, "status")
+	}
+	out := newObject(obj)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// applyPatch - returns the current object with the patch (generated from obj) applied
+func applyPatch(current, obj runtime.Object, patch client.Patch) (runtime.Object, error) {
+	if patch.Type() != types.MergePatchType {
+		return nil, fmt.Errorf("the patch type %s isn't supported", patch.Type())
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return nil, err
+	}
+	var p interface{}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(b, &target); err != nil {
+		return nil, err
+	}
+	if b, err = json.Marshal(mergePatch(target, p)); err != nil {
+		return nil, err
+	}
+	out := newObject(obj)
+	if err := json.Unmarshal(b, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mergePatch - applies a JSON merge patch (RFC 7386) to a decoded document
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// The reasons for the conditions of a PlunderMachine
+const (
+	reasonClaimed              = "Claimed"
+	reasonNoHostAvailable      = "NoHostAvailable"
+	reasonInvalidMacPool       = "InvalidMacPool"
+	reasonInvalidFailureDomain = "InvalidFailureDomain"
+	reasonInvalidNetwork       = "InvalidNetwork"
+	reasonServerBusy           = "PlunderServerBusy"
+	reasonDeploying            = "Deploying"
+	reasonDeploymentConflict   = "DeploymentConflict"
+	reasonPowerOnFailed        = "PowerOnFailed"
+	reasonProvisioned          = "Provisioned"
+	reasonWaitingForBootstrap  = "WaitingForBootstrapData"
+	reasonWaitingForInit       = "WaitingForControlPlane"
+	reasonInvalidConfiguration = "InvalidConfiguration"
+	reasonInstalling           = "Installing"
+	reasonInstalled            = "Installed"
+	reasonInstallFailed        = "InstallFailed"
+	reasonInstallRetrying      = "InstallRetrying"
+	reasonTimedOut             = "TimedOut"
+	reasonDraining             = "Draining"
+	reasonDeprovisioning       = "Deprovisioning"
+	reasonDeprovisioned        = "Deprovisioned"
+	reasonDeprovisionFailed    = "DeprovisionFailed"
+)
+
+// setMachineCondition - sets a condition of a PlunderMachine, the message is formatted with the args
+func setMachineCondition(plunderMachine *infrav1.PlunderMachine, t infrav1.ConditionType, status corev1.ConditionStatus, reason, format string, args ...interface{}) {
+	infrav1.SetCondition(&plunderMachine.Status.Conditions, t, status, reason, fmt.Sprintf(format, args...))
+}
+
+// phaseCondition - returns the condition that a phase of provisioning is working towards, an empty type is
+// returned for phases that don't have one
+func phaseCondition(phase infrav1.MachinePhase) infrav1.ConditionType {
+	switch phase {
+	case infrav1.MachinePhasePending:
+		return infrav1.ConditionHostClaimed
+	case infrav1.MachinePhaseHardwareClaimed, infrav1.MachinePhaseOSDeploying:
+		return infrav1.ConditionOSProvisioned
+	case infrav1.MachinePhaseOSReady, infrav1.MachinePhaseKubernetesInstalling:
+		return infrav1.ConditionKubernetesInstalled
+	case infrav1.MachinePhaseDeprovisioning:
+		return infrav1.ConditionDeprovisioned
+	}
+	return ""
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/kubeadm"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// clusterSecretType is the type of the Secrets that hold cluster certificates, this matches the bootstrap
+// provider so that a certificate authority can be shared
+const clusterSecretType = corev1.SecretType("cluster.x-k8s.io/secret")
+
+// caSecretName - returns the name of the Secret holding the certificate authority of a cluster
+func caSecretName(cluster string) string {
+	return fmt.Sprintf("%s-ca", cluster)
+}
+
+// joinSecretName - returns the name of the Secret holding the join token and certificate key of a cluster
+func joinSecretName(cluster string) string {
+	return fmt.Sprintf("%s-plunder-join", cluster)
+}
+
+// initLockName - returns the name of the ConfigMap that records which machine initialises the control plane
+func initLockName(cluster string) string {
+	return fmt.Sprintf("%s-plunder-init", cluster)
+}
+
+// clusterOwnerRef - returns an owner reference to a Cluster, so that objects are removed with the cluster
+func clusterOwnerRef(cluster *clusterv1.Cluster) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: clusterv1.GroupVersion.String(),
+		Kind:       "Cluster",
+		Name:       cluster.Name,
+		UID:        cluster.UID,
+	}
+}
+
+// ensureSecret - returns the Secret with the name, if it doesn't exist then it is created with the data
+// returned by generate
+func ensureSecret(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, name string, generate func() (map[string][]byte, error)) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, secret)
+	if err == nil {
+		return secret, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	data, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       cluster.Namespace,
+			Labels:          map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+			OwnerReferences: []metav1.OwnerReference{clusterOwnerRef(cluster)},
+		},
+		Type: clusterSecretType,
+		Data: data,
+	}
+	err = c.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		// Another machine created it first, so use that one
+		err = c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// joinConfig - returns the configuration machines use to join the cluster, the certificate authority, the token the
+// control plane is initialised with and the certificate key are generated the first time they are needed and kept
+// in Secrets owned by the Cluster
+func joinConfig(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, endpoint string) (*plunder.JoinConfig, error) {
+	ca, err := ensureSecret(ctx, c, cluster, caSecretName(cluster.Name), func() (map[string][]byte, error) {
+		cert, key, err := kubeadm.NewCertificateAuthority("kubernetes")
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{corev1.TLSCertKey: cert, corev1.TLSPrivateKeyKey: key}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	join, err := ensureSecret(ctx, c, cluster, joinSecretName(cluster.Name), func() (map[string][]byte, error) {
+		token, err := kubeadm.NewBootstrapToken()
+		if err != nil {
+			return nil, err
+		}
+		key, err := kubeadm.NewCertificateKey()
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"token": []byte(token), "certificateKey": []byte(key)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := kubeadm.CACertHash(ca.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, err
+	}
+
+	return &plunder.JoinConfig{
+		Endpoint:       endpoint,
+		Token:          string(join.Data["token"]),
+		CACert:         ca.Data[corev1.TLSCertKey],
+		CAKey:          ca.Data[corev1.TLSPrivateKeyKey],
+		CACertHash:     hash,
+		CertificateKey: string(join.Data["certificateKey"]),
+	}, nil
+}
+
+// controlPlaneInitMachine - returns the PlunderMachine that initialises the control plane of the cluster. The
+// first control plane machine to ask takes a lock (a ConfigMap, which can only be created once) and becomes the
+// init machine. If the machine holding the lock no longer exists the lock is only removed and taken again while
+// the control plane hasn't been initialised, once it has the machines join through a Ready control plane machine
+// instead so that kubeadm init is never ran a second time.
+func controlPlaneInitMachine(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, plunderMachine *infrav1.PlunderMachine, controlPlane bool) (*infrav1.PlunderMachine, error) {
+	name := types.NamespacedName{Namespace: cluster.Namespace, Name: initLockName(cluster.Name)}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		lock := &corev1.ConfigMap{}
+		err := c.Get(ctx, name, lock)
+		if apierrors.IsNotFound(err) {
+			if !controlPlane {
+				// Workers can't initialise the cluster, they wait for a control plane
+				return nil, nil
+			}
+			lock = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            name.Name,
+					Namespace:       name.Namespace,
+					Labels:          map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+					OwnerReferences: []metav1.OwnerReference{clusterOwnerRef(cluster)},
+				},
+				Data: map[string]string{"machine": plunderMachine.Name, "uid": string(plunderMachine.UID)},
+			}
+			err = c.Create(ctx, lock)
+			if err == nil {
+				return plunderMachine, nil
+			}
+			if !apierrors.IsAlreadyExists(err) {
+				return nil, err
+			}
+			// Another machine took the lock first
+			if err = c.Get(ctx, name, lock); err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		holder := &infrav1.PlunderMachine{}
+		err = c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: lock.Data["machine"]}, holder)
+		if err == nil && string(holder.UID) == lock.Data["uid"] {
+			return holder, nil
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if cluster.Status.ControlPlaneInitialized {
+			return readyControlPlaneMachine(ctx, c, cluster)
+		}
+
+		// The machine that held the lock has gone before the control plane was initialised, so the lock is
+		// released and taken again
+		if err := c.Delete(ctx, lock); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("Unable to take the control plane lock for cluster %s", cluster.Name)
+}
+
+// newJoinToken - gives a joining machine a bootstrap token of its own, it is created on the control plane just
+// before the machine joins and left to expire, so that machines joining at the same time don't share a token
+func newJoinToken(j *plunder.JoinConfig) error {
+	token, err := kubeadm.NewBootstrapToken()
+	if err != nil {
+		return err
+	}
+	j.Token = token
+	return nil
+}
+
+// podNetworkCIDR - returns the first pod network CIDR of the cluster, which kubeadm init is given when the control
+// plane is initialised
+func podNetworkCIDR(cluster *clusterv1.Cluster) (string, error) {
+	n := cluster.Spec.ClusterNetwork
+	if n == nil || n.Pods == nil || len(n.Pods.CIDRBlocks) == 0 || n.Pods.CIDRBlocks[0] == "" {
+		return "", fmt.Errorf("The control plane can't be initialised, cluster %s has no pod network set in spec.clusterNetwork.pods.cidrBlocks", cluster.Name)
+	}
+	return n.Pods.CIDRBlocks[0], nil
+}
+
+// readyControlPlaneMachine - returns a Ready control plane PlunderMachine of the cluster that other machines can
+// join through, nil is returned if there isn't one
+func readyControlPlaneMachine(ctx context.Context, c client.Client, cluster *clusterv1.Cluster) (*infrav1.PlunderMachine, error) {
+	machines := &clusterv1.MachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.MachineClusterLabelName: cluster.Name}); err != nil {
+		return nil, err
+	}
+	for i := range machines.Items {
+		m := &machines.Items[i]
+		if !util.IsControlPlaneMachine(m) || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		pm := &infrav1.PlunderMachine{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: m.Spec.InfrastructureRef.Name}, pm)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pm.Status.Phase == infrav1.MachinePhaseReady && pm.DeletionTimestamp.IsZero() && pm.Spec.IPAddress != nil {
+			return pm, nil
+		}
+	}
+	return nil, nil
+}
+
+// specEndpoint - returns the control plane endpoint set on the PlunderCluster, either the ControlPlaneEndpoint
+// or StaticIP. Nil is returned if neither is set.
+func specEndpoint(plunderCluster *infrav1.PlunderCluster) *infrav1.APIEndpoint {
+	if e := plunderCluster.Spec.ControlPlaneEndpoint; e != nil && e.Host != "" {
+		port := int(e.Port)
+		if port == 0 {
+			port = infrav1.APIServerPortDefault
+		}
+		return &infrav1.APIEndpoint{Host: e.Host, Port: port}
+	}
+	if plunderCluster.Spec.StaticIP != "" {
+		return &infrav1.APIEndpoint{Host: plunderCluster.Spec.StaticIP, Port: infrav1.APIServerPortDefault}
+	}
+	return nil
+}
+
+// controlPlaneEndpoint - returns the address:port that machines use to reach the control plane, the endpoint on
+// the PlunderCluster is used when it is set so that the endpoint doesn't change with the first control plane
+func controlPlaneEndpoint(plunderCluster *infrav1.PlunderCluster, initMachine *infrav1.PlunderMachine) string {
+	if e := specEndpoint(plunderCluster); e != nil {
+		return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	}
+	return net.JoinHostPort(*initMachine.Spec.IPAddress, strconv.Itoa(infrav1.APIServerPortDefault))
+}
+
+// initMachineEndpoint - returns the endpoint of the machine holding the control plane lock, nil is returned if
+// no machine has taken the lock yet
+func initMachineEndpoint(ctx context.Context, c client.Client, cluster *clusterv1.Cluster) (*infrav1.APIEndpoint, error) {
+	lock := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: initLockName(cluster.Name)}, lock)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	holder := &infrav1.PlunderMachine{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: lock.Data["machine"]}, holder)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil || string(holder.UID) != lock.Data["uid"] {
+		if !cluster.Status.ControlPlaneInitialized {
+			return nil, nil
+		}
+		// The init machine has gone, so the endpoint moves to another control plane machine
+		if holder, err = readyControlPlaneMachine(ctx, c, cluster); holder == nil || err != nil {
+			return nil, err
+		}
+	}
+	if holder.Spec.IPAddress == nil {
+		return nil, nil
+	}
+	return &infrav1.APIEndpoint{Host: *holder.Spec.IPAddress, Port: infrav1.APIServerPortDefault}, nil
+}
+
+// kubeVIPConfig - returns the kube-vip configuration for the control plane machines of a cluster, nil is returned
+// if the endpoint of the cluster isn't provided by kube-vip
+func kubeVIPConfig(plunderCluster *infrav1.PlunderCluster, network *plunder.NetworkConfig) (*plunder.KubeVIPConfig, error) {
+	e := plunderCluster.Spec.ControlPlaneEndpoint
+	if e == nil || e.Type != infrav1.EndpointTypeKubeVIP {
+		return nil, nil
+	}
+	if net.ParseIP(e.Host) == nil {
+		return nil, fmt.Errorf("The kube-vip endpoint [%s] must be an IP address", e.Host)
+	}
+
+	vip := &plunder.KubeVIPConfig{
+		VIP:       e.Host,
+		Port:      specEndpoint(plunderCluster).Port,
+		Interface: e.Interface,
+		Image:     e.KubeVIPImage,
+	}
+	if vip.Interface == "" {
+		vip.Interface = network.Link()
+	}
+	if vip.Interface == "" {
+		return nil, fmt.Errorf("An interface is required to advertise the kube-vip endpoint [%s]", e.Host)
+	}
+	if vip.Image == "" {
+		vip.Image = infrav1.KubeVIPImageDefault
+	}
+	return vip, nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// cluster - returns the Cluster as it is stored
+func (m *machineTest) cluster() *clusterv1.Cluster {
+	m.t.Helper()
+	cluster := &clusterv1.Cluster{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "cluster"}, cluster); err != nil {
+		m.t.Fatal(err)
+	}
+	return cluster
+}
+
+// updateCluster - changes the Cluster, along with its status
+func (m *machineTest) updateCluster(modify func(cluster *clusterv1.Cluster)) {
+	m.t.Helper()
+	cluster := m.cluster()
+	modify(cluster)
+	if err := m.k8s.Update(context.TODO(), cluster); err != nil {
+		m.t.Fatal(err)
+	}
+	// The update only wrote the spec, so the status is changed through the status subresource
+	cluster = m.cluster()
+	modify(cluster)
+	if err := m.k8s.Status().Update(context.TODO(), cluster); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// initLock - returns the machine named by the control plane init lock
+func (m *machineTest) initLock() string {
+	m.t.Helper()
+	lock := &corev1.ConfigMap{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: initLockName("cluster")}, lock); err != nil {
+		m.t.Fatal(err)
+	}
+	return lock.Data["machine"]
+}
+
+func TestInitMachineDeletedAfterInit(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.setControlPlane()
+	m.reconcileUntil(infrav1.MachinePhaseReady)
+	second := m.addMachine(1, "192.168.1.11", "00:50:56:a5:b5:f2", true)
+	second.reconcileUntil(infrav1.MachinePhaseReady)
+	m.updateCluster(func(cluster *clusterv1.Cluster) {
+		cluster.Status.ControlPlaneInitialized = true
+	})
+
+	// The machine that initialised the control plane is removed
+	m.update(func(pm *infrav1.PlunderMachine) {
+		pm.Finalizers = nil
+	})
+	if err := m.k8s.Delete(context.TODO(), m.machine()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new control plane machine joins through the one that is left, rather than initialising the cluster again
+	third := m.addMachine(2, "192.168.1.12", "00:50:56:a5:b5:f3", true)
+	third.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+	job := third.lastJob()
+	if len(job.Deployments) != 2 || job.Deployments[0].Hosts[0] != "192.168.1.11" {
+		t.Fatalf("expected the join to be prepared on the remaining control plane, got %+v", job.Deployments)
+	}
+	for _, a := range job.Deployments[1].Actions {
+		if strings.Contains(a.Command, "kubeadm init") {
+			t.Fatalf("the control plane was initialised again: %s", a.Command)
+		}
+	}
+	if join := findAction(job.Deployments[1], "Join Control Plane to cluster"); join == nil || !strings.Contains(join.Command, "kubeadm join 192.168.1.11:6443") {
+		t.Errorf("the control plane didn't join through the remaining control plane: %+v", job.Deployments[1])
+	}
+	if holder := m.initLock(); holder != "plundermachine-0" {
+		t.Errorf("the init lock was taken again by %s", holder)
+	}
+
+	endpoint, err := initMachineEndpoint(context.TODO(), m.k8s, m.cluster())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint == nil || endpoint.Host != "192.168.1.11" {
+		t.Errorf("expected the endpoint to move to the remaining control plane, got %+v", endpoint)
+	}
+}
+
+func TestInitMachineDeletedBeforeInit(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.setControlPlane()
+	m.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+
+	// The machine initialising the control plane is removed before the cluster is initialised, so another
+	// control plane machine takes over
+	m.update(func(pm *infrav1.PlunderMachine) {
+		pm.Finalizers = nil
+	})
+	if err := m.k8s.Delete(context.TODO(), m.machine()); err != nil {
+		t.Fatal(err)
+	}
+	second := m.addMachine(1, "192.168.1.11", "00:50:56:a5:b5:f2", true)
+	second.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+	if holder := m.initLock(); holder != "plundermachine-1" {
+		t.Errorf("expected plundermachine-1 to take the init lock, it is held by %s", holder)
+	}
+	if findAction(second.lastJob().Deployments[0], "Cluster-API provisioning [Initialise Kubernetes") == nil {
+		t.Error("the new control plane machine didn't initialise the cluster")
+	}
+}
+
+func TestInitMachineNoPodNetwork(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.setControlPlane()
+	m.updateCluster(func(cluster *clusterv1.Cluster) {
+		cluster.Spec.ClusterNetwork = nil
+	})
+	m.reconcileUntil(infrav1.MachinePhaseOSReady)
+
+	result := m.reconcile()
+	if phase := m.machine().Status.Phase; phase != infrav1.MachinePhaseOSReady {
+		t.Fatalf("expected the machine to wait in the %s phase, got %s", phaseName(infrav1.MachinePhaseOSReady), phaseName(phase))
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected the machine to be requeued until the pod network is set")
+	}
+	if status, reason := m.condition(infrav1.ConditionKubernetesInstalled); status != corev1.ConditionFalse || reason != reasonInvalidConfiguration {
+		t.Errorf("expected KubernetesInstalled to be False (%s), got %s (%s)", reasonInvalidConfiguration, status, reason)
+	}
+	if events := strings.Join(m.events(), "\n"); !strings.Contains(events, "has no pod network set") {
+		t.Errorf("the missing pod network wasn't reported: %s", events)
+	}
+}
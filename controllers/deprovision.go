@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	// deprovisionRequeue is how long to wait between checks that a host has been cleaned
+	deprovisionRequeue = 15 * time.Second
+
+	// deprovisionRetryInitial is how long to wait before retrying the removal of a host the first time it fails,
+	// the wait doubles with each failure up to deprovisionRetryMax
+	deprovisionRetryInitial = 30 * time.Second
+
+	// deprovisionRetryMax is the longest wait between attempts to remove a host
+	deprovisionRetryMax = 30 * time.Minute
+)
+
+// deprovisionRetry - returns how long to wait before retrying the removal of a host that has failed a number of
+// times
+func deprovisionRetry(failures int32) time.Duration {
+	wait := deprovisionRetryInitial
+	for i := int32(1); i < failures && wait < deprovisionRetryMax; i++ {
+		wait *= 2
+	}
+	if wait > deprovisionRetryMax {
+		wait = deprovisionRetryMax
+	}
+	return wait
+}
+
+// forceDelete - returns true if the PlunderMachine or its Machine has the ForceDeleteAnnotation
+func forceDelete(machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine) bool {
+	if _, ok := plunderMachine.Annotations[infrav1.ForceDeleteAnnotation]; ok {
+		return true
+	}
+	_, ok := machine.Annotations[infrav1.ForceDeleteAnnotation]
+	return ok
+}
+
+// deprovisionPolicy - returns the policy used to clean the host of a machine, the policy of the machine is used
+// over the policy of the cluster and the mode defaults to Quick
+func deprovisionPolicy(plunderMachine *infrav1.PlunderMachine, plunderCluster *infrav1.PlunderCluster) infrav1.DeprovisionPolicy {
+	var policy infrav1.DeprovisionPolicy
+	switch {
+	case plunderMachine.Spec.Deprovision != nil:
+		policy = *plunderMachine.Spec.Deprovision
+	case plunderCluster != nil && plunderCluster.Spec.Deprovision != nil:
+		policy = *plunderCluster.Spec.Deprovision
+	}
+	if policy.Mode == "" {
+		policy.Mode = infrav1.DeprovisionModeQuick
+	}
+	return policy
+}
+
+// deprovisionConfig - converts a deprovision policy into the configuration used by the Plunder client
+func deprovisionConfig(policy infrav1.DeprovisionPolicy) (*plunder.DeprovisionConfig, error) {
+	d := &plunder.DeprovisionConfig{
+		Mode:   string(policy.Mode),
+		Disks:  policy.Disks,
+		Reboot: !policy.SkipReboot,
+	}
+	if policy.Mode == infrav1.DeprovisionModeCustom {
+		if len(policy.Actions) == 0 {
+			return nil, fmt.Errorf("The Custom deprovision mode needs at least one action")
+		}
+		for _, a := range policy.Actions {
+			action := parlaytypes.Action{
+				ActionType:    "command",
+				Command:       a.Command,
+				Name:          a.Name,
+				CommandSudo:   "root",
+				IgnoreFailure: a.IgnoreFailure,
+			}
+			if a.TimeoutSeconds != nil {
+				action.Timeout = int(*a.TimeoutSeconds)
+			}
+			d.Actions = append(d.Actions, action)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// drainRequeue is how long to wait between attempts to drain a node
+const drainRequeue = 10 * time.Second
+
+// mirrorPodAnnotation is set on the static pods of a node, they are recreated by the kubelet so can't be evicted
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// newWorkloadClient - creates a client for the workload cluster with the constructor, if there isn't a
+// constructor then the client is created from the <cluster>-kubeconfig Secret
+func newWorkloadClient(constructor func(client.Client, *clusterv1.Cluster) (typedcorev1.CoreV1Interface, error), c client.Client, cluster *clusterv1.Cluster) (typedcorev1.CoreV1Interface, error) {
+	if constructor != nil {
+		return constructor(c, cluster)
+	}
+	remoteClient, err := remote.NewClusterClient(c, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return remoteClient.CoreV1()
+}
+
+// skipDrain - returns true if the PlunderMachine or its Machine has the SkipDrainAnnotation
+func skipDrain(machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine) bool {
+	if _, ok := plunderMachine.Annotations[infrav1.SkipDrainAnnotation]; ok {
+		return true
+	}
+	_, ok := machine.Annotations[infrav1.SkipDrainAnnotation]
+	return ok
+}
+
+// podsToEvict - returns the pods that have to be evicted for a node to be drained, mirror pods and pods managed by
+// a DaemonSet would only be recreated on the node and pods that have finished don't need evicting
+func podsToEvict(pods []corev1.Pod) []corev1.Pod {
+	var evict []corev1.Pod
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		evict = append(evict, pod)
+	}
+	return evict
+}
+
+// reconcileDrain - cordons the node of a deleted machine, evicts its pods and then removes the node from the
+// workload cluster. Evictions respect PodDisruptionBudgets, so a drain can take several attempts. It returns true
+// once the node has been removed (or there isn't one), once the drain timeout has passed the node is removed
+// without waiting for the remaining pods.
+func (r *PlunderMachineReconciler) reconcileDrain(logger logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, ds *infrav1.DeprovisionStatus) (bool, error) {
+	if machine.Status.NodeRef == nil {
+		return true, nil
+	}
+	nodeName := machine.Status.NodeRef.Name
+
+	// The workload cluster is going away, so there is nothing to drain the pods to
+	if !cluster.DeletionTimestamp.IsZero() {
+		logger.Info(fmt.Sprintf("The cluster is being deleted, node %s won't be drained", nodeName))
+		return true, nil
+	}
+
+	if ds.DrainStarted == nil {
+		now := metav1.Now()
+		ds.DrainStarted = &now
+	}
+	timeout := drainTimeout(plunderMachine, r.Timeouts)
+	timedOut := timeout != 0 && time.Since(ds.DrainStarted.Time) > timeout
+
+	done, err := r.drainNode(logger, machine, plunderMachine, cluster, nodeName, timedOut)
+	if timedOut && (err != nil || !done) {
+		logger.Info(fmt.Sprintf("Node %s couldn't be drained within %s [%v]", nodeName, timeout, err))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "DrainTimeout", "The node %s couldn't be drained and removed within %s, the host will be deprovisioned anyway", nodeName, timeout)
+		return true, nil
+	}
+	return done, err
+}
+
+// drainNode - cordons and drains a node, then removes it. When force is set the pods aren't evicted.
+func (r *PlunderMachineReconciler) drainNode(logger logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, nodeName string, force bool) (bool, error) {
+	core, err := newWorkloadClient(r.NewWorkloadClient, r.Client, cluster)
+	if err != nil {
+		return false, err
+	}
+
+	nodes := core.Nodes()
+	node, err := nodes.Get(nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !node.Spec.Unschedulable {
+		node.Spec.Unschedulable = true
+		if _, err := nodes.Update(node); err != nil {
+			return false, err
+		}
+		logger.Info(fmt.Sprintf("Cordoned node %s", nodeName))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDrain", "The node %s has been cordoned", nodeName)
+	}
+
+	if skipDrain(machine, plunderMachine) {
+		logger.Info(fmt.Sprintf("Node %s won't be drained as it has the %s annotation", nodeName, infrav1.SkipDrainAnnotation))
+	} else if !force {
+		pods, err := core.Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+		if err != nil {
+			return false, err
+		}
+
+		evict := podsToEvict(pods.Items)
+		for _, pod := range evict {
+			if pod.DeletionTimestamp != nil {
+				// Already evicted, waiting for it to stop
+				continue
+			}
+			err := core.Pods(pod.Namespace).Evict(&policyv1beta1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			})
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				// A PodDisruptionBudget won't allow the pod to be evicted yet, so it is tried again later
+				logger.Info(fmt.Sprintf("Eviction of pod %s/%s is blocked by a PodDisruptionBudget", pod.Namespace, pod.Name))
+			default:
+				return false, err
+			}
+		}
+
+		if len(evict) != 0 {
+			setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonDraining, "Draining the node %s, %d pods remaining", nodeName, len(evict))
+			return false, nil
+		}
+	}
+
+	if err := nodes.Delete(nodeName, nil); err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	logger.Info(fmt.Sprintf("Removed node %s", nodeName))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDrain", "The node %s has been drained and removed", nodeName)
+	return true, nil
+}
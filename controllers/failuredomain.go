@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// machineFailureDomain - returns the failure domain a machine has been placed in, or the one it has requested if
+// it hasn't been placed yet. An empty name means the machine isn't in a failure domain.
+func machineFailureDomain(plunderMachine *infrav1.PlunderMachine) string {
+	if plunderMachine.Status.FailureDomain != "" {
+		return plunderMachine.Status.FailureDomain
+	}
+	if plunderMachine.Spec.FailureDomain != nil {
+		return *plunderMachine.Spec.FailureDomain
+	}
+	return ""
+}
+
+// failureDomainServer - returns the name of the PlunderServer the hosts of a failure domain are provisioned
+// through, this is the server of the cluster if the failure domain doesn't have one
+func failureDomainServer(plunderCluster *infrav1.PlunderCluster, fd *infrav1.FailureDomainSpec) string {
+	if fd != nil && fd.PlunderServerRef != nil {
+		return fd.PlunderServerRef.Name
+	}
+	return plunderServerName(plunderCluster)
+}
+
+// failureDomainFilter - returns a filter that matches the hosts in a failure domain, a nil failure domain matches
+// every host of the cluster's server
+func failureDomainFilter(plunderCluster *infrav1.PlunderCluster, fd *infrav1.FailureDomainSpec) (func(*infrav1.PlunderHost) bool, error) {
+	server := failureDomainServer(plunderCluster, fd)
+	selector := labels.Everything()
+	if fd != nil && fd.HostSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(fd.HostSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hostSelector for failure domain %s [%v]", fd.Name, err)
+		}
+	}
+	return func(host *infrav1.PlunderHost) bool {
+		return hostServerName(host) == server && selector.Matches(labels.Set(host.Labels))
+	}, nil
+}
+
+// reportedFailureDomains - returns the failure domains of a cluster in the form Cluster API expects
+func reportedFailureDomains(plunderCluster *infrav1.PlunderCluster) infrav1.FailureDomains {
+	if len(plunderCluster.Spec.FailureDomains) == 0 {
+		return nil
+	}
+	domains := infrav1.FailureDomains{}
+	for i := range plunderCluster.Spec.FailureDomains {
+		fd := &plunderCluster.Spec.FailureDomains[i]
+		reported := infrav1.FailureDomain{ControlPlane: fd.ControlPlane}
+		if server := failureDomainServer(plunderCluster, fd); server != "" {
+			reported.Attributes = map[string]string{infrav1.FailureDomainServerAttribute: server}
+		}
+		domains[fd.Name] = reported
+	}
+	return domains
+}
+
+// controlPlaneFailureDomains - returns the failure domains that control plane machines can be placed in, ordered by
+// how many control plane machines of the cluster (other than plunderMachine) are already in each, fewest first
+func controlPlaneFailureDomains(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster, plunderMachine *infrav1.PlunderMachine) ([]*infrav1.FailureDomainSpec, error) {
+	var domains []*infrav1.FailureDomainSpec
+	for i := range plunderCluster.Spec.FailureDomains {
+		if plunderCluster.Spec.FailureDomains[i].ControlPlane {
+			domains = append(domains, &plunderCluster.Spec.FailureDomains[i])
+		}
+	}
+	if len(domains) < 2 {
+		return domains, nil
+	}
+
+	machines := &clusterv1.MachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.MachineClusterLabelName: cluster.Name}); err != nil {
+		return nil, err
+	}
+	plunderMachines := &infrav1.PlunderMachineList{}
+	if err := c.List(ctx, plunderMachines, client.InNamespace(cluster.Namespace)); err != nil {
+		return nil, err
+	}
+	byName := map[string]*infrav1.PlunderMachine{}
+	for i := range plunderMachines.Items {
+		byName[plunderMachines.Items[i].Name] = &plunderMachines.Items[i]
+	}
+
+	count := map[string]int{}
+	for i := range machines.Items {
+		m := &machines.Items[i]
+		if !util.IsControlPlaneMachine(m) || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		pm, ok := byName[m.Spec.InfrastructureRef.Name]
+		if !ok || pm.UID == plunderMachine.UID {
+			continue
+		}
+		count[machineFailureDomain(pm)]++
+	}
+
+	sort.SliceStable(domains, func(i, j int) bool {
+		return count[domains[i].Name] < count[domains[j].Name]
+	})
+	return domains, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// HostDiscovery periodically asks the DHCP server of each Plunder server for hosts that are looking for an
+// address and adds them to the inventory as PlunderHosts
+type HostDiscovery struct {
+	client.Client
+	Log logr.Logger
+
+	// Namespace is where newly discovered PlunderHosts are created
+	Namespace string
+
+	// Interval is how often the Plunder servers are checked for new hosts
+	Interval time.Duration
+
+	// NewPlunderClient creates the client used to talk to a Plunder server, plunder.NewInterface is used for the
+	// default server if it is nil
+	NewPlunderClient func(server string) (plunder.Interface, error)
+}
+
+// SetupWithManager - will add host discovery to the manager, it is only ran by the leader
+func (d *HostDiscovery) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(d)
+}
+
+// Start - will discover hosts every Interval until stop is closed
+func (d *HostDiscovery) Start(stop <-chan struct{}) error {
+	d.Log.Info(fmt.Sprintf("Discovering hosts every %s", d.Interval))
+	wait.Until(d.discover, d.Interval, stop)
+	return nil
+}
+
+// discover - asks the default Plunder server and every PlunderServer for the hosts that are looking for an address
+func (d *HostDiscovery) discover() {
+	ctx := context.Background()
+
+	servers := &infrav1.PlunderServerList{}
+	if err := d.List(ctx, servers); err != nil {
+		d.Log.Error(err, "unable to list PlunderServers")
+		return
+	}
+
+	// When PlunderServers are in use there may not be a default server configured
+	c, err := newPlunderClient(d.NewPlunderClient, "")
+	switch {
+	case err == nil:
+		d.discoverServer(ctx, c, "")
+	case len(servers.Items) != 0 && isCredentialsError(err):
+		d.Log.V(1).Info("Skipping the default Plunder server", "reason", err.Error())
+	default:
+		d.Log.Error(err, "unable to create Plunder client")
+	}
+
+	for i := range servers.Items {
+		server := servers.Items[i].Name
+		c, err := newPlunderClient(d.NewPlunderClient, server)
+		if err != nil {
+			d.Log.Error(err, "unable to create Plunder client", "plunderserver", server)
+			continue
+		}
+		d.discoverServer(ctx, c, server)
+	}
+}
+
+// discoverServer - creates a PlunderHost for every unleased host of a Plunder server that isn't in the inventory,
+// and updates when existing hosts were last seen. Hosts of a PlunderServer are labelled with its name.
+func (d *HostDiscovery) discoverServer(ctx context.Context, c plunder.Interface, server string) {
+	log := d.Log
+	if server != "" {
+		log = log.WithValues("plunderserver", server)
+	}
+
+	unleased, err := c.UnleasedMachines()
+	if err != nil {
+		log.Error(err, "unable to retrieve unleased hosts")
+		return
+	}
+
+	for i := range unleased {
+		mac := strings.ToLower(unleased[i].MAC)
+		seen := metav1.NewTime(unleased[i].Expiry)
+		name := HostName(mac)
+
+		host := &infrav1.PlunderHost{}
+		err := d.Get(ctx, types.NamespacedName{Namespace: d.Namespace, Name: name}, host)
+		if apierrors.IsNotFound(err) {
+			labels := map[string]string{infrav1.HostDiscoveredLabel: "true"}
+			if server != "" {
+				labels[infrav1.HostServerLabel] = server
+			}
+			host = &infrav1.PlunderHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: d.Namespace,
+					Labels:    labels,
+				},
+				Spec: infrav1.PlunderHostSpec{
+					MACAddress: mac,
+				},
+				Status: infrav1.PlunderHostStatus{
+					State:    infrav1.HostStateAvailable,
+					LastSeen: &seen,
+				},
+			}
+			if err := d.Create(ctx, host); err != nil && !apierrors.IsAlreadyExists(err) {
+				log.Error(err, "unable to create PlunderHost", "macaddress", mac)
+				continue
+			}
+			log.Info(fmt.Sprintf("Discovered new host %s", mac))
+			continue
+		}
+		if err != nil {
+			log.Error(err, "unable to retrieve PlunderHost", "macaddress", mac)
+			continue
+		}
+
+		if host.Status.LastSeen != nil && !host.Status.LastSeen.Before(&seen) {
+			continue
+		}
+		host.Status.LastSeen = &seen
+		// A conflict means the host is being claimed, it will be updated on the next pass
+		if err := d.Update(ctx, host); err != nil && !apierrors.IsConflict(err) {
+			log.Error(err, "unable to update PlunderHost", "macaddress", mac)
+		}
+	}
+}
+
+// HostName - returns the name of the PlunderHost for a MAC address
+func HostName(mac string) string {
+	return "host-" + strings.Replace(strings.ToLower(mac), ":", "-", -1)
+}
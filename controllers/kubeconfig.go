@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/kubeadm"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	// kubeconfigRenewal is how long before the admin certificate expires that a new kubeconfig is generated
+	kubeconfigRenewal = 30 * 24 * time.Hour
+
+	// kubeconfigManagedLabel is set on the kubeconfig Secrets created by the controller, only those are updated
+	kubeconfigManagedLabel = "plundercluster.infrastructure.cluster.x-k8s.io/kubeconfig"
+)
+
+// reconcileKubeconfig - makes sure the <cluster>-kubeconfig Secret exists and points at the control plane
+// endpoint. The kubeconfig uses an admin certificate signed by the certificate authority of the cluster, nothing
+// is done until the certificate authority exists. A kubeconfig Secret that was created by something else (such as
+// a bootstrap or control plane provider) is left alone.
+func reconcileKubeconfig(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, endpoint *infrav1.APIEndpoint) error {
+	ca := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: caSecretName(cluster.Name)}, ca)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	server := fmt.Sprintf("https://%s", net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port)))
+
+	secret := &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: kubeconfig.SecretName(cluster.Name)}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if exists && secret.Labels[kubeconfigManagedLabel] != "true" {
+		return nil
+	}
+	if exists {
+		config, err := clientcmd.Load(secret.Data[kubeconfig.SecretKey])
+		if err == nil && kubeconfigCurrent(config, server) {
+			return nil
+		}
+	}
+
+	data, err := newKubeconfig(cluster.Name, server, ca.Data[corev1.TLSCertKey], ca.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		secret.Data = map[string][]byte{kubeconfig.SecretKey: data}
+		return c.Update(ctx, secret)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            kubeconfig.SecretName(cluster.Name),
+			Namespace:       cluster.Namespace,
+			Labels:          map[string]string{clusterv1.MachineClusterLabelName: cluster.Name, kubeconfigManagedLabel: "true"},
+			OwnerReferences: []metav1.OwnerReference{clusterOwnerRef(cluster)},
+		},
+		Type: clusterSecretType,
+		Data: map[string][]byte{kubeconfig.SecretKey: data},
+	}
+	err = c.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		// It will be checked again on the next reconcile
+		return nil
+	}
+	return err
+}
+
+// kubeconfigCurrent - returns true if every cluster in the kubeconfig uses the server and none of the client
+// certificates are about to expire
+func kubeconfigCurrent(config *clientcmdapi.Config, server string) bool {
+	if len(config.Clusters) == 0 || len(config.AuthInfos) == 0 {
+		return false
+	}
+	for _, cluster := range config.Clusters {
+		if cluster.Server != server {
+			return false
+		}
+	}
+	for _, user := range config.AuthInfos {
+		if len(user.ClientCertificateData) == 0 {
+			continue
+		}
+		expiry, err := kubeadm.CertificateExpiry(user.ClientCertificateData)
+		if err != nil || time.Until(expiry) < kubeconfigRenewal {
+			return false
+		}
+	}
+	return true
+}
+
+// newKubeconfig - generates an admin kubeconfig for the cluster
+func newKubeconfig(clusterName, server string, caCert, caKey []byte) ([]byte, error) {
+	cert, key, err := kubeadm.NewClientCertificate(caCert, caKey, "kubernetes-admin", []string{"system:masters"})
+	if err != nil {
+		return nil, err
+	}
+
+	user := fmt.Sprintf("%s-admin", clusterName)
+	contextName := fmt.Sprintf("%s@%s", user, clusterName)
+	config := clientcmdapi.NewConfig()
+	config.Clusters[clusterName] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: caCert,
+	}
+	config.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: cert,
+		ClientKeyData:         key,
+	}
+	config.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:  clusterName,
+		AuthInfo: user,
+	}
+	config.CurrentContext = contextName
+	return clientcmd.Write(*config)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/kubeadm"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// newKubeconfigTest - returns an API server holding a cluster and its certificate authority, along with any
+// other objects
+func newKubeconfigTest(t *testing.T, objs ...runtime.Object) (*apiServer, *clusterv1.Cluster) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+
+	cert, key, err := kubeadm.NewCertificateAuthority("kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cluster", UID: "cluster-uid"}}
+	ca := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: caSecretName(cluster.Name)},
+		Data:       map[string][]byte{corev1.TLSCertKey: cert, corev1.TLSPrivateKeyKey: key},
+	}
+	return newAPIServer(scheme, append([]runtime.Object{cluster, ca}, objs...)...), cluster
+}
+
+// kubeconfigSecret - returns the kubeconfig Secret of the cluster
+func kubeconfigSecret(t *testing.T, k8s *apiServer) *corev1.Secret {
+	t.Helper()
+	secret := &corev1.Secret{}
+	if err := k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: kubeconfig.SecretName("cluster")}, secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestReconcileKubeconfigNotManaged(t *testing.T) {
+	// A kubeconfig written by something else is never changed, even if it is owned by the cluster and isn't valid
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      kubeconfig.SecretName("cluster"),
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: "cluster"},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: "cluster", UID: "cluster-uid"},
+			},
+		},
+		Data: map[string][]byte{kubeconfig.SecretKey: []byte("not a kubeconfig")},
+	}
+	k8s, cluster := newKubeconfigTest(t, existing)
+
+	if err := reconcileKubeconfig(context.TODO(), k8s, cluster, &infrav1.APIEndpoint{Host: "192.168.1.10", Port: 6443}); err != nil {
+		t.Fatal(err)
+	}
+	secret := kubeconfigSecret(t, k8s)
+	if string(secret.Data[kubeconfig.SecretKey]) != "not a kubeconfig" || secret.Labels[kubeconfigManagedLabel] != "" {
+		t.Errorf("a kubeconfig that wasn't created by the controller was changed: %v", secret.Labels)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// normalizeMAC - returns a MAC address in the lower case colon separated form, so that addresses written
+// differently can be compared
+func normalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return strings.ToLower(mac)
+	}
+	return hw.String()
+}
+
+// parseMacPool - checks every entry in a ControlPlaneMacPool is a MAC address and returns them as a set
+func parseMacPool(pool []string) (map[string]bool, error) {
+	macs := map[string]bool{}
+	for _, mac := range pool {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("ControlPlaneMacPool entry [%s] is not a valid MAC address", mac)
+		}
+		macs[hw.String()] = true
+	}
+	return macs, nil
+}
+
+// reservedMACs - returns every MAC address that is in the ControlPlaneMacPool of a PlunderMachine in the
+// namespace (or in any namespace if it is empty), these are kept for control plane machines
+func reservedMACs(ctx context.Context, c client.Client, namespace string) (map[string]bool, error) {
+	machines := &infrav1.PlunderMachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	reserved := map[string]bool{}
+	for i := range machines.Items {
+		for _, mac := range machines.Items[i].Spec.ControlPlaneMacPool {
+			reserved[normalizeMAC(mac)] = true
+		}
+	}
+	return reserved, nil
+}
+
+// macPoolFilter - returns the filter applied to hosts when a machine is claiming one, a control plane machine
+// with a ControlPlaneMacPool can only use the hosts in its pool and every other machine can't use hosts that are
+// reserved by any pool. The hosts in the namespace of discovered hosts (hostNamespace) are shared between
+// namespaces, so the pools of every namespace reserve them.
+func macPoolFilter(ctx context.Context, c client.Client, plunderMachine *infrav1.PlunderMachine, hostNamespace string, controlPlane bool) (func(*infrav1.PlunderHost) bool, error) {
+	pool, err := parseMacPool(plunderMachine.Spec.ControlPlaneMacPool)
+	if err != nil {
+		return nil, err
+	}
+
+	if controlPlane && len(pool) != 0 {
+		return func(host *infrav1.PlunderHost) bool {
+			return pool[normalizeMAC(host.Spec.MACAddress)]
+		}, nil
+	}
+
+	reserved, err := reservedMACs(ctx, c, plunderMachine.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	shared := reserved
+	if hostNamespace != "" && hostNamespace != plunderMachine.Namespace {
+		if shared, err = reservedMACs(ctx, c, ""); err != nil {
+			return nil, err
+		}
+	}
+	return func(host *infrav1.PlunderHost) bool {
+		if host.Namespace != plunderMachine.Namespace {
+			return !shared[normalizeMAC(host.Spec.MACAddress)]
+		}
+		return !reserved[normalizeMAC(host.Spec.MACAddress)]
+	}, nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// mergeNetwork - returns the network configuration of a machine, fields that the machine leaves blank are taken
+// from the cluster and then from the pool the address of the machine was allocated from
+func mergeNetwork(machine, cluster *infrav1.NetworkConfig, pool *infrav1.PlunderIPPool) infrav1.NetworkConfig {
+	n := infrav1.NetworkConfig{}
+	for _, layer := range []*infrav1.NetworkConfig{machine, cluster} {
+		if layer == nil {
+			continue
+		}
+		if n.Interface == "" {
+			n.Interface = layer.Interface
+		}
+		if n.Gateway == "" {
+			n.Gateway = layer.Gateway
+		}
+		if n.PrefixLength == nil {
+			n.PrefixLength = layer.PrefixLength
+		}
+		if len(n.Nameservers) == 0 {
+			n.Nameservers = layer.Nameservers
+		}
+		if len(n.SearchDomains) == 0 {
+			n.SearchDomains = layer.SearchDomains
+		}
+		if n.VLANID == nil {
+			n.VLANID = layer.VLANID
+		}
+		if n.Bond == nil {
+			n.Bond = layer.Bond
+		}
+	}
+
+	if pool != nil {
+		if n.Gateway == "" {
+			n.Gateway = pool.Spec.Gateway
+		}
+		if len(n.Nameservers) == 0 {
+			n.Nameservers = pool.Spec.DNS
+		}
+		if _, network, err := net.ParseCIDR(pool.Spec.CIDR); n.PrefixLength == nil && err == nil {
+			ones, _ := network.Mask.Size()
+			prefix := int32(ones)
+			n.PrefixLength = &prefix
+		}
+	}
+	return n
+}
+
+// validateNetwork - checks the network configuration makes sense for the address of the machine, and converts it
+// to the configuration passed to Plunder
+func validateNetwork(ipAddress string, n infrav1.NetworkConfig) (*plunder.NetworkConfig, error) {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return nil, fmt.Errorf("Address [%s] is not a valid IP address", ipAddress)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		bits = 32
+	}
+
+	config := &plunder.NetworkConfig{
+		Adapter:       n.Interface,
+		Gateway:       n.Gateway,
+		PrefixLength:  -1,
+		NameServers:   n.Nameservers,
+		SearchDomains: n.SearchDomains,
+	}
+
+	if n.PrefixLength != nil {
+		if *n.PrefixLength < 0 || int(*n.PrefixLength) > bits {
+			return nil, fmt.Errorf("Prefix length [%d] is not valid for address [%s]", *n.PrefixLength, ipAddress)
+		}
+		config.PrefixLength = int(*n.PrefixLength)
+	}
+
+	if n.Gateway != "" {
+		gw := net.ParseIP(n.Gateway)
+		if gw == nil || (gw.To4() != nil) != (bits == 32) {
+			return nil, fmt.Errorf("Gateway [%s] is not a valid address", n.Gateway)
+		}
+		if config.PrefixLength >= 0 {
+			subnet := net.IPNet{IP: ip.Mask(net.CIDRMask(config.PrefixLength, bits)), Mask: net.CIDRMask(config.PrefixLength, bits)}
+			if !subnet.Contains(gw) {
+				return nil, fmt.Errorf("Gateway [%s] is not in the same subnet as [%s/%d]", n.Gateway, ipAddress, config.PrefixLength)
+			}
+		}
+	}
+
+	for _, ns := range n.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return nil, fmt.Errorf("Nameserver [%s] is not a valid address", ns)
+		}
+	}
+
+	for _, domain := range n.SearchDomains {
+		if domain == "" || strings.ContainsAny(domain, " ,") {
+			return nil, fmt.Errorf("Search domain [%s] is not valid", domain)
+		}
+	}
+
+	if n.Bond != nil {
+		if len(n.Bond.Interfaces) == 0 {
+			return nil, fmt.Errorf("A bond needs at least one interface")
+		}
+		// The host is provisioned through one of the bond members
+		if config.Adapter == "" {
+			config.Adapter = n.Bond.Interfaces[0]
+		}
+		config.BondInterfaces = n.Bond.Interfaces
+		config.BondMode = n.Bond.Mode
+	}
+
+	if n.VLANID != nil {
+		if *n.VLANID < 1 || *n.VLANID > 4094 {
+			return nil, fmt.Errorf("VLAN ID [%d] is not valid", *n.VLANID)
+		}
+		config.VLANID = int(*n.VLANID)
+	}
+
+	if config.NeedsNetplan() {
+		if config.Adapter == "" {
+			return nil, fmt.Errorf("An interface is required to configure VLANs, bonds or search domains")
+		}
+		if config.PrefixLength < 0 {
+			return nil, fmt.Errorf("A prefix length is required to configure VLANs, bonds or search domains")
+		}
+	}
+	return config, nil
+}
+
+// claimedPool - returns the PlunderIPPool the address of a machine was allocated from, nil is returned if the
+// address wasn't allocated from a pool (or the pool has gone)
+func claimedPool(ctx context.Context, c client.Client, plunderMachine *infrav1.PlunderMachine) (*infrav1.PlunderIPPool, error) {
+	claim := plunderMachine.Status.IPClaim
+	if claim == nil {
+		return nil, nil
+	}
+	pool := &infrav1.PlunderIPPool{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: plunderMachine.Namespace, Name: claim.PoolName}, pool)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// machineNetwork - returns the network configuration for a machine, an invalid configuration is returned as
+// a Warning event on the machine and a nil configuration with the reason it is invalid
+func (r *PlunderMachineReconciler) machineNetwork(plunderMachine *infrav1.PlunderMachine, plunderCluster *infrav1.PlunderCluster) (_ *plunder.NetworkConfig, invalid error, err error) {
+	pool, err := claimedPool(context.TODO(), r.Client, plunderMachine)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := mergeNetwork(plunderMachine.Spec.Network, plunderCluster.Spec.Network, pool)
+	config, invalid := validateNetwork(*plunderMachine.Spec.IPAddress, n)
+	if invalid != nil {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidNetwork", invalid.Error())
+		return nil, invalid, nil
+	}
+	return config, nil, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// orphanedHostsName is the name of the ConfigMap, in the namespace of the machines, that records the hosts left
+// behind by PlunderMachines that were force removed
+const orphanedHostsName = "plunder-orphaned-hosts"
+
+// orphanedHost is a host that was left behind by a force removed PlunderMachine, it may still be running and have
+// a deployment on its Plunder server
+type orphanedHost struct {
+	PlunderMachine string      `json:"plunderMachine"`
+	Cluster        string      `json:"cluster"`
+	PlunderServer  string      `json:"plunderServer,omitempty"`
+	PlunderHost    string      `json:"plunderHost,omitempty"`
+	MACAddress     string      `json:"macAddress,omitempty"`
+	IPAddress      string      `json:"ipAddress,omitempty"`
+	Reason         string      `json:"reason"`
+	Orphaned       metav1.Time `json:"orphaned"`
+}
+
+// orphanedHostKey - returns the key of the record of a host, it is the MAC address of the host (with dashes as a
+// ConfigMap key can't contain colons) or the name of the machine if it never had a host
+func orphanedHostKey(plunderMachine *infrav1.PlunderMachine) string {
+	if plunderMachine.Status.MACAddress != "" {
+		return strings.Replace(strings.ToLower(plunderMachine.Status.MACAddress), ":", "-", -1)
+	}
+	return plunderMachine.Name
+}
+
+// recordOrphanedHost - adds the host of a machine to the orphaned hosts ConfigMap, an operator removes the record
+// once the host has been dealt with
+func recordOrphanedHost(ctx context.Context, c client.Client, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, reason string) error {
+	record := orphanedHost{
+		PlunderMachine: plunderMachine.Name,
+		Cluster:        cluster.Name,
+		MACAddress:     plunderMachine.Status.MACAddress,
+		Reason:         reason,
+		Orphaned:       metav1.Now(),
+	}
+	if plunderMachine.Status.PlunderServer != nil {
+		record.PlunderServer = *plunderMachine.Status.PlunderServer
+	}
+	if plunderMachine.Status.HostRef != nil {
+		record.PlunderHost = plunderMachine.Status.HostRef.Name
+	}
+	if plunderMachine.Spec.IPAddress != nil {
+		record.IPAddress = *plunderMachine.Spec.IPAddress
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: plunderMachine.Namespace, Name: orphanedHostsName}, cm)
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      orphanedHostsName,
+					Namespace: plunderMachine.Namespace,
+				},
+				Data: map[string]string{orphanedHostKey(plunderMachine): string(data)},
+			}
+			return c.Create(ctx, cm)
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[orphanedHostKey(plunderMachine)] = string(data)
+		return c.Update(ctx, cm)
+	})
+}
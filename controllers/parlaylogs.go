@@ -0,0 +1,253 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	// parlayLogOutputLimit is how much of the output of each action is kept
+	parlayLogOutputLimit = 2048
+
+	// parlayLogHistory is how many captures of the parlay logs are kept for a machine
+	parlayLogHistory = 10
+
+	// parlayLogSizeLimit is the most data kept in the ConfigMap of a machine, older captures are removed to
+	// keep under it (a ConfigMap can't be larger than 1MiB)
+	parlayLogSizeLimit = 512 * 1024
+)
+
+// The status of an action in the parlay logs
+const (
+	parlayActionCompleted = "Completed"
+	parlayActionFailed    = "Failed"
+)
+
+// parlayLogCapture is the parlay logs of a host, captured at the end of a phase of provisioning
+type parlayLogCapture struct {
+	Phase     string            `json:"phase"`
+	Job       string            `json:"job,omitempty"`
+	Attempt   int32             `json:"attempt,omitempty"`
+	Host      string            `json:"host"`
+	State     string            `json:"state"`
+	Captured  metav1.Time       `json:"captured"`
+	Truncated bool              `json:"truncated,omitempty"`
+	Actions   []parlayLogAction `json:"actions"`
+}
+
+// parlayLogAction is the result of one action in the parlay logs
+type parlayLogAction struct {
+	Name    string      `json:"name"`
+	Status  string      `json:"status"`
+	Created metav1.Time `json:"created"`
+	Error   string      `json:"error,omitempty"`
+	Output  string      `json:"output,omitempty"`
+
+	// Redacted is set when the action handles secret material, so its error and output weren't kept
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// parlayLogsName - returns the name of the ConfigMap that holds the parlay logs of a machine
+func parlayLogsName(plunderMachine *infrav1.PlunderMachine) string {
+	return fmt.Sprintf("%s-parlay-logs", plunderMachine.Name)
+}
+
+// machineOwnerRef - returns an owner reference to a PlunderMachine, so that objects are removed with the machine
+func machineOwnerRef(plunderMachine *infrav1.PlunderMachine) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: infrav1.GroupVersion.String(),
+		Kind:       "PlunderMachine",
+		Name:       plunderMachine.Name,
+		UID:        plunderMachine.UID,
+	}
+}
+
+// newParlayLogCapture - converts the parlay logs of a host into a capture for a phase, the output of each action
+// is truncated and the oldest actions are dropped if the capture is still too large. The error and output of
+// actions that handle secret material (such as the key of the certificate authority or the bootstrap data) are
+// never captured, as the ConfigMap can be read by anyone who can read ConfigMaps.
+func newParlayLogCapture(plunderMachine *infrav1.PlunderMachine, phase infrav1.MachinePhase, c plunder.Interface) (*parlayLogCapture, []byte, error) {
+	ipAddress := *plunderMachine.Spec.IPAddress
+	logs, err := c.ParlayLogs(ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	capture := &parlayLogCapture{
+		Phase:    phaseName(phase),
+		Host:     ipAddress,
+		State:    logs.State,
+		Captured: metav1.Now(),
+	}
+	if job := plunderMachine.Status.ParlayJob; job != nil && job.Host == ipAddress && phase == infrav1.MachinePhaseKubernetesInstalling {
+		capture.Job = job.Name
+		capture.Attempt = job.Attempt
+	}
+	for _, e := range logs.Entries {
+		action := parlayLogAction{
+			Name:    e.TaskName,
+			Status:  parlayActionCompleted,
+			Created: metav1.NewTime(e.Created),
+			Error:   truncateOutput(e.Err, parlayLogOutputLimit),
+			Output:  truncateOutput(strings.TrimSpace(e.Entry), parlayLogOutputLimit),
+		}
+		if e.Err != "" {
+			action.Status = parlayActionFailed
+		}
+		if plunder.SensitiveAction(e.TaskName) {
+			action.Error, action.Output, action.Redacted = "", "", true
+		}
+		capture.Actions = append(capture.Actions, action)
+	}
+
+	for {
+		data, err := json.Marshal(capture)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) <= parlayLogSizeLimit || len(capture.Actions) == 0 {
+			return capture, data, nil
+		}
+		capture.Actions = capture.Actions[1:]
+		capture.Truncated = true
+	}
+}
+
+// parlayLogSequence - returns the sequence number of a key in the ConfigMap, keys that weren't written by the
+// controller return -1
+func parlayLogSequence(key string) int {
+	i := strings.Index(key, "-")
+	if i < 0 {
+		return -1
+	}
+	seq, err := strconv.Atoi(key[:i])
+	if err != nil {
+		return -1
+	}
+	return seq
+}
+
+// rotateParlayLogs - removes the oldest captures until there are no more than parlayLogHistory and they fit in
+// parlayLogSizeLimit, the latest capture is always kept
+func rotateParlayLogs(data map[string]string, latest string) {
+	var keys []string
+	size := 0
+	for k, v := range data {
+		if parlayLogSequence(k) < 0 {
+			continue
+		}
+		keys = append(keys, k)
+		size += len(k) + len(v)
+	}
+	sort.Slice(keys, func(i, j int) bool { return parlayLogSequence(keys[i]) < parlayLogSequence(keys[j]) })
+
+	for _, k := range keys {
+		if len(data) <= parlayLogHistory && size <= parlayLogSizeLimit {
+			return
+		}
+		if k == latest {
+			continue
+		}
+		size -= len(k) + len(data[k])
+		delete(data, k)
+	}
+}
+
+// captureParlayLogs - stores the parlay logs of the host of a machine in its ConfigMap, so that the output of the
+// actions can be seen without going to the Plunder server. The ConfigMap is owned by the PlunderMachine.
+func captureParlayLogs(ctx context.Context, k8s client.Client, c plunder.Interface, plunderMachine *infrav1.PlunderMachine, phase infrav1.MachinePhase) error {
+	capture, data, err := newParlayLogCapture(plunderMachine, phase, c)
+	if err != nil {
+		return err
+	}
+
+	name := parlayLogsName(plunderMachine)
+	cm := &corev1.ConfigMap{}
+	err = k8s.Get(ctx, types.NamespacedName{Namespace: plunderMachine.Namespace, Name: name}, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	create := apierrors.IsNotFound(err)
+	if create {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       plunderMachine.Namespace,
+				OwnerReferences: []metav1.OwnerReference{machineOwnerRef(plunderMachine)},
+			},
+		}
+		if cluster, ok := plunderMachine.Labels[clusterv1.MachineClusterLabelName]; ok {
+			cm.Labels = map[string]string{clusterv1.MachineClusterLabelName: cluster}
+		}
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+
+	// Each capture gets the next sequence number so that the oldest can be found
+	seq := 0
+	for k := range cm.Data {
+		if s := parlayLogSequence(k); s >= seq {
+			seq = s + 1
+		}
+	}
+	key := fmt.Sprintf("%04d-%s.json", seq, capture.Phase)
+	cm.Data[key] = string(data)
+	rotateParlayLogs(cm.Data, key)
+
+	if create {
+		err = k8s.Create(ctx, cm)
+	} else {
+		err = k8s.Update(ctx, cm)
+	}
+	if err != nil {
+		return err
+	}
+
+	plunderMachine.Status.ParlayLogs = &infrav1.ParlayLogsRef{
+		ConfigMapName: name,
+		Latest:        key,
+		LastCaptured:  &capture.Captured,
+	}
+	return nil
+}
+
+// recordParlayLogs - captures the parlay logs of a machine for a phase, a failure to capture them is logged but
+// doesn't hold up provisioning
+func (r *PlunderMachineReconciler) recordParlayLogs(c plunder.Interface, log logr.Logger, plunderMachine *infrav1.PlunderMachine, phase infrav1.MachinePhase) {
+	if err := captureParlayLogs(context.TODO(), r.Client, c, plunderMachine, phase); err != nil {
+		log.Info(fmt.Sprintf("Unable to capture the parlay logs [%v]", err))
+	}
+}
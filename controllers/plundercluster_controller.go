@@ -18,28 +18,64 @@ package controllers
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
 )
 
+const (
+	// endpointRequeue is how long to wait before checking the control plane endpoint again
+	endpointRequeue = 20 * time.Second
+
+	// endpointProbeTimeout is how long to wait for the control plane endpoint to answer
+	endpointProbeTimeout = 5 * time.Second
+
+	// endpointHealthCheck is how often the control plane endpoint of a ready cluster is checked
+	endpointHealthCheck = time.Minute
+)
+
+// The reasons for the EndpointReachable condition
+const (
+	reasonNoEndpoint           = "NoEndpoint"
+	reasonEndpointAnswering    = "Answering"
+	reasonEndpointNotAnswering = "NotAnswering"
+	reasonEndpointUnverified   = "ReadyForBootstrap"
+)
+
 // PlunderClusterReconciler reconciles a PlunderCluster object
 type PlunderClusterReconciler struct {
 	client.Client
 	Log logr.Logger
+
+	// NewPlunderClient creates the client used to talk to a Plunder server, plunder.NewInterface is used for the
+	// default server if it is nil
+	NewPlunderClient func(server string) (plunder.Interface, error)
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderservers,verbs=get;list;watch
 
 // Reconcile - This is called when a resource of plunderCluster is created/modified/delted
 func (r *PlunderClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, rerr error) {
@@ -76,7 +112,7 @@ func (r *PlunderClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 	}
 	// Always attempt to Patch the plunderCluster object and status after each reconciliation.
 	defer func() {
-		if err := patchHelper.Patch(ctx, plunderCluster); err != nil {
+		if err := ignoreRemoved(patchHelper.Patch(ctx, plunderCluster), plunderCluster); err != nil {
 			log.Error(err, "failed to patch infrav1Cluster")
 			if rerr == nil {
 				rerr = err
@@ -96,9 +132,76 @@ func (r *PlunderClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 func (r *PlunderClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.PlunderCluster{}).
+		Watches(&source.Kind{Type: &infrav1.PlunderServer{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.serverToClusters),
+		}).
 		Complete(r)
 }
 
+// serverToClusters - returns the PlunderClusters that are provisioned through a PlunderServer, so that they
+// pick up changes to its condition
+func (r *PlunderClusterReconciler) serverToClusters(o handler.MapObject) []reconcile.Request {
+	clusters := &infrav1.PlunderClusterList{}
+	if err := r.List(context.TODO(), clusters); err != nil {
+		r.Log.Error(err, "unable to list PlunderClusters")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range clusters.Items {
+		if plunderServerName(&clusters.Items[i]) == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: clusters.Items[i].Namespace,
+				Name:      clusters.Items[i].Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// reconcilePlunderReachable - sets the PlunderReachable condition of the cluster from the Plunder server it is
+// provisioned through
+func (r *PlunderClusterReconciler) reconcilePlunderReachable(plunderCluster *infrav1.PlunderCluster) {
+	status, reason, message := plunderReachable(context.TODO(), r.Client, r.NewPlunderClient, plunderServerName(plunderCluster))
+	infrav1.SetCondition(&plunderCluster.Status.Conditions, infrav1.ConditionPlunderReachable, status, reason, message)
+}
+
+// validateCluster - checks the parts of the spec of a cluster that are only used once machines are provisioned, so
+// that mistakes are reported on the cluster
+func validateCluster(plunderCluster *infrav1.PlunderCluster) error {
+	if e := plunderCluster.Spec.ControlPlaneEndpoint; e != nil && e.Type == infrav1.EndpointTypeKubeVIP && net.ParseIP(e.Host) == nil {
+		return fmt.Errorf("The kube-vip endpoint [%s] must be an IP address", e.Host)
+	}
+
+	names := map[string]bool{}
+	for i := range plunderCluster.Spec.FailureDomains {
+		fd := &plunderCluster.Spec.FailureDomains[i]
+		if names[fd.Name] {
+			return fmt.Errorf("The failure domain %s is declared more than once", fd.Name)
+		}
+		names[fd.Name] = true
+		if _, err := failureDomainFilter(plunderCluster, fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setClusterFailure - sets (or with an empty reason, clears) the failure of a cluster
+func setClusterFailure(plunderCluster *infrav1.PlunderCluster, reason capierrors.ClusterStatusError, message string) {
+	if reason == "" {
+		plunderCluster.Status.FailureReason = nil
+		plunderCluster.Status.FailureMessage = nil
+		plunderCluster.Status.ErrorReason = nil
+		plunderCluster.Status.ErrorMessage = nil
+		return
+	}
+	plunderCluster.Status.FailureReason = &reason
+	plunderCluster.Status.FailureMessage = &message
+	plunderCluster.Status.ErrorReason = &reason
+	plunderCluster.Status.ErrorMessage = &message
+}
+
 func (r *PlunderClusterReconciler) reconcileCluster(logger logr.Logger, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (ctrl.Result, error) {
 	logger.Info("Reconciling Cluster")
 
@@ -106,20 +209,107 @@ func (r *PlunderClusterReconciler) reconcileCluster(logger logr.Logger, cluster
 		plunderCluster.Finalizers = append(plunderCluster.Finalizers, infrav1.ClusterFinalizer)
 	}
 
-	// With plunder at the moment there is nothing that can be done throught he server component
+	r.reconcilePlunderReachable(plunderCluster)
 
-	// plunderCluster.Status.APIEndpoints = []infrav1.APIEndpoint{
-	// 	{
-	// 		Host: "192.168.0.1",
-	// 		Port: 6443,
-	// 	},
-	// }
-	// Deploy a new cluster
-	//clusterDeploy(plunderCluster)
+	// A spec that can't be reconciled fails the cluster until it is changed
+	if err := validateCluster(plunderCluster); err != nil {
+		logger.Info(err.Error())
+		setClusterFailure(plunderCluster, capierrors.InvalidConfigurationClusterError, err.Error())
+		return ctrl.Result{}, nil
+	}
+	setClusterFailure(plunderCluster, "", "")
+	plunderCluster.Status.FailureDomains = reportedFailureDomains(plunderCluster)
 
-	plunderCluster.Status.Ready = true
-	return ctrl.Result{}, nil
+	// The endpoint is the one on the PlunderCluster, otherwise it is the first control plane
+	endpoint := specEndpoint(plunderCluster)
+	if endpoint == nil {
+		var err error
+		endpoint, err = initMachineEndpoint(context.TODO(), r.Client, cluster)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if endpoint == nil {
+		if r.waitingForBootstrap(logger, cluster) {
+			// Machines using a bootstrap provider need an endpoint on the Cluster before they can be created
+			logger.Info("A control plane endpoint is needed by the bootstrap provider, set one on the PlunderCluster")
+			setEndpointCondition(plunderCluster, corev1.ConditionFalse, reasonNoEndpoint, "A control plane endpoint is needed by the bootstrap provider, set one on the PlunderCluster")
+		} else {
+			logger.Info("Waiting for a control plane machine to provide the endpoint")
+			setEndpointCondition(plunderCluster, corev1.ConditionFalse, reasonNoEndpoint, "Waiting for a control plane machine to provide the endpoint")
+		}
+		return ctrl.Result{RequeueAfter: endpointRequeue}, nil
+	}
+	plunderCluster.Status.APIEndpoints = []infrav1.APIEndpoint{*endpoint}
 
+	// The kubeconfig for the cluster is kept pointing at the endpoint
+	if err := reconcileKubeconfig(context.TODO(), r.Client, cluster, endpoint); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The endpoint is probed even once the cluster is ready, so that an endpoint that stops answering is reported
+	address := net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+	err := probeEndpoint(address)
+	switch {
+	case err == nil:
+		if !plunderCluster.Status.Ready {
+			logger.Info("The control plane endpoint is answering", "endpoint", address)
+		}
+		plunderCluster.Status.Ready = true
+		setEndpointCondition(plunderCluster, corev1.ConditionTrue, reasonEndpointAnswering, fmt.Sprintf("The control plane endpoint %s is answering", address))
+		return ctrl.Result{RequeueAfter: endpointHealthCheck}, nil
+	case r.waitingForBootstrap(logger, cluster):
+		// The bootstrap provider won't generate any data until the Cluster is ready, so the endpoint can't answer
+		// until the Cluster is marked as ready. The condition records that the endpoint hasn't been checked.
+		if !plunderCluster.Status.Ready {
+			logger.Info("Marking the cluster as ready so that the bootstrap provider can create the control plane", "endpoint", address)
+		}
+		plunderCluster.Status.Ready = true
+		setEndpointCondition(plunderCluster, corev1.ConditionFalse, reasonEndpointUnverified, fmt.Sprintf("The cluster is ready without the control plane endpoint %s answering, so that the bootstrap provider can create the control plane", address))
+	case plunderCluster.Status.Ready:
+		logger.Info("The control plane endpoint has stopped answering", "endpoint", address, "error", err.Error())
+		setEndpointCondition(plunderCluster, corev1.ConditionFalse, reasonEndpointNotAnswering, fmt.Sprintf("The control plane endpoint %s has stopped answering [%v]", address, err))
+	default:
+		logger.Info("Waiting for the control plane endpoint to answer", "endpoint", address, "error", err.Error())
+		setEndpointCondition(plunderCluster, corev1.ConditionFalse, reasonEndpointNotAnswering, fmt.Sprintf("Waiting for the control plane endpoint %s to answer [%v]", address, err))
+	}
+	return ctrl.Result{RequeueAfter: endpointRequeue}, nil
+}
+
+// setEndpointCondition - sets the EndpointReachable condition of a cluster
+func setEndpointCondition(plunderCluster *infrav1.PlunderCluster, status corev1.ConditionStatus, reason, message string) {
+	infrav1.SetCondition(&plunderCluster.Status.Conditions, infrav1.ConditionEndpointReachable, status, reason, message)
+}
+
+// waitingForBootstrap - returns true if the control plane hasn't been initialised and the machines of the cluster
+// are using a bootstrap provider (which waits for the Cluster to be ready)
+func (r *PlunderClusterReconciler) waitingForBootstrap(logger logr.Logger, cluster *clusterv1.Cluster) bool {
+	if cluster.Status.ControlPlaneInitialized {
+		return false
+	}
+	machines := &clusterv1.MachineList{}
+	err := r.Client.List(context.TODO(), machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.MachineClusterLabelName: cluster.Name})
+	if err != nil {
+		logger.Error(err, "Unable to list the machines of the cluster")
+		return false
+	}
+	for i := range machines.Items {
+		if machines.Items[i].Spec.Bootstrap.ConfigRef != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// probeEndpoint - checks that the API server is answering on the endpoint, the certificate isn't verified as it
+// is only the TLS handshake that is of interest
+func probeEndpoint(address string) error {
+	dialer := &net.Dialer{Timeout: endpointProbeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
 
 func (r *PlunderClusterReconciler) reconcileClusterDelete(logger logr.Logger, plunderCluster *infrav1.PlunderCluster) (ctrl.Result, error) {
@@ -0,0 +1,328 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	// hostClaimCheck is how often a claimed host is checked to make sure its PlunderMachine still exists
+	hostClaimCheck = time.Minute
+
+	// hostRecentlySeen is how recently a discovered host must have been seen by the DHCP server to be claimed
+	hostRecentlySeen = 10 * time.Minute
+
+	// hostRecycleCheck is how often a deprovisioned host is checked to see if it has PXE booted again
+	hostRecycleCheck = time.Minute
+)
+
+// PlunderHostReconciler reconciles a PlunderHost object
+type PlunderHostReconciler struct {
+	client.Client
+	Log logr.Logger
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderhosts,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile - This is called when a resource of plunderHost is created/modified/deleted, it will release any
+// claim that has been left behind by a PlunderMachine that no longer exists
+func (r *PlunderHostReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("plunderhost", req.NamespacedName)
+
+	plunderHost := &infrav1.PlunderHost{}
+	if err := r.Get(ctx, req.NamespacedName, plunderHost); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	ref := plunderHost.Spec.ConsumerRef
+	if ref == nil {
+		if plunderHost.Status.State == infrav1.HostStateDeprovisioning {
+			return r.reconcileRecycle(ctx, log, plunderHost)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	plunderMachine := &infrav1.PlunderMachine{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, plunderMachine)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case apierrors.IsNotFound(err), plunderMachine.UID != ref.UID:
+		log.Info(fmt.Sprintf("PlunderMachine %s no longer exists, releasing host", ref.Name))
+	case plunderMachine.Status.HostRef != nil && hostKey(plunderMachine) != (types.NamespacedName{Namespace: plunderHost.Namespace, Name: plunderHost.Name}):
+		log.Info(fmt.Sprintf("PlunderMachine %s is using host %s, releasing host", ref.Name, plunderMachine.Status.HostRef.Name))
+	default:
+		// The claim is still in use, check it again later in case the PlunderMachine goes away
+		return ctrl.Result{RequeueAfter: hostClaimCheck}, nil
+	}
+
+	return ctrl.Result{}, releaseHost(ctx, r.Client, plunderHost.Namespace, plunderHost.Name, ref.UID)
+}
+
+// reconcileRecycle - makes a deprovisioned host available again once the DHCP server has seen it PXE booting,
+// which means its deployment has gone and the wipe finished with a reboot
+func (r *PlunderHostReconciler) reconcileRecycle(ctx context.Context, log logr.Logger, plunderHost *infrav1.PlunderHost) (ctrl.Result, error) {
+	lastUsed := plunderHost.Status.LastUsed
+	lastSeen := plunderHost.Status.LastSeen
+	if lastUsed != nil && (lastSeen == nil || !lastSeen.After(lastUsed.Time)) {
+		return ctrl.Result{RequeueAfter: hostRecycleCheck}, nil
+	}
+
+	log.Info("Host has PXE booted since it was deprovisioned, it is available again")
+	plunderHost.Status.State = infrav1.HostStateAvailable
+	plunderHost.Status.RecycleCount++
+	// A conflict means the host has been updated by discovery, it is checked again with the update
+	if err := r.Update(ctx, plunderHost); err != nil && !apierrors.IsConflict(err) {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager - will add the managment of resources of type PlunderHost
+func (r *PlunderHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.PlunderHost{}).
+		Complete(r)
+}
+
+// hostKey - returns the name and namespace of the PlunderHost claimed by a machine, hosts claimed before the
+// namespace was recorded are in the namespace of the machine
+func hostKey(plunderMachine *infrav1.PlunderMachine) types.NamespacedName {
+	ref := plunderMachine.Status.HostRef
+	if ref.Namespace == "" {
+		return types.NamespacedName{Namespace: plunderMachine.Namespace, Name: ref.Name}
+	}
+	return types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+}
+
+// claimHost - will claim an available PlunderHost that matches the selector and hardware requirements of a
+// PlunderMachine (and are allowed by the filter), the claim is written with the resourceVersion of the host that
+// was read so if another reconciler claims it first the update will conflict and the next host is tried. Hosts
+// are claimed from the namespace of the machine and the namespace discovered hosts are created in (hostNamespace).
+// If no host can be claimed then nil is returned.
+func claimHost(ctx context.Context, c client.Client, plunderMachine *infrav1.PlunderMachine, hostNamespace string, filter func(*infrav1.PlunderHost) bool) (*infrav1.PlunderHost, error) {
+	selector := labels.Everything()
+	if plunderMachine.Spec.HostSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(plunderMachine.Spec.HostSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hostSelector [%v]", err)
+		}
+	}
+
+	hosts := &infrav1.PlunderHostList{}
+	if err := c.List(ctx, hosts, client.InNamespace(plunderMachine.Namespace)); err != nil {
+		return nil, err
+	}
+	if hostNamespace != "" && hostNamespace != plunderMachine.Namespace {
+		discovered := &infrav1.PlunderHostList{}
+		if err := c.List(ctx, discovered, client.InNamespace(hostNamespace)); err != nil {
+			return nil, err
+		}
+		hosts.Items = append(hosts.Items, discovered.Items...)
+	}
+
+	var candidates []*infrav1.PlunderHost
+	for i := range hosts.Items {
+		host := &hosts.Items[i]
+		// A previous reconcile may have claimed a host without recording it on the machine
+		if host.Spec.ConsumerRef != nil && host.Spec.ConsumerRef.UID == plunderMachine.UID {
+			return host, nil
+		}
+		if hostAvailable(host) && filter(host) && selector.Matches(labels.Set(host.Labels)) && hostMeetsRequirements(host, plunderMachine.Spec.HardwareRequirements) {
+			candidates = append(candidates, host)
+		}
+	}
+
+	// Try the hosts that have been seen most recently first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Status.LastSeen == nil {
+			return false
+		}
+		if candidates[j].Status.LastSeen == nil {
+			return true
+		}
+		return candidates[j].Status.LastSeen.Before(candidates[i].Status.LastSeen)
+	})
+
+	for _, host := range candidates {
+		host.Spec.ConsumerRef = &corev1.ObjectReference{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "PlunderMachine",
+			Namespace:  plunderMachine.Namespace,
+			Name:       plunderMachine.Name,
+			UID:        plunderMachine.UID,
+		}
+		host.Status.State = infrav1.HostStateClaimed
+
+		err := c.Update(ctx, host)
+		if apierrors.IsConflict(err) {
+			// Another reconciler got there first
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return host, nil
+	}
+	return nil, nil
+}
+
+// hostAvailable - returns true if a host is free to be claimed, hosts that were discovered by the DHCP server
+// need to have been seen recently (powered off hosts will stop asking for a lease) unless they have a BMC that
+// can power them on
+func hostAvailable(host *infrav1.PlunderHost) bool {
+	if host.Spec.ConsumerRef != nil {
+		return false
+	}
+	if host.Status.State != infrav1.HostStateAvailable && host.Status.State != "" {
+		return false
+	}
+	if !hostHasBMC(host) && host.Status.LastSeen != nil && time.Since(host.Status.LastSeen.Time) > hostRecentlySeen {
+		return false
+	}
+	return true
+}
+
+// hostMeetsRequirements - returns true if the hardware of a host is at least what has been requested, a host
+// with no hardware details can only meet empty requirements
+func hostMeetsRequirements(host *infrav1.PlunderHost, req *infrav1.HardwareRequirements) bool {
+	if req == nil || *req == (infrav1.HardwareRequirements{}) {
+		return true
+	}
+	hw := host.Spec.Hardware
+	if hw == nil {
+		return false
+	}
+	if hw.CPUCores < req.MinCPUCores || hw.MemoryMiB < req.MinMemoryMiB || int32(len(hw.NICs)) < req.MinNICs {
+		return false
+	}
+	if req.MinDiskSizeGiB > 0 {
+		for i := range hw.Disks {
+			if hw.Disks[i].SizeGiB >= req.MinDiskSizeGiB {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// setHostState - updates the state of a PlunderHost, as long as it is still claimed by the consumer
+func setHostState(ctx context.Context, c client.Client, namespace, name string, consumer types.UID, state infrav1.HostState) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		host := &infrav1.PlunderHost{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, host); err != nil {
+			return err
+		}
+		if host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != consumer {
+			return fmt.Errorf("Host %s is not claimed by this machine", name)
+		}
+		if host.Status.State == state {
+			return nil
+		}
+		host.Status.State = state
+		return c.Update(ctx, host)
+	})
+}
+
+// recycleHost - removes the claim of a PlunderMachine that has been deleted from its PlunderHost. If the host has
+// been wiped and rebooted (awaitBoot) then it is left Deprovisioning until it is seen PXE booting, hosts that
+// weren't discovered from the DHCP server are made available straight away as they'll never be seen.
+func recycleHost(ctx context.Context, c client.Client, namespace, name string, consumer types.UID, awaitBoot bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		host := &infrav1.PlunderHost{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, host); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != consumer {
+			return nil
+		}
+		now := metav1.Now()
+		host.Spec.ConsumerRef = nil
+		host.Status.LastUsed = &now
+		if _, discovered := host.Labels[infrav1.HostDiscoveredLabel]; awaitBoot && discovered {
+			host.Status.State = infrav1.HostStateDeprovisioning
+		} else {
+			host.Status.State = infrav1.HostStateAvailable
+			host.Status.RecycleCount++
+		}
+		return c.Update(ctx, host)
+	})
+}
+
+// orphanHost - removes the claim on a PlunderHost but leaves it Orphaned, so that it isn't claimed again until
+// it has been checked by hand
+func orphanHost(ctx context.Context, c client.Client, namespace, name string, consumer types.UID) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		host := &infrav1.PlunderHost{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, host); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != consumer {
+			return nil
+		}
+		host.Spec.ConsumerRef = nil
+		host.Status.State = infrav1.HostStateOrphaned
+		return c.Update(ctx, host)
+	})
+}
+
+// releaseHost - removes the claim on a PlunderHost and makes it available again, if the host has already been
+// claimed by something else then it is left alone
+func releaseHost(ctx context.Context, c client.Client, namespace, name string, consumer types.UID) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		host := &infrav1.PlunderHost{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, host); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != consumer {
+			return nil
+		}
+		host.Spec.ConsumerRef = nil
+		host.Status.State = infrav1.HostStateAvailable
+		return c.Update(ctx, host)
+	})
+}
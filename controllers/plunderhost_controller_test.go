@@ -0,0 +1,153 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// claimFirst - makes another machine claim host-0 just before the machine being tested writes to it
+func (m *machineTest) claimFirst() {
+	m.k8s.race("PlunderHost", func() {
+		host := m.host()
+		host.Spec.ConsumerRef = &corev1.ObjectReference{Kind: "PlunderMachine", Namespace: testNamespace, Name: "other", UID: "other-uid"}
+		host.Status.State = infrav1.HostStateClaimed
+		if err := m.k8s.Update(context.TODO(), host); err != nil {
+			m.t.Fatal(err)
+		}
+	})
+}
+
+func TestClaimHostConflict(t *testing.T) {
+	m := newMachineTest(t, nil)
+	spare := &infrav1.PlunderHost{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "host-1"},
+		Spec:       infrav1.PlunderHostSpec{MACAddress: "00:50:56:a5:b5:f2"},
+	}
+	if err := m.k8s.store(spare); err != nil {
+		t.Fatal(err)
+	}
+
+	// The claim of host-0 is written with the resourceVersion that was listed, so it conflicts with the other
+	// claim and the next host is claimed instead
+	m.claimFirst()
+	m.reconcile()
+	pm := m.machine()
+	if pm.Status.HostRef == nil || pm.Status.HostRef.Name != "host-1" || pm.Status.MACAddress != spare.Spec.MACAddress {
+		t.Fatalf("expected host-1 to be claimed, got %+v", pm.Status.HostRef)
+	}
+	if host := m.host(); host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != "other-uid" {
+		t.Errorf("the other claim of host-0 was overwritten: %+v", host.Spec.ConsumerRef)
+	}
+}
+
+func TestClaimHostConflictNoneLeft(t *testing.T) {
+	m := newMachineTest(t, nil)
+
+	// Losing the only host leaves the machine waiting for another one
+	m.claimFirst()
+	result := m.reconcile()
+	pm := m.machine()
+	if pm.Status.Phase != infrav1.MachinePhasePending || pm.Status.HostRef != nil {
+		t.Fatalf("expected the machine to stay %s without a host, got %s %+v", phaseName(infrav1.MachinePhasePending), phaseName(pm.Status.Phase), pm.Status.HostRef)
+	}
+	if status, reason := m.condition(infrav1.ConditionHostClaimed); status != corev1.ConditionFalse || reason != reasonNoHostAvailable {
+		t.Errorf("expected HostClaimed to be False (%s), got %s (%s)", reasonNoHostAvailable, status, reason)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("the claim wasn't retried")
+	}
+	if host := m.host(); host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != "other-uid" {
+		t.Errorf("the other claim of host-0 was overwritten: %+v", host.Spec.ConsumerRef)
+	}
+}
+
+// discoveredHost - returns host-0 from the namespace discovered hosts are created in
+func (m *machineTest) discoveredHost() *infrav1.PlunderHost {
+	m.t.Helper()
+	host := &infrav1.PlunderHost{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: "hosts", Name: "host-0"}, host); err != nil {
+		m.t.Fatal(err)
+	}
+	return host
+}
+
+func TestClaimHostNamespace(t *testing.T) {
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		host.Namespace = "hosts"
+	})
+
+	// Hosts in the discovery namespace can't be claimed unless the controller is told about it
+	m.reconcile()
+	if pm := m.machine(); pm.Status.HostRef != nil {
+		t.Fatalf("a host outside the namespace of the machine was claimed without a host namespace: %+v", pm.Status.HostRef)
+	}
+
+	m.r.HostNamespace = "hosts"
+	m.reconcileUntil(infrav1.MachinePhaseReady)
+	if ref := m.machine().Status.HostRef; ref == nil || ref.Namespace != "hosts" || ref.Name != "host-0" {
+		t.Fatalf("expected host-0 to be claimed from the hosts namespace, got %+v", ref)
+	}
+	if host := m.discoveredHost(); host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.Namespace != testNamespace || host.Status.State != infrav1.HostStateProvisioned {
+		t.Fatalf("host-0 wasn't claimed by the machine: %s %+v", host.Status.State, host.Spec.ConsumerRef)
+	}
+
+	// The host is found in its own namespace when the machine is removed
+	m.plunder.AutoComplete = false
+	if err := m.k8s.Delete(context.TODO(), m.machine()); err != nil {
+		t.Fatal(err)
+	}
+	m.reconcile()
+	m.plunder.SetParlayState(testMachineIP, "Completed")
+	m.reconcile()
+	if !m.removed() {
+		t.Fatal("the machine wasn't removed once its host was cleaned")
+	}
+	if host := m.discoveredHost(); host.Spec.ConsumerRef != nil || host.Status.State != infrav1.HostStateAvailable {
+		t.Errorf("host-0 wasn't made available: %s %+v", host.Status.State, host.Spec.ConsumerRef)
+	}
+}
+
+func TestClaimHostNamespaceReserved(t *testing.T) {
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		host.Namespace = "hosts"
+	})
+	m.r.HostNamespace = "hosts"
+
+	// A control plane in another namespace has reserved the shared host
+	reserving := &infrav1.PlunderMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "control-plane"},
+		Spec:       infrav1.PlunderMachineSpec{ControlPlaneMacPool: []string{testMachineMAC}},
+	}
+	if err := m.k8s.store(reserving); err != nil {
+		t.Fatal(err)
+	}
+	m.reconcile()
+	if pm := m.machine(); pm.Status.HostRef != nil {
+		t.Fatalf("a host reserved by a ControlPlaneMacPool in another namespace was claimed: %+v", pm.Status.HostRef)
+	}
+	if host := m.discoveredHost(); host.Spec.ConsumerRef != nil {
+		t.Errorf("host-0 was claimed: %+v", host.Spec.ConsumerRef)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/ipam"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// ipAllocationCheck is how often a pool is checked for allocations whose PlunderMachine has gone
+const ipAllocationCheck = time.Minute
+
+// PlunderIPPoolReconciler reconciles a PlunderIPPool object
+type PlunderIPPoolReconciler struct {
+	client.Client
+	Log logr.Logger
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderippools,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile - This is called when a resource of plunderIPPool is created/modified/deleted, it will release any
+// address that is still allocated to a PlunderMachine that no longer exists
+func (r *PlunderIPPoolReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("plunderippool", req.NamespacedName)
+
+	pool := &infrav1.PlunderIPPool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	for _, allocation := range pool.Status.Allocations {
+		plunderMachine := &infrav1.PlunderMachine{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: pool.Namespace, Name: allocation.MachineName}, plunderMachine)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if err == nil && plunderMachine.UID == allocation.MachineUID {
+			continue
+		}
+		log.Info(fmt.Sprintf("PlunderMachine %s no longer exists, releasing %s", allocation.MachineName, allocation.Address))
+		if err := releaseAddress(ctx, r.Client, pool.Namespace, pool.Name, allocation.MachineUID); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(pool.Status.Allocations) != 0 {
+		return ctrl.Result{RequeueAfter: ipAllocationCheck}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager - will add the managment of resources of type PlunderIPPool
+func (r *PlunderIPPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.PlunderIPPool{}).
+		Complete(r)
+}
+
+// ipPoolRef - returns the pool a machine should be given an address from, a pool on the machine takes priority
+// over the pool of the cluster
+func ipPoolRef(plunderMachine *infrav1.PlunderMachine, plunderCluster *infrav1.PlunderCluster) *corev1.LocalObjectReference {
+	if plunderMachine.Spec.IPPoolRef != nil {
+		return plunderMachine.Spec.IPPoolRef
+	}
+	return plunderCluster.Spec.IPPoolRef
+}
+
+// addressesInUse - returns the addresses in a namespace that have been set by hand rather than allocated from a
+// pool, the addresses of other PlunderMachines and the control plane endpoints of the PlunderClusters
+func addressesInUse(ctx context.Context, c client.Client, namespace string, plunderMachine *infrav1.PlunderMachine) (map[string]bool, error) {
+	inUse := map[string]bool{}
+	add := func(address string) {
+		if ip := net.ParseIP(address); ip != nil {
+			inUse[ip.String()] = true
+		}
+	}
+
+	machines := &infrav1.PlunderMachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range machines.Items {
+		if m := &machines.Items[i]; m.UID != plunderMachine.UID && m.Spec.IPAddress != nil {
+			add(*m.Spec.IPAddress)
+		}
+	}
+
+	clusters := &infrav1.PlunderClusterList{}
+	if err := c.List(ctx, clusters, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range clusters.Items {
+		add(clusters.Items[i].Spec.StaticIP)
+		if e := clusters.Items[i].Spec.ControlPlaneEndpoint; e != nil {
+			add(e.Host)
+		}
+	}
+	return inUse, nil
+}
+
+// allocateAddress - allocates an address from a PlunderIPPool to a PlunderMachine, the allocation is written with
+// the resourceVersion of the pool that was read so two machines can't be given the same address. Addresses set by
+// hand on PlunderMachines and PlunderClusters aren't allocated either. If the machine already has an allocation in
+// the pool then that address is returned.
+func allocateAddress(ctx context.Context, c client.Client, namespace, poolName string, plunderMachine *infrav1.PlunderMachine) (string, error) {
+	var address string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pool := &infrav1.PlunderIPPool{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: poolName}, pool); err != nil {
+			return err
+		}
+
+		inUse, err := addressesInUse(ctx, c, namespace, plunderMachine)
+		if err != nil {
+			return err
+		}
+		for _, allocation := range pool.Status.Allocations {
+			if allocation.MachineUID == plunderMachine.UID {
+				address = allocation.Address
+				return nil
+			}
+			inUse[allocation.Address] = true
+		}
+
+		exclusions := pool.Spec.Exclusions
+		if pool.Spec.Gateway != "" {
+			exclusions = append(append([]string{}, exclusions...), pool.Spec.Gateway)
+		}
+		ranges := make([]ipam.Range, 0, len(pool.Spec.Ranges))
+		for _, r := range pool.Spec.Ranges {
+			ranges = append(ranges, ipam.Range{Start: r.Start, End: r.End})
+		}
+
+		p, err := ipam.NewPool(pool.Spec.CIDR, ranges, exclusions)
+		if err != nil {
+			return err
+		}
+		next, err := p.Next(inUse)
+		if err != nil {
+			return err
+		}
+
+		pool.Status.Allocations = append(pool.Status.Allocations, infrav1.IPAllocation{
+			Address:     next,
+			MachineName: plunderMachine.Name,
+			MachineUID:  plunderMachine.UID,
+		})
+		if err := c.Update(ctx, pool); err != nil {
+			return err
+		}
+		address = next
+		return nil
+	})
+	return address, err
+}
+
+// releaseAddress - removes the allocation a PlunderMachine has in a PlunderIPPool
+func releaseAddress(ctx context.Context, c client.Client, namespace, poolName string, machineUID types.UID) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pool := &infrav1.PlunderIPPool{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: poolName}, pool); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		allocations := pool.Status.Allocations[:0]
+		for _, allocation := range pool.Status.Allocations {
+			if allocation.MachineUID != machineUID {
+				allocations = append(allocations, allocation)
+			}
+		}
+		if len(allocations) == len(pool.Status.Allocations) {
+			return nil
+		}
+		pool.Status.Allocations = allocations
+		return c.Update(ctx, pool)
+	})
+}
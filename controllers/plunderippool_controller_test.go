@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// newPoolTest - returns a machine without an address that is given one from the pool
+func newPoolTest(t *testing.T, spec infrav1.PlunderIPPoolSpec) *machineTest {
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		pm.Spec.IPAddress = nil
+		pm.Spec.IPPoolRef = &corev1.LocalObjectReference{Name: "pool"}
+	})
+	pool := &infrav1.PlunderIPPool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "pool"},
+		Spec:       spec,
+	}
+	if err := m.k8s.store(pool); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// pool - returns the PlunderIPPool as it is stored in the API server
+func (m *machineTest) pool() *infrav1.PlunderIPPool {
+	m.t.Helper()
+	pool := &infrav1.PlunderIPPool{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "pool"}, pool); err != nil {
+		m.t.Fatal(err)
+	}
+	return pool
+}
+
+func TestAllocateAddressConflict(t *testing.T) {
+	m := newPoolTest(t, infrav1.PlunderIPPoolSpec{CIDR: "192.168.1.0/29"})
+
+	// Another machine is given the first address just before this machine's allocation is written, the
+	// allocation conflicts and is made again from the pool as it is now
+	m.k8s.race("PlunderIPPool", func() {
+		pool := m.pool()
+		pool.Status.Allocations = append(pool.Status.Allocations, infrav1.IPAllocation{Address: "192.168.1.1", MachineName: "other", MachineUID: "other-uid"})
+		if err := m.k8s.Update(context.TODO(), pool); err != nil {
+			t.Fatal(err)
+		}
+	})
+	m.reconcile()
+
+	pm := m.machine()
+	if pm.Spec.IPAddress == nil || *pm.Spec.IPAddress != "192.168.1.2" {
+		t.Fatalf("expected 192.168.1.2 to be allocated, got %v", pm.Spec.IPAddress)
+	}
+	if pm.Status.IPClaim == nil || pm.Status.IPClaim.PoolName != "pool" || pm.Status.IPClaim.Address != "192.168.1.2" {
+		t.Errorf("the allocation wasn't recorded: %+v", pm.Status.IPClaim)
+	}
+	allocations := m.pool().Status.Allocations
+	if len(allocations) != 2 || allocations[0].Address != "192.168.1.1" || allocations[1].Address != "192.168.1.2" || allocations[1].MachineUID != pm.UID {
+		t.Errorf("expected both allocations to be kept, got %+v", allocations)
+	}
+}
+
+func TestAllocateAddressInUse(t *testing.T) {
+	m := newPoolTest(t, infrav1.PlunderIPPoolSpec{CIDR: "192.168.1.0/29"})
+
+	// The first addresses of the pool have been set by hand, on a machine and as control plane endpoints
+	m.addMachine(1, "192.168.1.1", "00:50:56:a5:b5:f2", false)
+	plunderCluster := &infrav1.PlunderCluster{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "cluster"}, plunderCluster); err != nil {
+		t.Fatal(err)
+	}
+	plunderCluster.Spec.StaticIP = "192.168.1.2"
+	if err := m.k8s.Update(context.TODO(), plunderCluster); err != nil {
+		t.Fatal(err)
+	}
+	other := &infrav1.PlunderCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "other"},
+		Spec:       infrav1.PlunderClusterSpec{ControlPlaneEndpoint: &infrav1.ControlPlaneEndpoint{Host: "192.168.1.3"}},
+	}
+	if err := m.k8s.store(other); err != nil {
+		t.Fatal(err)
+	}
+	m.reconcile()
+
+	if pm := m.machine(); pm.Spec.IPAddress == nil || *pm.Spec.IPAddress != "192.168.1.4" {
+		t.Fatalf("expected 192.168.1.4 to be allocated, got %v", pm.Spec.IPAddress)
+	}
+}
@@ -15,35 +15,88 @@ package controllers
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"time"
 
+	"github.com/plunder-app/cluster-api-plunder/pkg/ipam"
 	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/cluster-api-plunder/pkg/power"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
 )
 
+const (
+	// osProvisionRequeue is how long to wait between checks that the Operating System has been provisioned
+	osProvisionRequeue = 15 * time.Second
+
+	// kubernetesInstallRequeue is how long to wait between checks of the Kubernetes installation
+	kubernetesInstallRequeue = 10 * time.Second
+
+	// hostClaimRequeue is how long to wait before looking for a free PlunderHost again
+	hostClaimRequeue = 30 * time.Second
+
+	// bootstrapDataRequeue is how long to wait before checking if the bootstrap data has been generated
+	bootstrapDataRequeue = 10 * time.Second
+
+	// controlPlaneInitRequeue is how long to wait before checking if the control plane has been initialised
+	controlPlaneInitRequeue = 20 * time.Second
+
+	// ipAllocationRequeue is how long to wait before trying to allocate from an exhausted PlunderIPPool again
+	ipAllocationRequeue = 30 * time.Second
+
+	// failedActionOutputLimit is how much of the output of a failed parlay action is kept in the status
+	failedActionOutputLimit = 4096
+
+	// failedActionEventLimit is how much of the output of a failed parlay action is put in an event
+	failedActionEventLimit = 512
+)
+
 // PlunderMachineReconciler reconciles a PlunderMachine object
 type PlunderMachineReconciler struct {
 	client.Client
 	Log      logr.Logger
 	Recorder record.EventRecorder
+
+	// NewPlunderClient creates the client used to talk to a Plunder server, plunder.NewInterface is used for the
+	// default server if it is nil
+	NewPlunderClient func(server string) (plunder.Interface, error)
+
+	// Timeouts are how long each phase of provisioning can take, for machines that don't set their own
+	Timeouts PhaseTimeouts
+
+	// NewWorkloadClient creates the client used to drain and remove the nodes of a workload cluster, the
+	// <cluster>-kubeconfig Secret is used if it is nil
+	NewWorkloadClient func(c client.Client, cluster *clusterv1.Cluster) (typedcorev1.CoreV1Interface, error)
+
+	// NewPowerClient creates the power management for the BMC of a host, power.New is used if it is nil
+	NewPowerClient func(address string, creds power.Credentials, insecure bool) (power.Interface, error)
+
+	// HostNamespace is the namespace that host discovery creates PlunderHosts in, machines claim hosts from it
+	// as well as from their own namespace
+	HostNamespace string
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plundermachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plundermachines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderhosts,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;machines;machines/status,verbs=get;list;watch
-// +kubebuilder:rbac:groups="",resources=events;secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=events;secrets;configmaps,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile - This is called when a resource of plunderMachine is created/modified/delted
 func (r *PlunderMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, rerr error) {
@@ -52,16 +105,10 @@ func (r *PlunderMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 
 	// your Plunder Machine logic begins here
 
-	// Generate a new Plunder client
-	c, err := plunder.NewClient()
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-
 	// Fetch the inceptionmachine instance.
 	plunderMachine := &infrav1.PlunderMachine{}
 
-	err = r.Get(ctx, req.NamespacedName, plunderMachine)
+	err := r.Get(ctx, req.NamespacedName, plunderMachine)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			return ctrl.Result{}, nil
@@ -112,7 +159,7 @@ func (r *PlunderMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 	}
 	// Always attempt to Patch the PlunderMachine object and status after each reconciliation.
 	defer func() {
-		if err := patchHelper.Patch(ctx, plunderMachine); err != nil {
+		if err := ignoreRemoved(patchHelper.Patch(ctx, plunderMachine), plunderMachine); err != nil {
 			log.Error(err, "failed to patch PlunderMachine")
 			if rerr == nil {
 				rerr = err
@@ -120,23 +167,61 @@ func (r *PlunderMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 		}
 	}()
 
-	// Handle deleted clusters
+	// Generate a new Plunder client for the server the machine is provisioned through, if one can't be created
+	// then the reason is recorded in the PlunderReachable condition
+	server := machineServerName(plunderMachine, plunderCluster)
+	c, clientErr := newPlunderClient(r.NewPlunderClient, server)
+	if clientErr != nil {
+		status, reason, message := plunderCondition(clientErr)
+		infrav1.SetCondition(&plunderMachine.Status.Conditions, infrav1.ConditionPlunderReachable, status, reason, message)
+		log.Info(fmt.Sprintf("Unable to create a client for the Plunder server [%v]", clientErr))
+	} else {
+		status, reason, message := plunderReachable(ctx, r.Client, r.NewPlunderClient, server)
+		infrav1.SetCondition(&plunderMachine.Status.Conditions, infrav1.ConditionPlunderReachable, status, reason, message)
+	}
+
+	// Handle deleted clusters, a machine can be force removed (or its deletion retried) without a client
 	if !plunderMachine.DeletionTimestamp.IsZero() {
-		return r.reconcileMachineDelete(c, log, machine, plunderMachine, cluster, plunderCluster)
+		return r.reconcileMachineDelete(c, clientErr, log, machine, plunderMachine, cluster, plunderCluster)
+	}
+	if clientErr != nil {
+		return ctrl.Result{}, clientErr
 	}
 
 	// Handle non-deleted clusters
-	return r.reconcileMachine(c, log, machine, plunderMachine, cluster, plunderCluster)
+	return r.reconcileMachine(c, log, patchHelper, machine, plunderMachine, cluster, plunderCluster)
+}
+
+// newPlunderClient - creates a client for a Plunder server with the constructor, if there isn't a constructor
+// then plunder.NewInterface is used for the default server
+func newPlunderClient(constructor func(string) (plunder.Interface, error), server string) (plunder.Interface, error) {
+	if constructor != nil {
+		return constructor(server)
+	}
+	if server != "" {
+		return nil, fmt.Errorf("Unable to connect to Plunder server [%s] without a client constructor", server)
+	}
+	return plunder.NewInterface()
+}
+
+// plunderServerName - returns the name of the PlunderServer a cluster is provisioned through, an empty name is
+// the default server
+func plunderServerName(plunderCluster *infrav1.PlunderCluster) string {
+	if plunderCluster.Spec.PlunderServerRef == nil {
+		return ""
+	}
+	return plunderCluster.Spec.PlunderServerRef.Name
 }
 
 // SetupWithManager - will add the managment of resources of type PlunderMachine
-func (r *PlunderMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+func (r *PlunderMachineReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.PlunderMachine{}).
+		WithOptions(options).
 		Complete(r)
 }
 
-func (r *PlunderMachineReconciler) reconcileMachine(c *plunder.Client, log logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (_ ctrl.Result, reterr error) {
+func (r *PlunderMachineReconciler) reconcileMachine(c plunder.Interface, log logr.Logger, patchHelper *patch.Helper, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (_ ctrl.Result, reterr error) {
 	log.Info("Reconciling Machine")
 	// If the DockerMachine doesn't have finalizer, add it.
 	if !util.Contains(plunderMachine.Finalizers, infrav1.MachineFinalizer) {
@@ -146,64 +231,377 @@ func (r *PlunderMachineReconciler) reconcileMachine(c *plunder.Client, log logr.
 	// if the machine is already provisioned, return
 	if plunderMachine.Spec.ProviderID != nil {
 		plunderMachine.Status.Ready = true
-
+		if plunderMachine.Status.Phase != infrav1.MachinePhaseReady {
+			setMachinePhase(plunderMachine, infrav1.MachinePhaseReady)
+		}
+		setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionTrue, reasonInstalled, "The machine has joined the cluster")
 		return ctrl.Result{}, nil
 	}
 
-	// Make sure bootstrap data is available and populated, may be needed in the future (bootstrap is included in machine Controlelr)
-	if machine.Spec.Bootstrap.Data == nil {
-		log.Info("The Plunder Provider currently doesn't require bootstrap data")
+	// A phase that has taken too long fails the machine, rather than waiting on the Plunder server forever
+	if timeout, elapsed := phaseTimeout(plunderMachine, r.Timeouts); timeout != 0 && elapsed > timeout {
+		message := fmt.Sprintf("The %s phase didn't complete within %s", phaseName(plunderMachine.Status.Phase), timeout)
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "ProvisioningTimeout", message)
+		log.Info(message)
+		if plunderMachine.Status.Phase == infrav1.MachinePhaseOSDeploying || plunderMachine.Status.Phase == infrav1.MachinePhaseKubernetesInstalling {
+			r.recordParlayLogs(c, log, plunderMachine, plunderMachine.Status.Phase)
+		}
+		if t := phaseCondition(plunderMachine.Status.Phase); t != "" {
+			setMachineCondition(plunderMachine, t, corev1.ConditionFalse, reasonTimedOut, "%s", message)
+		}
+		setMachineFailure(plunderMachine, capierrors.CreateMachineError, "%s", message)
+		return ctrl.Result{}, nil
 	}
 
-	installMAC, err := c.FindMachine()
-	if err != nil {
-		return ctrl.Result{}, err
+	// Bootstrap data is only needed when Kubernetes is installed with cloud-init, it is checked before
+	// Kubernetes is installed as the bootstrap provider may not have generated it yet
+	if plunderMachine.Spec.BootstrapMode == "" {
+		plunderMachine.Spec.BootstrapMode = infrav1.BootstrapModeParlay
 	}
-
-	// Hopefully we found an unleased server!
-	if installMAC == "" {
-		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "No Hardware found", "Plunder has no available hardware to provision")
-		return ctrl.Result{}, fmt.Errorf("No free hardware for provisioning")
+	if machine.Spec.Bootstrap.Data == nil && plunderMachine.Spec.BootstrapMode == infrav1.BootstrapModeParlay {
+		log.Info("The Plunder Provider doesn't require bootstrap data in Parlay mode")
 	}
 
-	log.Info(fmt.Sprintf("Found Hardware %s", installMAC))
-
 	// If the deployment type is left blank then we default to the provider default
 	if plunderMachine.Spec.DeploymentType == nil {
 		deploymentType := infrav1.DeploymentDefault
 		plunderMachine.Spec.DeploymentType = &deploymentType
 	}
 
-	// If the IP address is blank we (error for now)
+	// If the IP address is blank then allocate one from the pool of the machine (or cluster)
 	if plunderMachine.Spec.IPAddress == nil {
-		return ctrl.Result{}, fmt.Errorf("An IP Adress is required to provision at this time")
-		// TODO (EPIC) implement IPAM
+		poolRef := ipPoolRef(plunderMachine, plunderCluster)
+		if poolRef == nil {
+			return ctrl.Result{}, fmt.Errorf("An IP Adress or PlunderIPPool is required to provision at this time")
+		}
+
+		address, err := allocateAddress(context.TODO(), r.Client, plunderMachine.Namespace, poolRef.Name, plunderMachine)
+		if err == ipam.ErrPoolExhausted {
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "IPAllocation", "PlunderIPPool %s has no free addresses", poolRef.Name)
+			return ctrl.Result{RequeueAfter: ipAllocationRequeue}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		log.Info(fmt.Sprintf("Allocated address %s from PlunderIPPool %s", address, poolRef.Name))
+		plunderMachine.Status.IPClaim = &infrav1.IPClaim{PoolName: poolRef.Name, Address: address}
+		plunderMachine.Spec.IPAddress = &address
+	}
+
+	// Each reconcile will move the machine through (at most) one phase of provisioning
+	switch plunderMachine.Status.Phase {
+	case infrav1.MachinePhasePending:
+		return r.reconcileHardwareClaim(c, log, machine, plunderMachine, cluster, plunderCluster)
+	case infrav1.MachinePhaseHardwareClaimed:
+		return r.reconcileOSDeploy(c, log, patchHelper, plunderMachine, plunderCluster)
+	case infrav1.MachinePhaseOSDeploying:
+		return r.reconcileOSDeploying(c, log, plunderMachine)
+	case infrav1.MachinePhaseOSReady:
+		return r.reconcileKubernetesInstall(c, log, patchHelper, machine, plunderMachine, cluster, plunderCluster)
+	case infrav1.MachinePhaseKubernetesInstalling:
+		return r.reconcileKubernetesInstalling(c, log, plunderMachine)
+	case infrav1.MachinePhaseFailed:
+		log.Info("Provisioning of this machine has failed, it will need to be removed")
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileHardwareClaim - finds a free physical host that the machine will be provisioned on
+func (r *PlunderMachineReconciler) reconcileHardwareClaim(c plunder.Interface, log logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (ctrl.Result, error) {
+	// If hardware has already been recorded then re-use it, rather than claiming another host
+	if plunderMachine.Status.MACAddress != "" && plunderMachine.Status.MachineName != "" {
+		log.Info(fmt.Sprintf("Re-using previously claimed Hardware %s", plunderMachine.Status.MACAddress))
+		if plunderMachine.Status.PlunderServer == nil {
+			server := machineServerName(plunderMachine, plunderCluster)
+			plunderMachine.Status.PlunderServer = &server
+		}
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionTrue, reasonClaimed, "Hardware %s has been claimed", plunderMachine.Status.MACAddress)
+		setMachinePhase(plunderMachine, infrav1.MachinePhaseHardwareClaimed)
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	controlPlane := util.IsControlPlaneMachine(machine)
+
+	filter, err := macPoolFilter(context.TODO(), r.Client, plunderMachine, r.HostNamespace, controlPlane)
+	if err != nil {
+		// The pool won't become valid until the spec is changed, which will trigger another reconcile
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidMacPool", err.Error())
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionFalse, reasonInvalidMacPool, "%s", err.Error())
+		log.Info(err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	domains, err := r.placementFailureDomains(machine, plunderMachine, cluster, plunderCluster)
+	if err != nil {
+		// The failure domain won't become valid until the spec is changed, which will trigger another reconcile
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidFailureDomain", err.Error())
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionFalse, reasonInvalidFailureDomain, "%s", err.Error())
+		log.Info(err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	// Each failure domain is tried in turn, only hosts in the failure domain (and provisioned through its Plunder
+	// server) can be claimed
+	var host *infrav1.PlunderHost
+	var fd *infrav1.FailureDomainSpec
+	for _, fd = range domains {
+		inDomain, err := failureDomainFilter(plunderCluster, fd)
+		if err != nil {
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidFailureDomain", err.Error())
+			log.Info(err.Error())
+			continue
+		}
+		host, err = claimHost(context.TODO(), r.Client, plunderMachine, r.HostNamespace, func(host *infrav1.PlunderHost) bool {
+			return inDomain(host) && filter(host)
+		})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if host != nil {
+			break
+		}
+	}
+	if host == nil && controlPlane && len(plunderMachine.Spec.ControlPlaneMacPool) != 0 {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "No Hardware found", "All hosts in the ControlPlaneMacPool are in use or unavailable")
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionFalse, reasonNoHostAvailable, "All hosts in the ControlPlaneMacPool are in use or unavailable")
+		log.Info("The ControlPlaneMacPool is exhausted")
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, hostClaimRequeue)}, nil
+	}
+	if host == nil && machineFailureDomain(plunderMachine) != "" {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "No Hardware found", "Plunder has no available hardware in failure domain %s that matches the hostSelector and hardwareRequirements", machineFailureDomain(plunderMachine))
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionFalse, reasonNoHostAvailable, "There is no available hardware in failure domain %s that matches the hostSelector and hardwareRequirements", machineFailureDomain(plunderMachine))
+		log.Info(fmt.Sprintf("No matching PlunderHosts are available to claim in failure domain %s", machineFailureDomain(plunderMachine)))
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, hostClaimRequeue)}, nil
+	}
+	if host == nil {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "No Hardware found", "Plunder has no available hardware that matches the hostSelector and hardwareRequirements")
+		setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionFalse, reasonNoHostAvailable, "There is no available hardware that matches the hostSelector and hardwareRequirements")
+		log.Info("No matching PlunderHosts are available to claim")
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, hostClaimRequeue)}, nil
 	}
+	installMAC := host.Spec.MACAddress
+
+	log.Info(fmt.Sprintf("Claimed Hardware %s (%s)", installMAC, host.Name))
 
 	//Check the role of the machine
-	if util.IsControlPlaneMachine(machine) {
+	if controlPlane {
 		log.Info(fmt.Sprintf("Provisioning Control plane node %s", machine.Name))
-		plunderMachine.Status.MachineName = fmt.Sprintf("%s-%s", machine.Name, StringWithCharset(5, charset))
-
 	} else {
 		log.Info(fmt.Sprintf("Provisioning Worker node %s", machine.Name))
-		plunderMachine.Status.MachineName = fmt.Sprintf("%s-%s", machine.Name, StringWithCharset(5, charset))
+	}
+	plunderMachine.Status.MachineName = fmt.Sprintf("%s-%s", machine.Name, StringWithCharset(5, charset))
+	plunderMachine.Status.MACAddress = installMAC
+	plunderMachine.Status.HostRef = &corev1.ObjectReference{Kind: "PlunderHost", Namespace: host.Namespace, Name: host.Name}
+	server := failureDomainServer(plunderCluster, fd)
+	plunderMachine.Status.PlunderServer = &server
+	if fd != nil {
+		log.Info(fmt.Sprintf("Placed in failure domain %s", fd.Name))
+		plunderMachine.Status.FailureDomain = fd.Name
+	}
+	setMachineCondition(plunderMachine, infrav1.ConditionHostClaimed, corev1.ConditionTrue, reasonClaimed, "Hardware %s (%s) has been claimed", installMAC, host.Name)
+
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseHardwareClaimed)
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// placementFailureDomains - returns the failure domains that a machine can be placed in, in the order they should
+// be tried. Control plane machines that haven't requested a failure domain are spread across the control plane
+// failure domains, a nil failure domain places the machine on any host of the cluster's Plunder server.
+func (r *PlunderMachineReconciler) placementFailureDomains(machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) ([]*infrav1.FailureDomainSpec, error) {
+	if name := machineFailureDomain(plunderMachine); name != "" {
+		fd := plunderCluster.Spec.FindFailureDomain(name)
+		if fd == nil {
+			return nil, fmt.Errorf("PlunderCluster %s has no failure domain %s", plunderCluster.Name, name)
+		}
+		return []*infrav1.FailureDomainSpec{fd}, nil
+	}
+
+	if util.IsControlPlaneMachine(machine) {
+		domains, err := controlPlaneFailureDomains(context.TODO(), r.Client, cluster, plunderCluster, plunderMachine)
+		if err != nil {
+			return nil, err
+		}
+		if len(domains) != 0 {
+			return domains, nil
+		}
+	}
+	return []*infrav1.FailureDomainSpec{nil}, nil
+}
+
+// reconcileOSDeploy - creates the Plunder deployment that will install the Operating System on the claimed host
+func (r *PlunderMachineReconciler) reconcileOSDeploy(c plunder.Interface, log logr.Logger, patchHelper *patch.Helper, plunderMachine *infrav1.PlunderMachine, plunderCluster *infrav1.PlunderCluster) (ctrl.Result, error) {
+	// The network configuration is checked before anything is submitted, an invalid configuration won't fix
+	// itself so the machine fails rather than waiting on it
+	network, invalid, err := r.machineNetwork(plunderMachine, plunderCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if invalid != nil {
+		log.Info(fmt.Sprintf("The network configuration is invalid [%v], the machine won't be provisioned", invalid))
+		setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonInvalidNetwork, "The network configuration is invalid [%v]", invalid)
+		setMachineFailure(plunderMachine, capierrors.InvalidConfigurationMachineError, "The network configuration is invalid [%v]", invalid)
+		return ctrl.Result{}, nil
 	}
 
-	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", "Plunder has begun provisioning the Operating System")
+	// Record the deployment before it is submitted, so that if this reconcile is interrupted the next one
+	// will look for it on the Plunder server
+	if plunderMachine.Status.Deployment == nil {
+		plunderMachine.Status.Deployment = &infrav1.PlunderDeployment{
+			MACAddress:     plunderMachine.Status.MACAddress,
+			IPAddress:      *plunderMachine.Spec.IPAddress,
+			Hostname:       plunderMachine.Status.MachineName,
+			DeploymentType: *plunderMachine.Spec.DeploymentType,
+		}
+		if err := persistMachineStatus(patchHelper, plunderMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	d := plunderMachine.Status.Deployment
 
-	err = c.ProvisionMachine(plunderMachine.Status.MachineName, installMAC, *plunderMachine.Spec.IPAddress, *plunderMachine.Spec.DeploymentType)
+	existing, err := c.GetDeployment(d.MACAddress)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	provisioningResult, err := c.ProvisionMachineWait(*plunderMachine.Spec.IPAddress)
+	switch {
+	case existing == nil:
+		server := machineServerName(plunderMachine, plunderCluster)
+		busy, err := serverAtCapacity(context.TODO(), r.Client, server)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if busy {
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderServerBusy", "Plunder server %s is provisioning as many machines as it is allowed to, waiting", server)
+			log.Info(fmt.Sprintf("Plunder server %s is at its limit of concurrent provisions", server))
+			setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonServerBusy, "Plunder server %s is provisioning as many machines as it is allowed to", server)
+			return ctrl.Result{RequeueAfter: serverCapacityRequeue}, nil
+		}
+
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", "Plunder has begun provisioning the Operating System")
+
+		err = c.ProvisionMachine(d.Hostname, d.MACAddress, d.IPAddress, d.DeploymentType, network)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	case existing.ConfigHost.IPAddress == d.IPAddress && existing.ConfigHost.ServerName == d.Hostname:
+		// This deployment was submitted by an earlier reconcile that didn't complete
+		log.Info(fmt.Sprintf("Re-attaching to existing deployment for %s", d.MACAddress))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", "Plunder is already provisioning the Operating System, resuming")
+	default:
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderProvision", "Hardware %s already has a deployment for %s", d.MACAddress, existing.ConfigHost.IPAddress)
+		setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonDeploymentConflict, "Hardware %s already has a deployment for %s", d.MACAddress, existing.ConfigHost.IPAddress)
+		return ctrl.Result{}, fmt.Errorf("Hardware %s already has a deployment on the Plunder server for address %s", d.MACAddress, existing.ConfigHost.IPAddress)
+	}
+	d.Submitted = true
+	r.updateHostState(log, plunderMachine, infrav1.HostStateProvisioning)
+
+	// Remove any stale logs for this address so they aren't mistaken for the result of this deployment
+	c.ParlayLogClear(d.IPAddress)
+
+	setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonDeploying, "Plunder is installing the Operating System")
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseOSDeploying)
+
+	// A host with a BMC is booted into its deployment, rather than waiting for it to PXE boot by itself
+	if d.LastPowerReset == nil {
+		if err := r.powerOnHost(log, plunderMachine); err != nil {
+			return ctrl.Result{RequeueAfter: powerOnRetry}, nil
+		}
+	}
+	return ctrl.Result{RequeueAfter: osProvisionRequeue}, nil
+}
+
+// reconcileOSDeploying - checks if the Operating System has finished installing and the host is reachable
+func (r *PlunderMachineReconciler) reconcileOSDeploying(c plunder.Interface, log logr.Logger, plunderMachine *infrav1.PlunderMachine) (ctrl.Result, error) {
+	// A host that couldn't be powered on won't boot its deployment, so it is powered on again
+	if cond := infrav1.FindCondition(plunderMachine.Status.Conditions, infrav1.ConditionOSProvisioned); cond != nil && cond.Reason == reasonPowerOnFailed {
+		if err := r.powerOnHost(log, plunderMachine); err != nil {
+			return ctrl.Result{RequeueAfter: powerOnRetry}, nil
+		}
+		setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonDeploying, "Plunder is installing the Operating System")
+	}
+
+	complete, err := c.ProvisionMachineStatus(*plunderMachine.Spec.IPAddress)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", *provisioningResult)
-	log.Info(*provisioningResult)
+	if !complete {
+		log.Info("Waiting for the Operating System to be provisioned")
+		r.resetStuckHost(log, plunderMachine)
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, osProvisionRequeue)}, nil
+	}
+
+	r.recordParlayLogs(c, log, plunderMachine, infrav1.MachinePhaseOSDeploying)
+
+	provisioningResult := fmt.Sprintf("Host has been succesfully provisioned OS in %s Seconds", phaseDuration(plunderMachine))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", provisioningResult)
+	log.Info(provisioningResult)
+
+	setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionTrue, reasonProvisioned, "%s", provisioningResult)
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseOSReady)
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// reconcileKubernetesInstall - submits the deployment that will install Kubernetes on the provisioned host
+func (r *PlunderMachineReconciler) reconcileKubernetesInstall(c plunder.Interface, log logr.Logger, patchHelper *patch.Helper, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (ctrl.Result, error) {
+	ipAddress := *plunderMachine.Spec.IPAddress
+
+	// If a previous reconcile recorded the job but didn't finish submitting it, the logs for the host will
+	// only exist if the submission happened (they are removed before the job is recorded)
+	if job := plunderMachine.Status.ParlayJob; job != nil && job.Host == ipAddress && !job.Submitted {
+		state, err := c.ProvisionKubernetesStatus(ipAddress)
+		if err == nil && state != "" {
+			log.Info(fmt.Sprintf("Re-attaching to existing Kubernetes deployment for %s", ipAddress))
+			job.Submitted = true
+			setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInstalling, "Kubernetes is being installed")
+			setMachinePhase(plunderMachine, infrav1.MachinePhaseKubernetesInstalling)
+			return ctrl.Result{RequeueAfter: kubernetesInstallRequeue}, nil
+		}
+	}
+
+	cloudInit := plunderMachine.Spec.BootstrapMode == infrav1.BootstrapModeCloudInit
+	if cloudInit {
+		if machine.Spec.Bootstrap.Data == nil || *machine.Spec.Bootstrap.Data == "" {
+			log.Info("Waiting for the bootstrap provider to generate the bootstrap data")
+			setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonWaitingForBootstrap, "Waiting for the bootstrap provider to generate the bootstrap data")
+			return ctrl.Result{RequeueAfter: bootstrapDataRequeue}, nil
+		}
+		if _, err := base64.StdEncoding.DecodeString(*machine.Spec.Bootstrap.Data); err != nil {
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidBootstrapData", "The bootstrap data isn't base64 encoded [%v]", err)
+			setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInvalidConfiguration, "The bootstrap data isn't base64 encoded [%v]", err)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// In Parlay mode machines that aren't initialising the control plane have to wait until it is ready
+	var initMachine *infrav1.PlunderMachine
+	if !cloudInit {
+		var err error
+		initMachine, err = controlPlaneInitMachine(context.TODO(), r.Client, cluster, plunderMachine, util.IsControlPlaneMachine(machine))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if initMachine == nil || (initMachine.UID != plunderMachine.UID && initMachine.Status.Phase != infrav1.MachinePhaseReady) {
+			log.Info("Waiting for the control plane to be initialised")
+			setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonWaitingForInit, "Waiting for the control plane to be initialised")
+			return ctrl.Result{RequeueAfter: controlPlaneInitRequeue}, nil
+		}
+	}
+
+	// The machine initialising the control plane needs the pod network of the cluster for kubeadm init
+	var podCIDR string
+	if initMachine != nil && initMachine.UID == plunderMachine.UID {
+		var err error
+		podCIDR, err = podNetworkCIDR(cluster)
+		if err != nil {
+			log.Info(err.Error())
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidClusterNetwork", err.Error())
+			setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInvalidConfiguration, "%s", err.Error())
+			return ctrl.Result{RequeueAfter: controlPlaneInitRequeue}, nil
+		}
+	}
 
 	if plunderMachine.Spec.DockerVersion == nil {
 		ver := infrav1.DockerVersionDefault
@@ -215,68 +613,356 @@ func (r *PlunderMachineReconciler) reconcileMachine(c *plunder.Client, log logr.
 		machine.Spec.Version = &ver
 	}
 
-	c.ActionsKubernetes(*plunderMachine.Spec.IPAddress, *machine.Spec.Version, *plunderMachine.Spec.DockerVersion)
+	c.ActionsKubernetes(ipAddress, *machine.Spec.Version, *plunderMachine.Spec.DockerVersion)
 
-	if util.IsControlPlaneMachine(machine) {
-		// Add the kubeadm steps for a control plane
-		err = c.ActionsControlPlane(*machine.Spec.Version, cluster.Spec.ClusterNetwork.Pods.CIDRBlocks[0])
+	// A job that has already been submitted to this host has failed and is being retried, so anything left by
+	// the last attempt is removed before kubeadm is ran again
+	attempt := int32(1)
+	if job := plunderMachine.Status.ParlayJob; job != nil && job.Host == ipAddress {
+		attempt = job.Attempt
+		if job.Submitted {
+			attempt++
+		}
+		if attempt < 1 {
+			attempt = 1
+		}
+	}
+	if attempt > 1 {
+		if err := c.ActionsKubernetesReset(); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// VLANs, bonds and search domains are configured before Kubernetes is installed
+	network, invalid, err := r.machineNetwork(plunderMachine, plunderCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if invalid != nil {
+		log.Info(fmt.Sprintf("The network configuration is invalid [%v], the machine won't be configured", invalid))
+		setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInvalidNetwork, "The network configuration is invalid [%v]", invalid)
+		setMachineFailure(plunderMachine, capierrors.InvalidConfigurationMachineError, "The network configuration is invalid [%v]", invalid)
+		return ctrl.Result{}, nil
+	}
+	if err := c.ActionsNetwork(ipAddress, network); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if cloudInit {
+		// The kubeadm configuration, certificates and join come from the bootstrap data
+		err := c.ActionsCloudInit(plunderMachine.Status.MachineName, string(plunderMachine.UID), *machine.Spec.Bootstrap.Data)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", "Kubernetes Control Plane installation has begun")
-		log.Info("Kubernetes Control Plane installation has begun")
 	} else {
-		// Add the kubeadm steps for a worker machine
-		err = c.ActionsWorker()
+		j, err := joinConfig(context.TODO(), r.Client, cluster, controlPlaneEndpoint(plunderCluster, initMachine))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// kube-vip is only ran on the control plane machines
+		var vip *plunder.KubeVIPConfig
+		if util.IsControlPlaneMachine(machine) {
+			vip, err = kubeVIPConfig(plunderCluster, network)
+			if err != nil {
+				r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidControlPlaneEndpoint", err.Error())
+				setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInvalidConfiguration, "%s", err.Error())
+				return ctrl.Result{}, nil
+			}
+		}
+
+		if initMachine.UID != plunderMachine.UID {
+			if err := newJoinToken(j); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		switch {
+		case initMachine.UID == plunderMachine.UID:
+			// Add the kubeadm steps for the first control plane
+			err = c.ActionsControlPlane(*machine.Spec.Version, podCIDR, j, vip)
+		case util.IsControlPlaneMachine(machine):
+			// Add the kubeadm steps for an additional control plane
+			err = c.ActionsControlPlaneJoin(*initMachine.Spec.IPAddress, j, vip)
+		default:
+			// Add the kubeadm steps for a worker machine
+			err = c.ActionsWorker(*initMachine.Spec.IPAddress, j)
+		}
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", "Kubernetes worker installation has begun")
-		log.Info("Kubernetes worker installation has begun")
 	}
 
-	provisioningResult, err = c.ProvisionKubernetes()
+	// Remove any logs from the Operating System checks, then record the job before it is submitted
+	c.ParlayLogClear(ipAddress)
+
+	now := metav1.Now()
+	plunderMachine.Status.ParlayJob = &infrav1.ParlayJob{
+		Name:          c.DeploymentName(),
+		Host:          ipAddress,
+		SubmittedTime: &now,
+		Attempt:       attempt,
+	}
+	if err := persistMachineStatus(patchHelper, plunderMachine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = c.ProvisionKubernetesStart()
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	plunderMachine.Status.ParlayJob.Submitted = true
 
-	// Report the results of the installation
-	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", *provisioningResult)
-	log.Info(*provisioningResult)
+	if util.IsControlPlaneMachine(machine) {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", "Kubernetes Control Plane installation has begun")
+		log.Info("Kubernetes Control Plane installation has begun")
+	} else {
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", "Kubernetes worker installation has begun")
+		log.Info("Kubernetes worker installation has begun")
+	}
 
-	// TODO - Attempt to create the machine
+	setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInstalling, "Kubernetes is being installed")
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseKubernetesInstalling)
+	return ctrl.Result{RequeueAfter: kubernetesInstallRequeue}, nil
+}
 
-	// // if the machine is a control plane added, update the load balancer configuration
-	// if util.IsControlPlaneMachine(machine) {}
+// reconcileKubernetesInstalling - checks the progress of the Kubernetes installation
+func (r *PlunderMachineReconciler) reconcileKubernetesInstalling(c plunder.Interface, log logr.Logger, plunderMachine *infrav1.PlunderMachine) (ctrl.Result, error) {
+	state, err := c.ProvisionKubernetesStatus(*plunderMachine.Spec.IPAddress)
+	if err != nil {
+		// The logs may not have been created yet, so check again later
+		log.Info(fmt.Sprintf("Unable to retrieve Kubernetes installation logs [%v]", err))
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, kubernetesInstallRequeue)}, nil
+	}
 
-	// DEPLOY THE MACHINE
-	//clusterDeploy(nil)
+	switch state {
+	case "Completed":
+		r.recordParlayLogs(c, log, plunderMachine, infrav1.MachinePhaseKubernetesInstalling)
+		provisioningResult := fmt.Sprintf("Task has been succesfully completed in %s Seconds", phaseDuration(plunderMachine))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderInstall", provisioningResult)
+		log.Info(provisioningResult)
+	case "Failed":
+		return r.reconcileKubernetesInstallFailed(c, log, plunderMachine)
+	default:
+		log.Info("Waiting for the Kubernetes installation to complete")
+		return ctrl.Result{RequeueAfter: pollInterval(plunderMachine, r.Timeouts, kubernetesInstallRequeue)}, nil
+	}
 
-	providerID := fmt.Sprintf("plunder://%s", installMAC)
+	providerID := fmt.Sprintf("plunder://%s", plunderMachine.Status.MACAddress)
 
 	plunderMachine.Spec.ProviderID = &providerID
 	// Mark the inceptionMachine ready
 	plunderMachine.Status.Ready = true
 	// Set the object status
-	plunderMachine.Status.MACAddress = installMAC
 	plunderMachine.Status.IPAdress = *plunderMachine.Spec.IPAddress
+	r.updateHostState(log, plunderMachine, infrav1.HostStateProvisioned)
+	setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionTrue, reasonInstalled, "The machine has joined the cluster")
 
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseReady)
 	return ctrl.Result{}, nil
-
 }
 
-func (r *PlunderMachineReconciler) reconcileMachineDelete(c *plunder.Client, logger logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (_ ctrl.Result, reterr error) {
-	logger.Info(fmt.Sprintf("Deleting Machine %s", plunderMachine.Name))
-	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDelete", "Plunder has begun removing the host")
-	err := c.DeleteMachine(plunderMachine.Status.IPAdress)
+// reconcileKubernetesInstallFailed - records the parlay action that failed, then either submits the installation
+// again or fails the machine once it has run out of retries
+func (r *PlunderMachineReconciler) reconcileKubernetesInstallFailed(c plunder.Interface, log logr.Logger, plunderMachine *infrav1.PlunderMachine) (ctrl.Result, error) {
+	ipAddress := *plunderMachine.Spec.IPAddress
+	r.recordParlayLogs(c, log, plunderMachine, infrav1.MachinePhaseKubernetesInstalling)
+
+	action, output := "unknown", ""
+	failure, err := c.ProvisionKubernetesFailure(ipAddress)
 	if err != nil {
+		log.Info(fmt.Sprintf("Unable to find the failed action in the Kubernetes installation logs [%v]", err))
+	}
+	if failure != nil {
+		action, output = failure.Action, failure.Output
+	}
 
-		plunderMachine.Finalizers = util.Filter(plunderMachine.Finalizers, infrav1.MachineFinalizer)
-		logger.Info(fmt.Sprintf("Removing Machine [%s] from config, it may need removing manually", plunderMachine.Name))
-		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDelete", "Machine removed. Plunder couldn't succesfully remove the physical host, it may need removing manually")
+	job := plunderMachine.Status.ParlayJob
+	if job == nil {
+		job = &infrav1.ParlayJob{Host: ipAddress, Submitted: true}
+		plunderMachine.Status.ParlayJob = job
+	}
+	if job.Attempt < 1 {
+		job.Attempt = 1
+	}
+	job.FailedAction = action
+	job.FailedActionOutput = truncateOutput(output, failedActionOutputLimit)
 
-		return ctrl.Result{}, err
+	var retries int32
+	if plunderMachine.Spec.KubernetesInstallRetries != nil {
+		retries = *plunderMachine.Spec.KubernetesInstallRetries
+	}
+
+	if job.Attempt <= retries {
+		log.Info(fmt.Sprintf("The action [%s] failed on attempt %d of %d, the installation will be retried", action, job.Attempt, retries+1))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderInstallRetry", "The action [%s] failed on attempt %d of %d, the installation will be retried: %s", action, job.Attempt, retries+1, truncateOutput(output, failedActionEventLimit))
+		setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInstallRetrying, "The action [%s] failed on attempt %d of %d, the installation will be retried", action, job.Attempt, retries+1)
+
+		// The logs of the failed job are removed so that they aren't mistaken for the retry
+		c.ParlayLogClear(ipAddress)
+		setMachinePhase(plunderMachine, infrav1.MachinePhaseOSReady)
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	log.Info(fmt.Sprintf("The Kubernetes installation failed after %s, the action [%s] failed", phaseDuration(plunderMachine), action))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderInstall", "The action [%s] failed after %s: %s", action, phaseDuration(plunderMachine), truncateOutput(output, failedActionEventLimit))
+	setMachineCondition(plunderMachine, infrav1.ConditionKubernetesInstalled, corev1.ConditionFalse, reasonInstallFailed, "The action [%s] failed", action)
+	setMachineFailure(plunderMachine, capierrors.CreateMachineError, "The Kubernetes installation failed after %s, the action [%s] failed", phaseDuration(plunderMachine), action)
+	return ctrl.Result{}, nil
+}
+
+// truncateOutput - keeps the end of the output of an action, as that is where the error will be
+func truncateOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	return "..." + output[len(output)-limit:]
+}
+
+// reconcileMachineDelete - cleans the host of a deleted machine with its deprovision policy and removes its
+// deployment from the Plunder server, the cleaning is tracked in the status so each reconcile checks on it. If a
+// client for the Plunder server couldn't be created (clientErr) the attempt fails and is retried with a backoff.
+func (r *PlunderMachineReconciler) reconcileMachineDelete(c plunder.Interface, clientErr error, logger logr.Logger, machine *clusterv1.Machine, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, plunderCluster *infrav1.PlunderCluster) (_ ctrl.Result, reterr error) {
+	ipAddress := plunderMachine.Status.IPAdress
+	if ipAddress == "" && plunderMachine.Spec.IPAddress != nil {
+		ipAddress = *plunderMachine.Spec.IPAddress
+	}
+	policy := deprovisionPolicy(plunderMachine, plunderCluster)
+
+	ds := plunderMachine.Status.Deprovision
+	if ds == nil {
+		logger.Info(fmt.Sprintf("Deleting Machine %s", plunderMachine.Name))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDelete", "Plunder has begun removing the host")
+
+		// Only a host with an Operating System can run the actions that clean it
+		ds = &infrav1.DeprovisionStatus{Mode: policy.Mode, Host: ipAddress}
+		if osProvisioned := infrav1.FindCondition(plunderMachine.Status.Conditions, infrav1.ConditionOSProvisioned); ipAddress == "" || osProvisioned == nil || osProvisioned.Status != corev1.ConditionTrue {
+			ds.Mode = infrav1.DeprovisionModeNone
+		}
+		plunderMachine.Status.Deprovision = ds
+		setMachinePhase(plunderMachine, infrav1.MachinePhaseDeprovisioning)
+		r.updateHostState(logger, plunderMachine, infrav1.HostStateDeprovisioning)
+	}
+
+	if ds.Completed == nil && forceDelete(machine, plunderMachine) {
+		return r.forceRemoveMachine(logger, plunderMachine, cluster, ds)
+	}
 
+	// A failed attempt is retried once its backoff has passed
+	if ds.Failures > 0 && ds.LastFailure != nil {
+		if wait := deprovisionRetry(ds.Failures) - time.Since(ds.LastFailure.Time); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	// The node is drained and removed from the workload cluster before its host is touched
+	if !ds.NodeRemoved {
+		done, err := r.reconcileDrain(logger, machine, plunderMachine, cluster, ds)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Unable to drain the node [%v]", err))
+			setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonDraining, "Unable to drain the node [%v]", err)
+			return ctrl.Result{RequeueAfter: drainRequeue}, nil
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: drainRequeue}, nil
+		}
+		ds.NodeRemoved = true
+	}
+
+	// The rest of the removal needs the Plunder server, unless the machine never got as far as having a deployment
+	needsPlunder := (ds.Mode != infrav1.DeprovisionModeNone && ds.Completed == nil) || plunderMachine.Status.MACAddress != ""
+	if clientErr != nil && needsPlunder {
+		return r.deprovisionFailed(logger, plunderMachine, ds, "Unable to connect to the Plunder server [%v]", clientErr)
+	}
+
+	if ds.Mode != infrav1.DeprovisionModeNone && !ds.Submitted {
+		d, err := deprovisionConfig(policy)
+		if err != nil {
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "InvalidDeprovisionPolicy", err.Error())
+			setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonInvalidConfiguration, "%s", err.Error())
+			return ctrl.Result{}, nil
+		}
+
+		// Remove the logs of provisioning so they aren't mistaken for the cleaning of the host
+		c.ParlayLogClear(ds.Host)
+		if err := c.DeprovisionMachine(ds.Host, d); err != nil {
+			return r.deprovisionFailed(logger, plunderMachine, ds, "Plunder couldn't clean the host [%v]", err)
+		}
+
+		now := metav1.Now()
+		ds.Submitted = true
+		ds.Started = &now
+		logger.Info(fmt.Sprintf("Cleaning host %s with the %s deprovision mode", ds.Host, ds.Mode))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderDelete", "Plunder is cleaning the host with the %s deprovision mode", ds.Mode)
+		setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonDeprovisioning, "Plunder is cleaning the host with the %s deprovision mode", ds.Mode)
+		return ctrl.Result{RequeueAfter: deprovisionRequeue}, nil
+	}
+
+	if ds.Mode != infrav1.DeprovisionModeNone && ds.Completed == nil {
+		logs, err := c.ParlayLogs(ds.Host)
+		if err != nil {
+			// The logs may not have been created yet, so check again later
+			logger.Info(fmt.Sprintf("Unable to retrieve the deprovisioning logs [%v]", err))
+			return ctrl.Result{RequeueAfter: deprovisionRequeue}, nil
+		}
+
+		switch logs.State {
+		case "Completed":
+			r.recordParlayLogs(c, logger, plunderMachine, infrav1.MachinePhaseDeprovisioning)
+		case "Failed":
+			r.recordParlayLogs(c, logger, plunderMachine, infrav1.MachinePhaseDeprovisioning)
+			action, output := "unknown", ""
+			if failure := plunder.FailedAction(logs); failure != nil {
+				action, output = failure.Action, failure.Output
+			}
+			ds.FailedAction = action
+			ds.FailedActionOutput = truncateOutput(output, failedActionOutputLimit)
+			r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderDelete", "The action [%s] failed whilst cleaning the host: %s", action, truncateOutput(output, failedActionEventLimit))
+			// The actions are submitted again when the host is retried
+			ds.Submitted = false
+			return r.deprovisionFailed(logger, plunderMachine, ds, "The action [%s] failed whilst cleaning the host", action)
+		default:
+			logger.Info("Waiting for the host to be cleaned")
+			setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonDeprovisioning, "Plunder is cleaning the host with the %s deprovision mode", ds.Mode)
+			return ctrl.Result{RequeueAfter: deprovisionRequeue}, nil
+		}
+	}
+
+	// Remove the deployment, a machine that didn't get as far as deploying an Operating System won't have one
+	if plunderMachine.Status.MACAddress != "" {
+		deployment, err := c.GetDeployment(plunderMachine.Status.MACAddress)
+		if err != nil {
+			return r.deprovisionFailed(logger, plunderMachine, ds, "Plunder couldn't remove the host [%v]", err)
+		}
+		if deployment != nil {
+			if err := c.DeleteDeployment(deployment.ConfigHost.IPAddress); err != nil {
+				return r.deprovisionFailed(logger, plunderMachine, ds, "Plunder couldn't remove the host [%v]", err)
+			}
+		}
+	}
+
+	now := metav1.Now()
+	ds.Completed = &now
+	setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionTrue, reasonDeprovisioned, "The host has been removed from the Plunder server")
+
+	// The host has been removed from Plunder, so it can be claimed by another machine once it has rebooted. A host
+	// with a BMC is powered off (however it was cleaned) and is available straight away, as it is powered on when
+	// it is claimed.
+	if plunderMachine.Status.HostRef != nil {
+		poweredOff := r.powerOffHost(logger, plunderMachine)
+		awaitBoot := !poweredOff && ds.Mode != infrav1.DeprovisionModeNone && !policy.SkipReboot
+		err := recycleHost(context.TODO(), r.Client, hostKey(plunderMachine).Namespace, plunderMachine.Status.HostRef.Name, plunderMachine.UID, awaitBoot)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Return the address to its pool
+	if plunderMachine.Status.IPClaim != nil {
+		err := releaseAddress(context.TODO(), r.Client, plunderMachine.Namespace, plunderMachine.Status.IPClaim.PoolName, plunderMachine.UID)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// Machine is deleted so remove the finalizer.
@@ -285,3 +971,84 @@ func (r *PlunderMachineReconciler) reconcileMachineDelete(c *plunder.Client, log
 	return ctrl.Result{}, nil
 
 }
+
+// deprovisionFailed - records a failed attempt to remove the host of a machine, the finalizer is kept so that the
+// machine isn't removed whilst its host is still running. The attempt is retried with a backoff, or the machine
+// can be removed with the ForceDeleteAnnotation.
+func (r *PlunderMachineReconciler) deprovisionFailed(logger logr.Logger, plunderMachine *infrav1.PlunderMachine, ds *infrav1.DeprovisionStatus, format string, args ...interface{}) (ctrl.Result, error) {
+	message := fmt.Sprintf(format, args...)
+	now := metav1.Now()
+	ds.Failures++
+	ds.LastFailure = &now
+	ds.LastError = message
+
+	retry := deprovisionRetry(ds.Failures)
+	logger.Info(fmt.Sprintf("%s, retrying in %s", message, retry))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderDelete", "%s, retrying in %s", message, retry)
+	setMachineCondition(plunderMachine, infrav1.ConditionDeprovisioned, corev1.ConditionFalse, reasonDeprovisionFailed, "%s (attempt %d), retrying in %s", message, ds.Failures, retry)
+	return ctrl.Result{RequeueAfter: retry}, nil
+}
+
+// forceRemoveMachine - removes a machine whose host hasn't been cleaned, because it has the ForceDeleteAnnotation.
+// The host is recorded as orphaned so that it can be cleaned up by hand, and its PlunderHost won't be claimed
+// again until its state is set back to Available.
+func (r *PlunderMachineReconciler) forceRemoveMachine(logger logr.Logger, plunderMachine *infrav1.PlunderMachine, cluster *clusterv1.Cluster, ds *infrav1.DeprovisionStatus) (ctrl.Result, error) {
+	reason := ds.LastError
+	if reason == "" {
+		reason = "The machine was force removed before its host was cleaned"
+	}
+	if err := recordOrphanedHost(context.TODO(), r.Client, plunderMachine, cluster, reason); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if plunderMachine.Status.HostRef != nil {
+		err := orphanHost(context.TODO(), r.Client, hostKey(plunderMachine).Namespace, plunderMachine.Status.HostRef.Name, plunderMachine.UID)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if plunderMachine.Status.IPClaim != nil {
+		err := releaseAddress(context.TODO(), r.Client, plunderMachine.Namespace, plunderMachine.Status.IPClaim.PoolName, plunderMachine.UID)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Force removing Machine [%s], its host has been recorded in %s and may need removing manually", plunderMachine.Name, orphanedHostsName))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PlunderForceDelete", "Machine force removed, its host has been recorded in the %s ConfigMap and may need cleaning and removing manually", orphanedHostsName)
+	plunderMachine.Finalizers = util.Filter(plunderMachine.Finalizers, infrav1.MachineFinalizer)
+	return ctrl.Result{}, nil
+}
+
+// updateHostState - records what the claimed PlunderHost is being used for, the host state is informational
+// so a failure is logged rather than interrupting provisioning
+func (r *PlunderMachineReconciler) updateHostState(log logr.Logger, plunderMachine *infrav1.PlunderMachine, state infrav1.HostState) {
+	if plunderMachine.Status.HostRef == nil {
+		return
+	}
+	err := setHostState(context.TODO(), r.Client, hostKey(plunderMachine).Namespace, plunderMachine.Status.HostRef.Name, plunderMachine.UID, state)
+	if err != nil {
+		log.Error(err, "unable to update PlunderHost state", "plunderhost", plunderMachine.Status.HostRef.Name)
+	}
+}
+
+// setMachinePhase - moves the PlunderMachine into a new phase of provisioning
+func setMachinePhase(plunderMachine *infrav1.PlunderMachine, phase infrav1.MachinePhase) {
+	now := metav1.Now()
+	plunderMachine.Status.Phase = phase
+	plunderMachine.Status.LastPhaseTransition = &now
+}
+
+// persistMachineStatus - writes the PlunderMachine to the API server straight away, this is used to record
+// what is about to be submitted to the Plunder server before the request is made
+func persistMachineStatus(patchHelper *patch.Helper, plunderMachine *infrav1.PlunderMachine) error {
+	return patchHelper.Patch(context.TODO(), plunderMachine)
+}
+
+// phaseDuration - returns how long the PlunderMachine has been in its current phase
+func phaseDuration(plunderMachine *infrav1.PlunderMachine) time.Duration {
+	if plunderMachine.Status.LastPhaseTransition == nil {
+		return 0
+	}
+	return time.Since(plunderMachine.Status.LastPhaseTransition.Time).Round(time.Second)
+}
@@ -0,0 +1,530 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+func TestReconcileMachineProvision(t *testing.T) {
+	m := newMachineTest(t, nil)
+
+	// Each reconcile moves the machine along by one phase
+	m.reconcile()
+	pm := m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseHardwareClaimed {
+		t.Fatalf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseHardwareClaimed), phaseName(pm.Status.Phase))
+	}
+	if !util.Contains(pm.Finalizers, infrav1.MachineFinalizer) {
+		t.Error("the finalizer wasn't added")
+	}
+	if pm.Status.MACAddress != testMachineMAC || pm.Status.HostRef == nil || pm.Status.HostRef.Name != "host-0" {
+		t.Errorf("host-0 wasn't claimed: %+v", pm.Status)
+	}
+	if host := m.host(); host.Spec.ConsumerRef == nil || host.Spec.ConsumerRef.UID != pm.UID {
+		t.Errorf("host-0 isn't claimed by the machine: %+v", host.Spec.ConsumerRef)
+	}
+
+	result := m.reconcile()
+	pm = m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseOSDeploying {
+		t.Fatalf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseOSDeploying), phaseName(pm.Status.Phase))
+	}
+	if result.RequeueAfter != osProvisionRequeue {
+		t.Errorf("expected a requeue after %s, got %+v", osProvisionRequeue, result)
+	}
+	if d, ok := m.plunder.Deployment(testMachineMAC); !ok || d.ConfigHost.IPAddress != testMachineIP {
+		t.Errorf("the deployment wasn't created on the Plunder server: %+v", d)
+	}
+	if pm.Status.Deployment == nil || !pm.Status.Deployment.Submitted {
+		t.Errorf("the deployment wasn't recorded as submitted: %+v", pm.Status.Deployment)
+	}
+	if host := m.host(); host.Status.State != infrav1.HostStateProvisioning {
+		t.Errorf("expected host-0 to be %s, got %s", infrav1.HostStateProvisioning, host.Status.State)
+	}
+
+	m.reconcileUntil(infrav1.MachinePhaseOSReady)
+	if status, _ := m.condition(infrav1.ConditionOSProvisioned); status != corev1.ConditionTrue {
+		t.Errorf("expected OSProvisioned to be True, got %s", status)
+	}
+
+	m.reconcile()
+	pm = m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseKubernetesInstalling {
+		t.Fatalf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseKubernetesInstalling), phaseName(pm.Status.Phase))
+	}
+	if pm.Status.ParlayJob == nil || !pm.Status.ParlayJob.Submitted || pm.Status.ParlayJob.Attempt != 1 {
+		t.Errorf("the parlay job wasn't recorded: %+v", pm.Status.ParlayJob)
+	}
+
+	m.reconcileUntil(infrav1.MachinePhaseReady)
+	pm = m.machine()
+	if !pm.Status.Ready || pm.Spec.ProviderID == nil || *pm.Spec.ProviderID != "plunder://"+testMachineMAC {
+		t.Errorf("the machine wasn't made ready: %+v", pm.Spec.ProviderID)
+	}
+	if status, reason := m.condition(infrav1.ConditionKubernetesInstalled); status != corev1.ConditionTrue || reason != reasonInstalled {
+		t.Errorf("expected KubernetesInstalled to be True (%s), got %s (%s)", reasonInstalled, status, reason)
+	}
+	if host := m.host(); host.Status.State != infrav1.HostStateProvisioned {
+		t.Errorf("expected host-0 to be %s, got %s", infrav1.HostStateProvisioned, host.Status.State)
+	}
+	if pm.Status.ParlayLogs == nil || pm.Status.ParlayLogs.ConfigMapName != parlayLogsName(pm) {
+		t.Errorf("the parlay logs weren't captured: %+v", pm.Status.ParlayLogs)
+	}
+}
+
+// installing - provisions the machine until its Kubernetes installation has been submitted, the installation is
+// left running and the name of its first action is returned
+func (m *machineTest) installing() string {
+	m.t.Helper()
+	m.reconcileUntil(infrav1.MachinePhaseOSReady)
+	m.plunder.AutoComplete = false
+	m.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+
+	submitted := m.plunder.Submitted()
+	job := submitted[len(submitted)-1]
+	if len(job.Deployments) == 0 || len(job.Deployments[0].Actions) == 0 {
+		m.t.Fatalf("the Kubernetes installation has no actions: %+v", job)
+	}
+	return job.Deployments[0].Actions[0].Name
+}
+
+func TestReconcileMachineInstallFailed(t *testing.T) {
+	m := newMachineTest(t, nil)
+	action := m.installing()
+
+	m.plunder.SetParlayFailure(testMachineIP, action, "E: Unable to locate package kubelet")
+	m.reconcile()
+
+	pm := m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseFailed {
+		t.Fatalf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseFailed), phaseName(pm.Status.Phase))
+	}
+	if pm.Status.FailureReason == nil || pm.Status.FailureMessage == nil || !strings.Contains(*pm.Status.FailureMessage, action) {
+		t.Errorf("the failure wasn't recorded: %v %v", pm.Status.FailureReason, pm.Status.FailureMessage)
+	}
+	if job := pm.Status.ParlayJob; job == nil || job.FailedAction != action || !strings.Contains(job.FailedActionOutput, "Unable to locate package") {
+		t.Errorf("the failed action wasn't recorded: %+v", job)
+	}
+	if status, reason := m.condition(infrav1.ConditionKubernetesInstalled); status != corev1.ConditionFalse || reason != reasonInstallFailed {
+		t.Errorf("expected KubernetesInstalled to be False (%s), got %s (%s)", reasonInstallFailed, status, reason)
+	}
+	if pm.Status.Ready {
+		t.Error("a failed machine was made ready")
+	}
+
+	// A failed machine stays failed
+	m.reconcile()
+	if phase := m.machine().Status.Phase; phase != infrav1.MachinePhaseFailed {
+		t.Errorf("expected the machine to stay %s, got %s", phaseName(infrav1.MachinePhaseFailed), phaseName(phase))
+	}
+}
+
+func TestReconcileMachineInvalidNetwork(t *testing.T) {
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		pm.Spec.Network = &infrav1.NetworkConfig{Gateway: "gateway"}
+	})
+
+	// An invalid network won't fix itself, so the machine fails before anything is submitted
+	if result := m.reconcileUntil(infrav1.MachinePhaseFailed); result.Requeue || result.RequeueAfter != 0 {
+		t.Errorf("expected a failed machine not to be requeued, got %+v", result)
+	}
+	pm := m.machine()
+	if pm.Status.FailureReason == nil || *pm.Status.FailureReason != capierrors.InvalidConfigurationMachineError {
+		t.Errorf("expected the failure reason %s, got %v", capierrors.InvalidConfigurationMachineError, pm.Status.FailureReason)
+	}
+	if pm.Status.FailureMessage == nil || !strings.Contains(*pm.Status.FailureMessage, "Gateway [gateway]") {
+		t.Errorf("the failure message doesn't say what is invalid: %v", pm.Status.FailureMessage)
+	}
+	if status, reason := m.condition(infrav1.ConditionOSProvisioned); status != corev1.ConditionFalse || reason != reasonInvalidNetwork {
+		t.Errorf("expected OSProvisioned to be False (%s), got %s (%s)", reasonInvalidNetwork, status, reason)
+	}
+	if _, ok := m.plunder.Deployment(testMachineMAC); ok {
+		t.Error("a deployment was created for a machine with an invalid network")
+	}
+}
+
+func TestReconcileMachineInstallRetry(t *testing.T) {
+	retries := int32(1)
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		pm.Spec.KubernetesInstallRetries = &retries
+	})
+	action := m.installing()
+
+	m.plunder.SetParlayFailure(testMachineIP, action, "E: Unable to locate package kubelet")
+	m.reconcile()
+	pm := m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseOSReady {
+		t.Fatalf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseOSReady), phaseName(pm.Status.Phase))
+	}
+	if status, reason := m.condition(infrav1.ConditionKubernetesInstalled); status != corev1.ConditionFalse || reason != reasonInstallRetrying {
+		t.Errorf("expected KubernetesInstalled to be False (%s), got %s (%s)", reasonInstallRetrying, status, reason)
+	}
+
+	m.reconcile()
+	pm = m.machine()
+	if pm.Status.Phase != infrav1.MachinePhaseKubernetesInstalling || pm.Status.ParlayJob.Attempt != 2 {
+		t.Fatalf("the installation wasn't retried: %s %+v", phaseName(pm.Status.Phase), pm.Status.ParlayJob)
+	}
+
+	// The retry runs out of attempts, failing the machine
+	m.plunder.SetParlayFailure(testMachineIP, action, "E: Unable to locate package kubelet")
+	m.reconcile()
+	if phase := m.machine().Status.Phase; phase != infrav1.MachinePhaseFailed {
+		t.Errorf("expected the %s phase, got %s", phaseName(infrav1.MachinePhaseFailed), phaseName(phase))
+	}
+}
+
+// deleted - provisions the machine and then deletes it, the finalizer keeps it until its host has been cleaned
+func (m *machineTest) deleted() {
+	m.t.Helper()
+	m.reconcileUntil(infrav1.MachinePhaseReady)
+	m.plunder.AutoComplete = false
+	if err := m.k8s.Delete(context.TODO(), m.machine()); err != nil {
+		m.t.Fatal(err)
+	}
+	if m.machine().DeletionTimestamp == nil {
+		m.t.Fatal("the machine was removed without its finalizer being removed")
+	}
+}
+
+// failDeprovision - fails the job cleaning the host of a deleted machine, returning how long the reconcile waits
+// before retrying
+func (m *machineTest) failDeprovision() time.Duration {
+	m.t.Helper()
+	submitted := m.plunder.Submitted()
+	job := submitted[len(submitted)-1]
+	m.plunder.SetParlayFailure(testMachineIP, job.Deployments[0].Actions[0].Name, "wipefs: error: /dev/sda: probing initialization failed")
+	return m.reconcile().RequeueAfter
+}
+
+func TestReconcileMachineDelete(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.deleted()
+
+	result := m.reconcile()
+	pm := m.machine()
+	ds := pm.Status.Deprovision
+	if pm.Status.Phase != infrav1.MachinePhaseDeprovisioning || ds == nil || !ds.Submitted || ds.Mode != infrav1.DeprovisionModeQuick {
+		t.Fatalf("the host wasn't being cleaned: %s %+v", phaseName(pm.Status.Phase), ds)
+	}
+	if result.RequeueAfter != deprovisionRequeue {
+		t.Errorf("expected a requeue after %s, got %+v", deprovisionRequeue, result)
+	}
+
+	m.plunder.SetParlayState(testMachineIP, "Completed")
+	m.reconcile()
+	if !m.removed() {
+		t.Error("the machine wasn't removed once its host was cleaned")
+	}
+	if events := strings.Join(m.events(), "\n"); !strings.Contains(events, "Machine removed succesfully") {
+		t.Errorf("the removal wasn't recorded: %s", events)
+	}
+	if _, ok := m.plunder.Deployment(testMachineMAC); ok {
+		t.Error("the deployment wasn't removed from the Plunder server")
+	}
+	if host := m.host(); host.Spec.ConsumerRef != nil || host.Status.State != infrav1.HostStateAvailable {
+		t.Errorf("host-0 wasn't made available: %s %+v", host.Status.State, host.Spec.ConsumerRef)
+	}
+}
+
+func TestReconcileMachineDeleteRetry(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.deleted()
+	m.reconcile()
+
+	// A failed clean keeps the finalizer and is retried after a backoff
+	if wait := m.failDeprovision(); wait != deprovisionRetryInitial {
+		t.Errorf("expected a retry after %s, got %s", deprovisionRetryInitial, wait)
+	}
+	pm := m.machine()
+	ds := pm.Status.Deprovision
+	if ds.Failures != 1 || ds.LastFailure == nil || ds.Submitted || !strings.Contains(ds.LastError, "failed whilst cleaning the host") {
+		t.Errorf("the failure wasn't recorded: %+v", ds)
+	}
+	if !util.Contains(pm.Finalizers, infrav1.MachineFinalizer) {
+		t.Fatal("the finalizer was removed from a machine whose host wasn't cleaned")
+	}
+	if status, reason := m.condition(infrav1.ConditionDeprovisioned); status != corev1.ConditionFalse || reason != reasonDeprovisionFailed {
+		t.Errorf("expected Deprovisioned to be False (%s), got %s (%s)", reasonDeprovisionFailed, status, reason)
+	}
+
+	// Nothing is submitted until the backoff has passed
+	submitted := len(m.plunder.Submitted())
+	if wait := m.reconcile().RequeueAfter; wait <= 0 || wait > deprovisionRetryInitial {
+		t.Errorf("expected to wait for the backoff, got %s", wait)
+	}
+	if len(m.plunder.Submitted()) != submitted {
+		t.Error("the clean was submitted again before the backoff had passed")
+	}
+
+	backdate := func() {
+		m.updateStatus(func(pm *infrav1.PlunderMachine) {
+			past := metav1.NewTime(pm.Status.Deprovision.LastFailure.Add(-time.Hour))
+			pm.Status.Deprovision.LastFailure = &past
+		})
+	}
+	backdate()
+	m.reconcile()
+	if len(m.plunder.Submitted()) != submitted+1 || !m.machine().Status.Deprovision.Submitted {
+		t.Fatal("the clean wasn't submitted again once the backoff had passed")
+	}
+
+	// The backoff doubles with each failure
+	if wait := m.failDeprovision(); wait != 2*deprovisionRetryInitial {
+		t.Errorf("expected a retry after %s, got %s", 2*deprovisionRetryInitial, wait)
+	}
+	if failures := m.machine().Status.Deprovision.Failures; failures != 2 {
+		t.Errorf("expected 2 failures to be recorded, got %d", failures)
+	}
+	backdate()
+	m.reconcile()
+	m.plunder.SetParlayState(testMachineIP, "Completed")
+	m.reconcile()
+	if !m.removed() {
+		t.Error("the machine wasn't removed once the host was cleaned")
+	}
+}
+
+func TestReconcileMachineDeleteUnreachable(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.deleted()
+	m.reconcile()
+	m.plunder.SetParlayState(testMachineIP, "Completed")
+
+	// A request for the deployment that fails mustn't be mistaken for the deployment having gone
+	m.plunder.Fail("GetDeployment", "Unable to connect to the Plunder server")
+	if wait := m.reconcile().RequeueAfter; wait != deprovisionRetryInitial {
+		t.Errorf("expected a retry after %s, got %s", deprovisionRetryInitial, wait)
+	}
+	pm := m.machine()
+	if !util.Contains(pm.Finalizers, infrav1.MachineFinalizer) {
+		t.Fatal("the finalizer was removed whilst the deployment couldn't be checked")
+	}
+	if ds := pm.Status.Deprovision; ds.Completed != nil || ds.Failures != 1 || !strings.Contains(ds.LastError, "Unable to connect") {
+		t.Errorf("the failure wasn't recorded: %+v", ds)
+	}
+	if _, ok := m.plunder.Deployment(testMachineMAC); !ok {
+		t.Fatal("the deployment was removed")
+	}
+
+	m.plunder.Fail("GetDeployment", "")
+	m.updateStatus(func(pm *infrav1.PlunderMachine) {
+		past := metav1.NewTime(pm.Status.Deprovision.LastFailure.Add(-time.Hour))
+		pm.Status.Deprovision.LastFailure = &past
+	})
+	m.reconcile()
+	if !m.removed() {
+		t.Error("the machine wasn't removed once the deployment was removed")
+	}
+	if _, ok := m.plunder.Deployment(testMachineMAC); ok {
+		t.Error("the deployment wasn't removed from the Plunder server")
+	}
+}
+
+func TestReconcileMachineClientError(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.r.NewPlunderClient = func(server string) (plunder.Interface, error) {
+		return nil, fmt.Errorf("Unable to connect to the Plunder server")
+	}
+
+	if _, err := m.r.Reconcile(ctrl.Request{NamespacedName: m.key}); err == nil {
+		t.Fatal("expected the error creating the client to be returned")
+	}
+	if status, reason := m.condition(infrav1.ConditionPlunderReachable); status != corev1.ConditionFalse || reason != reasonUnreachable {
+		t.Errorf("expected PlunderReachable to be False (%s), got %s (%s)", reasonUnreachable, status, reason)
+	}
+	if phase := m.machine().Status.Phase; phase != infrav1.MachinePhasePending {
+		t.Errorf("expected the machine to stay %s, got %s", phaseName(infrav1.MachinePhasePending), phaseName(phase))
+	}
+}
+
+func TestReconcileMachineDeleteClientError(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.deleted()
+	m.r.NewPlunderClient = func(server string) (plunder.Interface, error) {
+		return nil, fmt.Errorf("Unable to read the credentials of the Plunder server")
+	}
+
+	// The removal backs off rather than returning the error
+	if wait := m.reconcile().RequeueAfter; wait != deprovisionRetryInitial {
+		t.Errorf("expected a retry after %s, got %s", deprovisionRetryInitial, wait)
+	}
+	pm := m.machine()
+	if !util.Contains(pm.Finalizers, infrav1.MachineFinalizer) {
+		t.Fatal("the finalizer was removed without the host being cleaned")
+	}
+	if ds := pm.Status.Deprovision; ds == nil || ds.Failures != 1 || !strings.Contains(ds.LastError, "Unable to connect to the Plunder server") {
+		t.Errorf("the failure wasn't recorded: %+v", ds)
+	}
+	if status, _ := m.condition(infrav1.ConditionPlunderReachable); status != corev1.ConditionFalse {
+		t.Errorf("expected PlunderReachable to be False, got %s", status)
+	}
+
+	// The machine can still be force removed
+	m.update(func(pm *infrav1.PlunderMachine) {
+		pm.Annotations = map[string]string{infrav1.ForceDeleteAnnotation: "true"}
+	})
+	m.reconcile()
+	if !m.removed() {
+		t.Error("the force removed machine wasn't removed")
+	}
+	if host := m.host(); host.Spec.ConsumerRef != nil || host.Status.State != infrav1.HostStateOrphaned {
+		t.Errorf("expected host-0 to be %s, got %s %+v", infrav1.HostStateOrphaned, host.Status.State, host.Spec.ConsumerRef)
+	}
+}
+
+// submitRecorder is a Plunder client that keeps the PlunderMachine as it is stored in the API server at the
+// moment the deployment and the Kubernetes installation are submitted
+type submitRecorder struct {
+	plunder.Interface
+	m           *machineTest
+	provisioned *infrav1.PlunderMachine
+	started     *infrav1.PlunderMachine
+}
+
+func (c *submitRecorder) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType string, network *plunder.NetworkConfig) error {
+	c.provisioned = c.m.machine()
+	return c.Interface.ProvisionMachine(hostname, macAddress, ipAddress, deploymenType, network)
+}
+
+func (c *submitRecorder) ProvisionKubernetesStart() error {
+	c.started = c.m.machine()
+	return c.Interface.ProvisionKubernetesStart()
+}
+
+func TestReconcileMachineRecordsBeforeSubmit(t *testing.T) {
+	m := newMachineTest(t, nil)
+	recorder := &submitRecorder{m: m}
+	m.r.NewPlunderClient = func(server string) (plunder.Interface, error) {
+		c, err := m.plunder.NewClient(server)
+		recorder.Interface = c
+		return recorder, err
+	}
+	m.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+
+	// The status subresource has to have been written before anything is submitted, so that an interrupted
+	// reconcile finds what was submitted
+	if recorder.provisioned == nil {
+		t.Fatal("the deployment wasn't submitted")
+	}
+	if d := recorder.provisioned.Status.Deployment; d == nil || d.MACAddress != testMachineMAC || d.IPAddress != testMachineIP || d.Submitted {
+		t.Errorf("the deployment wasn't recorded before it was submitted: %+v", d)
+	}
+	if recorder.started == nil {
+		t.Fatal("the Kubernetes installation wasn't submitted")
+	}
+	if job := recorder.started.Status.ParlayJob; job == nil || job.Host != testMachineIP || job.Submitted || job.Attempt != 1 {
+		t.Errorf("the parlay job wasn't recorded before it was submitted: %+v", job)
+	}
+}
+
+// lastJob - returns the last job submitted to the Plunder server
+func (m *machineTest) lastJob() parlaytypes.TreasureMap {
+	m.t.Helper()
+	submitted := m.plunder.Submitted()
+	if len(submitted) == 0 {
+		m.t.Fatal("nothing has been submitted")
+	}
+	return submitted[len(submitted)-1]
+}
+
+// findAction - returns the action of a deployment whose name starts with a prefix
+func findAction(d parlaytypes.Deployment, prefix string) *parlaytypes.Action {
+	for i := range d.Actions {
+		if strings.HasPrefix(d.Actions[i].Name, prefix) {
+			return &d.Actions[i]
+		}
+	}
+	return nil
+}
+
+// initToken - returns the token kubeadm init is given
+func initToken(command string) string {
+	fields := strings.Fields(command)
+	for i := range fields[:len(fields)-1] {
+		if fields[i] == "--token" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+func TestReconcileMachineParlay(t *testing.T) {
+	m := newMachineTest(t, nil)
+	m.setControlPlane()
+	worker := m.addMachine(1, "192.168.1.11", "00:50:56:a5:b5:f2", false)
+
+	// The worker waits until the control plane has been initialised
+	worker.reconcileUntil(infrav1.MachinePhaseOSReady)
+	worker.reconcile()
+	if phase := worker.machine().Status.Phase; phase != infrav1.MachinePhaseOSReady {
+		t.Fatalf("expected the worker to wait in the %s phase, got %s", phaseName(infrav1.MachinePhaseOSReady), phaseName(phase))
+	}
+	if status, reason := worker.condition(infrav1.ConditionKubernetesInstalled); status != corev1.ConditionFalse || reason != reasonWaitingForInit {
+		t.Errorf("expected KubernetesInstalled to be False (%s), got %s (%s)", reasonWaitingForInit, status, reason)
+	}
+
+	// The control plane takes the init lock and runs kubeadm init
+	m.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+	job := m.lastJob()
+	if len(job.Deployments) != 1 || job.Deployments[0].Hosts[0] != testMachineIP {
+		t.Fatalf("expected a single deployment for the control plane, got %+v", job.Deployments)
+	}
+	init := findAction(job.Deployments[0], "Cluster-API provisioning [Initialise Kubernetes")
+	if init == nil {
+		t.Fatal("the control plane wasn't initialised with kubeadm init")
+	}
+	if !strings.Contains(init.Command, "--pod-network-cidr=10.244.0.0/16") || !strings.Contains(init.Command, "--control-plane-endpoint "+testMachineIP+":6443") {
+		t.Errorf("kubeadm init wasn't given the pod network and endpoint: %s", init.Command)
+	}
+	m.reconcileUntil(infrav1.MachinePhaseReady)
+
+	// Now the worker joins through the control plane, which prepares the join first
+	worker.reconcileUntil(infrav1.MachinePhaseKubernetesInstalling)
+	job = worker.lastJob()
+	if len(job.Deployments) != 2 {
+		t.Fatalf("expected the join preparation and the worker deployment, got %+v", job.Deployments)
+	}
+	if prepare := job.Deployments[0]; prepare.Hosts[0] != testMachineIP || findAction(prepare, "Cluster-API join [create join token]") == nil {
+		t.Errorf("the join wasn't prepared on the control plane: %+v", prepare)
+	}
+	join := findAction(job.Deployments[1], "Join Worker to cluster")
+	if job.Deployments[1].Hosts[0] != "192.168.1.11" || join == nil || !strings.Contains(join.Command, "kubeadm join "+testMachineIP+":6443") {
+		t.Fatalf("the worker didn't join through the control plane: %+v", job.Deployments[1])
+	}
+	if strings.Contains(join.Command, initToken(init.Command)) {
+		t.Error("the worker joined with the token the control plane was initialised with, rather than its own")
+	}
+	worker.reconcileUntil(infrav1.MachinePhaseReady)
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	// plunderServerCheck is how often the connection to a Plunder server is checked
+	plunderServerCheck = 1 * time.Minute
+
+	// serverCapacityRequeue is how long a machine waits for a busy Plunder server before trying again
+	serverCapacityRequeue = 30 * time.Second
+)
+
+// The reasons for the PlunderReachable condition
+const (
+	reasonConnected          = "Connected"
+	reasonUnreachable        = "Unreachable"
+	reasonInvalidCredentials = "InvalidCredentials"
+	reasonServerNotFound     = "PlunderServerNotFound"
+)
+
+// credentialsError is returned when the credentials of a Plunder server can't be used
+type credentialsError struct {
+	error
+}
+
+// PlunderClients creates the clients used to talk to Plunder servers, the connection to each server is created
+// once and kept until the PlunderServer, its credentials (or the configuration file) change
+type PlunderClients struct {
+	client.Client
+
+	// ConfigPath is the Plunder client configuration used for clusters that don't reference a PlunderServer
+	ConfigPath string
+
+	mu          sync.Mutex
+	connections map[string]*plunderConnection
+}
+
+// plunderConnection is a client for a Plunder server that is cloned for each reconcile, version changes when the
+// server or its credentials change
+type plunderConnection struct {
+	version string
+	client  *plunder.Client
+}
+
+// NewClient - returns a client for the PlunderServer with the name, an empty name is the server in ConfigPath
+func (p *PlunderClients) NewClient(server string) (plunder.Interface, error) {
+	c, err := p.connection(context.TODO(), server)
+	if err != nil {
+		return nil, err
+	}
+	return c.Clone(), nil
+}
+
+// connection - returns the cached client for a server, a new one is created if the server has changed
+func (p *PlunderClients) connection(ctx context.Context, server string) (*plunder.Client, error) {
+	var version string
+	var create func() (*plunder.Client, error)
+
+	if server == "" {
+		path := p.ConfigPath
+		if path == "" {
+			path = plunder.DefaultConfigPath
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, credentialsError{err}
+		}
+		version = info.ModTime().String()
+		create = func() (*plunder.Client, error) {
+			c, err := plunder.NewClientFromConfig(path)
+			if err != nil {
+				return nil, credentialsError{err}
+			}
+			return c, nil
+		}
+	} else {
+		ps := &infrav1.PlunderServer{}
+		if err := p.Get(ctx, types.NamespacedName{Name: server}, ps); err != nil {
+			return nil, err
+		}
+		ref := ps.Spec.CredentialsRef
+		if ref.Namespace == "" || ref.Name == "" {
+			return nil, credentialsError{fmt.Errorf("The credentialsRef of Plunder server [%s] needs a namespace and name", server)}
+		}
+		secret := &corev1.Secret{}
+		if err := p.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, credentialsError{fmt.Errorf("The credentials [%s/%s] of Plunder server [%s] don't exist", ref.Namespace, ref.Name, server)}
+			}
+			return nil, err
+		}
+		version = ps.ResourceVersion + "/" + secret.ResourceVersion
+		create = func() (*plunder.Client, error) {
+			h, err := plunder.NewHTTPClient(secret.Data[infrav1.PlunderServerCAKey], secret.Data[infrav1.PlunderServerCertKey], secret.Data[infrav1.PlunderServerKeyKey])
+			if err != nil {
+				return nil, credentialsError{err}
+			}
+			return plunder.NewClientFromURL(ps.Spec.Address, h)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.connections[server]; ok && conn.version == version {
+		return conn.client, nil
+	}
+	c, err := create()
+	if err != nil {
+		return nil, err
+	}
+	if p.connections == nil {
+		p.connections = map[string]*plunderConnection{}
+	}
+	p.connections[server] = &plunderConnection{version: version, client: c}
+	return c, nil
+}
+
+// checkPlunder - checks the connection to a Plunder server, returning the status and reason for the
+// PlunderReachable condition
+func checkPlunder(constructor func(string) (plunder.Interface, error), server string) (corev1.ConditionStatus, string, string) {
+	c, err := newPlunderClient(constructor, server)
+	if err == nil {
+		err = c.Ping()
+	}
+	return plunderCondition(err)
+}
+
+// plunderCondition - returns the status and reason for the PlunderReachable condition from the error of creating
+// a client for a Plunder server (or using it)
+func plunderCondition(err error) (corev1.ConditionStatus, string, string) {
+	switch {
+	case err == nil:
+		return corev1.ConditionTrue, reasonConnected, "The Plunder server is answering"
+	case isCredentialsError(err):
+		return corev1.ConditionFalse, reasonInvalidCredentials, err.Error()
+	case apierrors.IsNotFound(err):
+		return corev1.ConditionFalse, reasonServerNotFound, err.Error()
+	}
+	return corev1.ConditionFalse, reasonUnreachable, err.Error()
+}
+
+// plunderReachable - returns the status and reason for the PlunderReachable condition of a resource provisioned
+// through a Plunder server, it is copied from the PlunderServer otherwise the default server is checked
+func plunderReachable(ctx context.Context, c client.Client, constructor func(string) (plunder.Interface, error), server string) (corev1.ConditionStatus, string, string) {
+	if server == "" {
+		return checkPlunder(constructor, server)
+	}
+
+	ps := &infrav1.PlunderServer{}
+	if err := c.Get(ctx, types.NamespacedName{Name: server}, ps); err != nil {
+		if apierrors.IsNotFound(err) {
+			return corev1.ConditionFalse, reasonServerNotFound, err.Error()
+		}
+		return corev1.ConditionFalse, reasonUnreachable, err.Error()
+	}
+	if cond := infrav1.FindCondition(ps.Status.Conditions, infrav1.ConditionPlunderReachable); cond != nil {
+		return cond.Status, cond.Reason, cond.Message
+	}
+	return corev1.ConditionUnknown, "", "The Plunder server hasn't been checked yet"
+}
+
+// isCredentialsError - returns true if an error is caused by the credentials of a Plunder server, TLS errors
+// only reach the controller as text from the Plunder client
+func isCredentialsError(err error) bool {
+	if _, ok := err.(credentialsError); ok {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "x509:") || strings.Contains(msg, "tls:")
+}
+
+// machineServerName - returns the name of the PlunderServer a machine is provisioned through, the server recorded
+// when its hardware was claimed is used so that changing the cluster doesn't move existing machines. Otherwise it
+// is the server of the machine's failure domain (or the cluster).
+func machineServerName(plunderMachine *infrav1.PlunderMachine, plunderCluster *infrav1.PlunderCluster) string {
+	if plunderMachine.Status.PlunderServer != nil {
+		return *plunderMachine.Status.PlunderServer
+	}
+	return failureDomainServer(plunderCluster, plunderCluster.Spec.FindFailureDomain(machineFailureDomain(plunderMachine)))
+}
+
+// hostServerName - returns the name of the PlunderServer a host is provisioned through
+func hostServerName(host *infrav1.PlunderHost) string {
+	return host.Labels[infrav1.HostServerLabel]
+}
+
+// isProvisioning - returns true if a machine is having its Operating System or Kubernetes installed
+func isProvisioning(plunderMachine *infrav1.PlunderMachine) bool {
+	switch plunderMachine.Status.Phase {
+	case infrav1.MachinePhaseOSDeploying, infrav1.MachinePhaseKubernetesInstalling:
+		return true
+	}
+	return false
+}
+
+// serverMachines - returns how many PlunderMachines (in every namespace) are provisioned through a server, and
+// how many of them are being provisioned
+func serverMachines(ctx context.Context, c client.Client, server string) (machines, provisioning int32, err error) {
+	list := &infrav1.PlunderMachineList{}
+	if err := c.List(ctx, list); err != nil {
+		return 0, 0, err
+	}
+	for i := range list.Items {
+		m := &list.Items[i]
+		if m.Status.PlunderServer == nil || *m.Status.PlunderServer != server {
+			continue
+		}
+		machines++
+		if isProvisioning(m) {
+			provisioning++
+		}
+	}
+	return machines, provisioning, nil
+}
+
+// serverAtCapacity - returns true if a PlunderServer is already provisioning as many machines as it is allowed to,
+// the default server has no limit. The count comes from the cache, so the limit can be briefly exceeded when
+// several machines start at once.
+func serverAtCapacity(ctx context.Context, c client.Client, server string) (bool, error) {
+	if server == "" {
+		return false, nil
+	}
+	ps := &infrav1.PlunderServer{}
+	if err := c.Get(ctx, types.NamespacedName{Name: server}, ps); err != nil {
+		return false, err
+	}
+	if ps.Spec.MaxConcurrentProvisions == nil {
+		return false, nil
+	}
+	_, provisioning, err := serverMachines(ctx, c, server)
+	if err != nil {
+		return false, err
+	}
+	return provisioning >= *ps.Spec.MaxConcurrentProvisions, nil
+}
+
+// PlunderServerReconciler checks the connection to each PlunderServer
+type PlunderServerReconciler struct {
+	client.Client
+	Log logr.Logger
+
+	// NewPlunderClient creates the client used to talk to Plunder
+	NewPlunderClient func(server string) (plunder.Interface, error)
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderservers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=plunderservers/status,verbs=get;update;patch
+
+// Reconcile - This is called when a PlunderServer (or its credentials) is created/modified, and every minute. The
+// connection is checked and the machines provisioned through the server are counted.
+func (r *PlunderServerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("plunderserver", req.Name)
+
+	ps := &infrav1.PlunderServer{}
+	if err := r.Get(ctx, req.NamespacedName, ps); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	status, reason, message := checkPlunder(r.NewPlunderClient, ps.Name)
+	if status != corev1.ConditionTrue {
+		log.Info("Unable to connect to the Plunder server", "reason", reason, "message", message)
+	}
+
+	machines, provisioning, err := serverMachines(ctx, r.Client, ps.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	ps.Status.LastChecked = &now
+	ps.Status.Machines = machines
+	ps.Status.Provisioning = provisioning
+	infrav1.SetCondition(&ps.Status.Conditions, infrav1.ConditionPlunderReachable, status, reason, message)
+	if err := r.Status().Update(ctx, ps); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: plunderServerCheck}, nil
+}
+
+// SetupWithManager - will add the managment of resources of type PlunderServer, they are reconciled when their
+// credentials change so that rotated credentials are checked straight away
+func (r *PlunderServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.PlunderServer{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.credentialsToServers),
+		}).
+		Complete(r)
+}
+
+// credentialsToServers - returns the PlunderServers that use a Secret for their credentials
+func (r *PlunderServerReconciler) credentialsToServers(o handler.MapObject) []reconcile.Request {
+	servers := &infrav1.PlunderServerList{}
+	if err := r.List(context.TODO(), servers); err != nil {
+		r.Log.Error(err, "unable to list PlunderServers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range servers.Items {
+		ref := servers.Items[i].Spec.CredentialsRef
+		if ref.Namespace == o.Meta.GetNamespace() && ref.Name == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: servers.Items[i].Name}})
+		}
+	}
+	return requests
+}
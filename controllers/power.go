@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+	"github.com/plunder-app/cluster-api-plunder/pkg/power"
+)
+
+const (
+	// powerCallTimeout is how long a single request to a BMC can take, a BMC that doesn't answer is tried again on
+	// a later reconcile rather than holding up this one
+	powerCallTimeout = 15 * time.Second
+
+	// powerOnRetry is how long to wait before trying to power on a host through its BMC again
+	powerOnRetry = 30 * time.Second
+
+	// powerResetAfter is how long an installation can go without the Operating System coming up before the host
+	// is hard reset through its BMC
+	powerResetAfter = 20 * time.Minute
+
+	// powerResetLimit is how many times a stuck installation is hard reset, after which the phase timeout fails it
+	powerResetLimit = 2
+)
+
+// hostHasBMC - returns true if the power of a host can be controlled through its BMC
+func hostHasBMC(host *infrav1.PlunderHost) bool {
+	return host.Spec.BMC != nil && host.Spec.BMC.Address != ""
+}
+
+// newPowerClient - creates the power management of a BMC with the constructor, power.New is used if there isn't
+// a constructor
+func newPowerClient(constructor func(string, power.Credentials, bool) (power.Interface, error), address string, creds power.Credentials, insecure bool) (power.Interface, error) {
+	if constructor != nil {
+		return constructor(address, creds, insecure)
+	}
+	return power.New(address, creds, insecure)
+}
+
+// hostPower - returns the power management of the host claimed by a machine, nil is returned if the machine
+// hasn't claimed a host or the host doesn't have a BMC. The credentials are read from the username and password
+// keys of the Secret named by the BMC.
+func (r *PlunderMachineReconciler) hostPower(ctx context.Context, plunderMachine *infrav1.PlunderMachine) (power.Interface, error) {
+	if plunderMachine.Status.HostRef == nil {
+		return nil, nil
+	}
+	host := &infrav1.PlunderHost{}
+	if err := r.Get(ctx, hostKey(plunderMachine), host); err != nil {
+		return nil, err
+	}
+	if !hostHasBMC(host) {
+		return nil, nil
+	}
+
+	var creds power.Credentials
+	if name := host.Spec.BMC.CredentialsName; name != "" {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: host.Namespace, Name: name}, secret); err != nil {
+			return nil, fmt.Errorf("Unable to read the BMC credentials of host %s [%v]", host.Name, err)
+		}
+		creds.Username = string(secret.Data["username"])
+		creds.Password = string(secret.Data["password"])
+	}
+	return newPowerClient(r.NewPowerClient, host.Spec.BMC.Address, creds, host.Spec.BMC.DisableCertificateVerification)
+}
+
+// bmcCall - makes a single request to a BMC, with its own powerCallTimeout
+func bmcCall(call func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), powerCallTimeout)
+	defer cancel()
+	return call(ctx)
+}
+
+// powerOnHost - makes the host of a machine PXE boot its deployment, a host that is off is powered on and a host
+// that is already on is reset. Hosts without a BMC are left to PXE boot by themselves. A failure is recorded in
+// the OSProvisioned condition and returned, so that the host is powered on again by a later reconcile (a host
+// that has been recycled is powered off and will never PXE boot by itself).
+func (r *PlunderMachineReconciler) powerOnHost(log logr.Logger, plunderMachine *infrav1.PlunderMachine) error {
+	bmc, err := r.hostPower(context.TODO(), plunderMachine)
+	if err == nil && bmc == nil {
+		return nil
+	}
+	var state power.State
+	if err == nil {
+		err = bmcCall(bmc.SetPXEBoot)
+	}
+	if err == nil {
+		err = bmcCall(func(ctx context.Context) (err error) {
+			state, err = bmc.PowerState(ctx)
+			return err
+		})
+	}
+	if err == nil {
+		if state == power.StateOff {
+			err = bmcCall(bmc.PowerOn)
+		} else {
+			err = bmcCall(bmc.Reset)
+		}
+	}
+	if err != nil {
+		log.Info(fmt.Sprintf("Unable to power on the host through its BMC [%v], retrying in %s", err, powerOnRetry))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PowerManagement", "Unable to power on the host through its BMC [%v], retrying in %s", err, powerOnRetry)
+		setMachineCondition(plunderMachine, infrav1.ConditionOSProvisioned, corev1.ConditionFalse, reasonPowerOnFailed, "Unable to power on the host through its BMC [%v], retrying in %s", err, powerOnRetry)
+		return err
+	}
+
+	now := metav1.Now()
+	plunderMachine.Status.Deployment.LastPowerReset = &now
+	log.Info(fmt.Sprintf("Host was %s, it has been PXE booted through its BMC", state))
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PowerManagement", "The host has been PXE booted through its BMC")
+	return nil
+}
+
+// resetStuckHost - hard resets the host of a machine whose Operating System hasn't come up within powerResetAfter
+// of it being booted, so that a hung host installs again. A host is reset at most powerResetLimit times.
+func (r *PlunderMachineReconciler) resetStuckHost(log logr.Logger, plunderMachine *infrav1.PlunderMachine) {
+	d := plunderMachine.Status.Deployment
+	if d == nil || d.PowerResets >= powerResetLimit {
+		return
+	}
+	booted := d.LastPowerReset
+	if booted == nil {
+		booted = plunderMachine.Status.LastPhaseTransition
+	}
+	if booted == nil || time.Since(booted.Time) < powerResetAfter {
+		return
+	}
+
+	bmc, err := r.hostPower(context.TODO(), plunderMachine)
+	if err == nil && bmc == nil {
+		return
+	}
+	if err == nil {
+		err = bmcCall(bmc.SetPXEBoot)
+	}
+	if err == nil {
+		err = bmcCall(bmc.Reset)
+	}
+	if err != nil {
+		log.Info(fmt.Sprintf("Unable to reset the host through its BMC [%v]", err))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PowerManagement", "Unable to reset the host through its BMC [%v]", err)
+		return
+	}
+
+	now := metav1.Now()
+	d.PowerResets++
+	d.LastPowerReset = &now
+	message := fmt.Sprintf("The Operating System wasn't up %s after the host booted, it has been reset through its BMC (%d of %d)", powerResetAfter, d.PowerResets, powerResetLimit)
+	log.Info(message)
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PowerReset", message)
+}
+
+// powerOffHost - powers off the host of a deprovisioned machine through its BMC, it returns true if the host has
+// been powered off. A host that can't be powered off is left to reboot.
+func (r *PlunderMachineReconciler) powerOffHost(log logr.Logger, plunderMachine *infrav1.PlunderMachine) bool {
+	bmc, err := r.hostPower(context.TODO(), plunderMachine)
+	if err == nil && bmc == nil {
+		return false
+	}
+	if err == nil {
+		err = bmcCall(bmc.PowerOff)
+	}
+	if err != nil {
+		log.Info(fmt.Sprintf("Unable to power off the host through its BMC [%v]", err))
+		r.Recorder.Eventf(plunderMachine, corev1.EventTypeWarning, "PowerManagement", "Unable to power off the host through its BMC [%v]", err)
+		return false
+	}
+
+	log.Info("Host has been powered off through its BMC")
+	r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PowerManagement", "The host has been powered off through its BMC")
+	return true
+}
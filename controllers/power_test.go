@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/power"
+	corev1 "k8s.io/api/core/v1"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// fakePower is the BMC of a host, it records the calls made to it and the longest time a call was allowed
+type fakePower struct {
+	mu          sync.Mutex
+	state       power.State
+	calls       []string
+	longest     time.Duration
+	failPowerOn error
+}
+
+func (p *fakePower) record(ctx context.Context, call string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call)
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		// A call without a deadline could wait forever
+		p.longest = time.Duration(math.MaxInt64)
+	} else if d := time.Until(deadline); d > p.longest {
+		p.longest = d
+	}
+}
+
+func (p *fakePower) PowerState(ctx context.Context) (power.State, error) {
+	p.record(ctx, "PowerState")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, nil
+}
+
+func (p *fakePower) PowerOn(ctx context.Context) error {
+	p.record(ctx, "PowerOn")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failPowerOn != nil {
+		return p.failPowerOn
+	}
+	p.state = power.StateOn
+	return nil
+}
+
+func (p *fakePower) PowerOff(ctx context.Context) error {
+	p.record(ctx, "PowerOff")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = power.StateOff
+	return nil
+}
+
+func (p *fakePower) Reset(ctx context.Context) error {
+	p.record(ctx, "Reset")
+	return nil
+}
+
+func (p *fakePower) SetPXEBoot(ctx context.Context) error {
+	p.record(ctx, "SetPXEBoot")
+	return nil
+}
+
+// poweredOff - returns true if the host has been powered off
+func (p *fakePower) poweredOff() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, call := range p.calls {
+		if call == "PowerOff" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPowerOffDeletedHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		bmc        bool
+		policy     infrav1.DeprovisionPolicy
+		poweredOff bool
+		state      infrav1.HostState
+	}{
+		{name: "Quick", bmc: true, policy: infrav1.DeprovisionPolicy{Mode: infrav1.DeprovisionModeQuick}, poweredOff: true, state: infrav1.HostStateAvailable},
+		{name: "None", bmc: true, policy: infrav1.DeprovisionPolicy{Mode: infrav1.DeprovisionModeNone}, poweredOff: true, state: infrav1.HostStateAvailable},
+		{name: "SkipReboot", bmc: true, policy: infrav1.DeprovisionPolicy{Mode: infrav1.DeprovisionModeQuick, SkipReboot: true}, poweredOff: true, state: infrav1.HostStateAvailable},
+		{name: "WithoutBMC", policy: infrav1.DeprovisionPolicy{Mode: infrav1.DeprovisionModeQuick}, state: infrav1.HostStateDeprovisioning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+				policy := tt.policy
+				pm.Spec.Deprovision = &policy
+				host.Labels = map[string]string{infrav1.HostDiscoveredLabel: "true"}
+				if tt.bmc {
+					host.Spec.BMC = &infrav1.BMCDetails{Address: "redfish://bmc-0"}
+				}
+			})
+			bmc := &fakePower{state: power.StateOff}
+			m.r.NewPowerClient = func(address string, creds power.Credentials, insecure bool) (power.Interface, error) {
+				return bmc, nil
+			}
+
+			m.deleted()
+			m.reconcile()
+			m.plunder.SetParlayState(testMachineIP, "Completed")
+			m.reconcile()
+			if !m.removed() {
+				t.Fatal("the machine wasn't removed")
+			}
+			if bmc.poweredOff() != tt.poweredOff {
+				t.Errorf("expected the host to be powered off %t, got %t (%v)", tt.poweredOff, bmc.poweredOff(), bmc.calls)
+			}
+			if state := m.host().Status.State; state != tt.state {
+				t.Errorf("expected host-0 to be %s, got %s", tt.state, state)
+			}
+		})
+	}
+}
+
+func TestPowerOnRetry(t *testing.T) {
+	m := newMachineTest(t, func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost) {
+		host.Spec.BMC = &infrav1.BMCDetails{Address: "redfish://bmc-0"}
+	})
+	bmc := &fakePower{state: power.StateOff, failPowerOn: errors.New("the BMC is busy")}
+	m.r.NewPowerClient = func(address string, creds power.Credentials, insecure bool) (power.Interface, error) {
+		return bmc, nil
+	}
+
+	// The recycled host is powered off, so a failed power on is recorded and tried again
+	result := m.reconcileUntil(infrav1.MachinePhaseOSDeploying)
+	if result.RequeueAfter != powerOnRetry {
+		t.Errorf("expected a requeue after %s, got %+v", powerOnRetry, result)
+	}
+	if status, reason := m.condition(infrav1.ConditionOSProvisioned); status != corev1.ConditionFalse || reason != reasonPowerOnFailed {
+		t.Fatalf("expected OSProvisioned to be False (%s), got %s (%s)", reasonPowerOnFailed, status, reason)
+	}
+	result = m.reconcile()
+	if result.RequeueAfter != powerOnRetry || m.machine().Status.Deployment.LastPowerReset != nil {
+		t.Fatalf("the host should still be waiting to be powered on, got %+v", result)
+	}
+
+	bmc.mu.Lock()
+	bmc.failPowerOn = nil
+	bmc.mu.Unlock()
+	m.reconcile()
+	pm := m.machine()
+	if bmc.state != power.StateOn || pm.Status.Deployment.LastPowerReset == nil {
+		t.Fatalf("the host wasn't powered on once the BMC answered: %v", bmc.calls)
+	}
+	if _, reason := m.condition(infrav1.ConditionOSProvisioned); reason == reasonPowerOnFailed {
+		t.Error("the power on failure is still recorded")
+	}
+	if bmc.longest > powerCallTimeout {
+		t.Errorf("a call to the BMC was allowed %s, more than %s", bmc.longest, powerCallTimeout)
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder/fake"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+const (
+	testNamespace  = "default"
+	testMachineMAC = "00:50:56:a5:b5:f1"
+	testMachineIP  = "192.168.1.10"
+)
+
+// machineTest is a PlunderMachine reconciled against a fake API server and a fake Plunder server
+type machineTest struct {
+	t        *testing.T
+	k8s      *apiServer
+	plunder  *fake.Server
+	recorder *record.FakeRecorder
+	r        *PlunderMachineReconciler
+	key      types.NamespacedName
+}
+
+// newMachineTest - creates a cluster with a single cloud-init PlunderMachine and a PlunderHost for it to claim,
+// the objects can be changed before they are created with modify
+func newMachineTest(t *testing.T, modify func(pm *infrav1.PlunderMachine, host *infrav1.PlunderHost)) *machineTest {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cluster"},
+		Spec: clusterv1.ClusterSpec{
+			ClusterNetwork:    &clusterv1.ClusterNetwork{Pods: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.244.0.0/16"}}},
+			InfrastructureRef: &corev1.ObjectReference{Name: "cluster"},
+		},
+	}
+	data := base64.StdEncoding.EncodeToString([]byte("#cloud-config"))
+	version := "v1.16.2"
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "machine-0",
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: "cluster"},
+		},
+		Spec: clusterv1.MachineSpec{
+			Bootstrap:         clusterv1.Bootstrap{Data: &data},
+			InfrastructureRef: corev1.ObjectReference{Kind: "PlunderMachine", Name: "plundermachine-0"},
+			Version:           &version,
+		},
+	}
+	plunderCluster := &infrav1.PlunderCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cluster"},
+	}
+	ipAddress := testMachineIP
+	pm := &infrav1.PlunderMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "plundermachine-0",
+			UID:       "plundermachine-0-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: machine.Name},
+			},
+		},
+		Spec: infrav1.PlunderMachineSpec{
+			IPAddress:     &ipAddress,
+			BootstrapMode: infrav1.BootstrapModeCloudInit,
+		},
+	}
+	host := &infrav1.PlunderHost{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "host-0"},
+		Spec:       infrav1.PlunderHostSpec{MACAddress: testMachineMAC},
+	}
+	if modify != nil {
+		modify(pm, host)
+	}
+
+	s := fake.NewServer()
+	s.AutoComplete = true
+	recorder := record.NewFakeRecorder(1000)
+	k8s := newAPIServer(scheme, cluster, machine, plunderCluster, pm, host)
+	return &machineTest{
+		t:        t,
+		k8s:      k8s,
+		plunder:  s,
+		recorder: recorder,
+		r: &PlunderMachineReconciler{
+			Client:           k8s,
+			Log:              zap.LoggerTo(ioutil.Discard, true),
+			Recorder:         recorder,
+			NewPlunderClient: s.NewClient,
+		},
+		key: types.NamespacedName{Namespace: testNamespace, Name: pm.Name},
+	}
+}
+
+// reconcile - reconciles the PlunderMachine once, failing the test if an error is returned
+func (m *machineTest) reconcile() ctrl.Result {
+	m.t.Helper()
+	result, err := m.r.Reconcile(ctrl.Request{NamespacedName: m.key})
+	if err != nil {
+		m.t.Fatalf("reconcile failed [%v]", err)
+	}
+	return result
+}
+
+// reconcileUntil - reconciles the PlunderMachine until it reaches a phase, failing the test if it takes more than
+// a few reconciles
+func (m *machineTest) reconcileUntil(phase infrav1.MachinePhase) ctrl.Result {
+	m.t.Helper()
+	for i := 0; i < 10; i++ {
+		result := m.reconcile()
+		if m.machine().Status.Phase == phase {
+			return result
+		}
+	}
+	m.t.Fatalf("machine didn't reach the %s phase, it is %s", phaseName(phase), phaseName(m.machine().Status.Phase))
+	return ctrl.Result{}
+}
+
+// machine - returns the PlunderMachine as it is stored in the API server
+func (m *machineTest) machine() *infrav1.PlunderMachine {
+	m.t.Helper()
+	pm := &infrav1.PlunderMachine{}
+	if err := m.k8s.Get(context.TODO(), m.key, pm); err != nil {
+		m.t.Fatal(err)
+	}
+	return pm
+}
+
+// removed - returns true once the PlunderMachine has been removed from the API server
+func (m *machineTest) removed() bool {
+	m.t.Helper()
+	err := m.k8s.Get(context.TODO(), m.key, &infrav1.PlunderMachine{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		m.t.Fatal(err)
+	}
+	return apierrors.IsNotFound(err)
+}
+
+// update - changes the PlunderMachine stored in the API server, other than its status
+func (m *machineTest) update(modify func(pm *infrav1.PlunderMachine)) {
+	m.t.Helper()
+	pm := m.machine()
+	modify(pm)
+	if err := m.k8s.Update(context.TODO(), pm); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// updateStatus - changes the status of the PlunderMachine stored in the API server
+func (m *machineTest) updateStatus(modify func(pm *infrav1.PlunderMachine)) {
+	m.t.Helper()
+	pm := m.machine()
+	modify(pm)
+	if err := m.k8s.Status().Update(context.TODO(), pm); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// host - returns the PlunderHost as it is stored in the API server
+func (m *machineTest) host() *infrav1.PlunderHost {
+	m.t.Helper()
+	host := &infrav1.PlunderHost{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "host-0"}, host); err != nil {
+		m.t.Fatal(err)
+	}
+	return host
+}
+
+// condition - returns the status and reason of a condition of the PlunderMachine
+func (m *machineTest) condition(t infrav1.ConditionType) (corev1.ConditionStatus, string) {
+	m.t.Helper()
+	cond := infrav1.FindCondition(m.machine().Status.Conditions, t)
+	if cond == nil {
+		return "", ""
+	}
+	return cond.Status, cond.Reason
+}
+
+// other - returns the test for another PlunderMachine of the cluster, reconciled against the same servers
+func (m *machineTest) other(name string) *machineTest {
+	o := *m
+	o.key = types.NamespacedName{Namespace: testNamespace, Name: name}
+	return &o
+}
+
+// addMachine - adds a Machine (and its PlunderMachine) to the cluster that installs Kubernetes with parlay, along
+// with a PlunderHost for it to claim. The test for the new PlunderMachine is returned.
+func (m *machineTest) addMachine(index int, ipAddress, macAddress string, controlPlane bool) *machineTest {
+	m.t.Helper()
+	version := "v1.16.2"
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      fmt.Sprintf("machine-%d", index),
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: "cluster"},
+		},
+		Spec: clusterv1.MachineSpec{
+			InfrastructureRef: corev1.ObjectReference{Kind: "PlunderMachine", Name: fmt.Sprintf("plundermachine-%d", index)},
+			Version:           &version,
+		},
+	}
+	if controlPlane {
+		machine.Labels[clusterv1.MachineControlPlaneLabelName] = "true"
+	}
+	pm := &infrav1.PlunderMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      fmt.Sprintf("plundermachine-%d", index),
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: machine.Name},
+			},
+		},
+		Spec: infrav1.PlunderMachineSpec{
+			IPAddress:     &ipAddress,
+			BootstrapMode: infrav1.BootstrapModeParlay,
+		},
+	}
+	host := &infrav1.PlunderHost{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: fmt.Sprintf("host-%d", index)},
+		Spec:       infrav1.PlunderHostSpec{MACAddress: macAddress},
+	}
+	for _, obj := range []runtime.Object{machine, pm, host} {
+		if err := m.k8s.store(obj); err != nil {
+			m.t.Fatal(err)
+		}
+	}
+	return m.other(pm.Name)
+}
+
+// setControlPlane - makes machine-0 a control plane machine that installs Kubernetes with parlay
+func (m *machineTest) setControlPlane() {
+	m.t.Helper()
+	machine := &clusterv1.Machine{}
+	if err := m.k8s.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: "machine-0"}, machine); err != nil {
+		m.t.Fatal(err)
+	}
+	machine.Labels[clusterv1.MachineControlPlaneLabelName] = "true"
+	machine.Spec.Bootstrap.Data = nil
+	if err := m.k8s.Update(context.TODO(), machine); err != nil {
+		m.t.Fatal(err)
+	}
+	m.update(func(pm *infrav1.PlunderMachine) {
+		pm.Spec.BootstrapMode = infrav1.BootstrapModeParlay
+	})
+}
+
+// events - returns the events that have been recorded since it was last called
+func (m *machineTest) events() []string {
+	var events []string
+	for {
+		select {
+		case e := <-m.recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
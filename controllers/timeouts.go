@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	capierrors "sigs.k8s.io/cluster-api/errors"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+// maxPollInterval is the longest that a machine will wait between checks on the Plunder server
+const maxPollInterval = 2 * time.Minute
+
+// PhaseTimeouts are how long each phase of provisioning can take when the PlunderMachine doesn't set its own
+// timeouts, a timeout of zero means there is no limit
+type PhaseTimeouts struct {
+	// HardwareClaim is how long a machine can wait for a free PlunderHost
+	HardwareClaim time.Duration
+
+	// OSDeploy is how long the Operating System can take to be installed
+	OSDeploy time.Duration
+
+	// KubernetesInstall is how long the installation of Kubernetes can take
+	KubernetesInstall time.Duration
+
+	// Drain is how long the node of a deleted machine can take to be drained
+	Drain time.Duration
+}
+
+// DefaultPhaseTimeouts are the timeouts used when the controller isn't given any
+var DefaultPhaseTimeouts = PhaseTimeouts{
+	OSDeploy:          time.Hour,
+	KubernetesInstall: 30 * time.Minute,
+	Drain:             10 * time.Minute,
+}
+
+// phaseTimeout - returns how long a machine can spend in its current phase and how long it has spent in it, a
+// timeout of zero means the phase has no limit
+func phaseTimeout(plunderMachine *infrav1.PlunderMachine, defaults PhaseTimeouts) (timeout, elapsed time.Duration) {
+	t := plunderMachine.Spec.Timeouts
+	if t == nil {
+		t = &infrav1.ProvisioningTimeouts{}
+	}
+
+	switch plunderMachine.Status.Phase {
+	case infrav1.MachinePhasePending:
+		timeout = defaults.HardwareClaim
+		if t.HardwareClaim != nil {
+			timeout = t.HardwareClaim.Duration
+		}
+		// A machine starts pending, so the time is counted from when it was created
+		if plunderMachine.Status.LastPhaseTransition == nil {
+			return timeout, time.Since(plunderMachine.CreationTimestamp.Time)
+		}
+	case infrav1.MachinePhaseOSDeploying:
+		timeout = defaults.OSDeploy
+		if t.OSDeploy != nil {
+			timeout = t.OSDeploy.Duration
+		}
+	case infrav1.MachinePhaseKubernetesInstalling:
+		timeout = defaults.KubernetesInstall
+		if t.KubernetesInstall != nil {
+			timeout = t.KubernetesInstall.Duration
+		}
+	}
+	return timeout, phaseDuration(plunderMachine)
+}
+
+// drainTimeout - returns how long the node of a deleted machine can take to be drained, a timeout of zero means
+// there is no limit
+func drainTimeout(plunderMachine *infrav1.PlunderMachine, defaults PhaseTimeouts) time.Duration {
+	if t := plunderMachine.Spec.Timeouts; t != nil && t.Drain != nil {
+		return t.Drain.Duration
+	}
+	return defaults.Drain
+}
+
+// pollInterval - returns how long to wait before checking on a machine again, the wait starts at base and doubles
+// with each check made during the phase (up to maxPollInterval) so that slow installations are checked less often.
+// The checks are counted from the time spent in the phase (as if each had waited the full interval) rather than
+// stored, so reconciles caused by watches don't speed up the backoff and it survives a restart of the controller.
+// The wait never passes the end of the phase timeout, so that an expired phase is noticed straight away.
+func pollInterval(plunderMachine *infrav1.PlunderMachine, defaults PhaseTimeouts, base time.Duration) time.Duration {
+	timeout, elapsed := phaseTimeout(plunderMachine, defaults)
+
+	wait := base
+	for waited := wait; waited <= elapsed && wait < maxPollInterval; waited += wait {
+		wait *= 2
+	}
+	if wait > maxPollInterval {
+		wait = maxPollInterval
+	}
+	if timeout != 0 && elapsed < timeout && timeout-elapsed < wait {
+		wait = timeout - elapsed + time.Second
+	}
+	return wait
+}
+
+// phaseName - returns the name of a phase for messages
+func phaseName(phase infrav1.MachinePhase) string {
+	if phase == infrav1.MachinePhasePending {
+		return "Pending"
+	}
+	return string(phase)
+}
+
+// setMachineFailure - marks provisioning of a machine as failed, the failure is terminal and the machine will need
+// to be removed
+func setMachineFailure(plunderMachine *infrav1.PlunderMachine, reason capierrors.MachineStatusError, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	plunderMachine.Status.FailureReason = &reason
+	plunderMachine.Status.FailureMessage = &message
+	plunderMachine.Status.ErrorReason = &reason
+	plunderMachine.Status.ErrorMessage = &message
+	setMachinePhase(plunderMachine, infrav1.MachinePhaseFailed)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
+)
+
+func TestPollInterval(t *testing.T) {
+	defaults := PhaseTimeouts{OSDeploy: time.Hour}
+	base := 15 * time.Second
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{name: "first check", elapsed: 0, want: base},
+		{name: "before the first check", elapsed: 10 * time.Second, want: base},
+		{name: "second check", elapsed: 15 * time.Second, want: 30 * time.Second},
+		{name: "third check", elapsed: 45 * time.Second, want: time.Minute},
+		{name: "fourth check", elapsed: 105 * time.Second, want: maxPollInterval},
+		{name: "capped", elapsed: 40 * time.Minute, want: maxPollInterval},
+		{name: "end of the timeout", elapsed: 59 * time.Minute, want: time.Minute + time.Second},
+		{name: "no timeout", elapsed: 59 * time.Minute, timeout: -1, want: maxPollInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &infrav1.PlunderMachine{}
+			pm.Status.Phase = infrav1.MachinePhaseOSDeploying
+			pm.Status.LastPhaseTransition = &metav1.Time{Time: time.Now().Add(-tt.elapsed)}
+			if tt.timeout < 0 {
+				pm.Spec.Timeouts = &infrav1.ProvisioningTimeouts{OSDeploy: &metav1.Duration{}}
+			}
+			if got := pollInterval(pm, defaults, base); got != tt.want {
+				t.Errorf("after %s expected to wait %s, got %s", tt.elapsed, tt.want, got)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@ package controllers
 import (
 	"math/rand"
 	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyz" +
@@ -19,3 +23,12 @@ func StringWithCharset(length int, charset string) string {
 	}
 	return string(b)
 }
+
+// ignoreRemoved - drops the not found errors from patching an object that has been deleted, once the last finalizer
+// of a deleted object is removed it is gone and its status can no longer be written
+func ignoreRemoved(err error, obj metav1.Object) error {
+	if obj.GetDeletionTimestamp() == nil || len(obj.GetFinalizers()) != 0 {
+		return err
+	}
+	return kerrors.FilterOut(err, apierrors.IsNotFound)
+}
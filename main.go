@@ -19,11 +19,13 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/plunder-app/cluster-api-plunder/pkg/record"
 
 	infrastructurev1alpha1 "github.com/plunder-app/cluster-api-plunder/api/v1alpha1"
 	"github.com/plunder-app/cluster-api-plunder/controllers"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -31,6 +33,7 @@ import (
 	"k8s.io/klog/klogr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -51,9 +54,30 @@ func main() {
 
 	var metricsAddr string
 	var enableLeaderElection bool
+	var machineConcurrency int
+	var hostNamespace string
+	var hostDiscoveryInterval time.Duration
+	var plunderConfig string
+	timeouts := controllers.DefaultPhaseTimeouts
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&machineConcurrency, "plundermachine-concurrency", 10,
+		"Number of PlunderMachines to process simultaneously")
+	flag.StringVar(&hostNamespace, "host-namespace", "default",
+		"The namespace that discovered PlunderHosts are created in, PlunderMachines in any namespace can claim them")
+	flag.DurationVar(&hostDiscoveryInterval, "host-discovery-interval", time.Minute,
+		"How often the Plunder server is checked for new hosts")
+	flag.StringVar(&plunderConfig, "plunder-config", plunder.DefaultConfigPath,
+		"The Plunder client configuration used for clusters that don't reference a PlunderServer")
+	flag.DurationVar(&timeouts.HardwareClaim, "hardware-claim-timeout", timeouts.HardwareClaim,
+		"How long a PlunderMachine can wait for a free PlunderHost, 0 waits forever")
+	flag.DurationVar(&timeouts.OSDeploy, "os-deploy-timeout", timeouts.OSDeploy,
+		"How long the Operating System can take to be installed, 0 waits forever")
+	flag.DurationVar(&timeouts.KubernetesInstall, "kubernetes-install-timeout", timeouts.KubernetesInstall,
+		"How long the installation of Kubernetes can take, 0 waits forever")
+	flag.DurationVar(&timeouts.Drain, "drain-timeout", timeouts.Drain,
+		"How long the node of a deleted machine can take to be drained, 0 waits forever")
 	flag.Parse()
 
 	ctrl.SetLogger(klogr.New())
@@ -71,21 +95,63 @@ func main() {
 	// Initialize event recorder.
 	record.InitFromRecorder(mgr.GetEventRecorderFor("plunder-controller"))
 
+	// The connections to the Plunder servers are shared by all of the controllers
+	plunderClients := &controllers.PlunderClients{
+		Client:     mgr.GetClient(),
+		ConfigPath: plunderConfig,
+	}
+
 	if err = (&controllers.PlunderClusterReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("PlunderCluster"),
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("PlunderCluster"),
+		NewPlunderClient: plunderClients.NewClient,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PlunderCluster")
 		os.Exit(1)
 	}
 	if err = (&controllers.PlunderMachineReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("PlunderMachine"),
-		Recorder: mgr.GetEventRecorderFor("plunder-controller"),
-	}).SetupWithManager(mgr); err != nil {
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("PlunderMachine"),
+		Recorder:         mgr.GetEventRecorderFor("plunder-controller"),
+		NewPlunderClient: plunderClients.NewClient,
+		Timeouts:         timeouts,
+		HostNamespace:    hostNamespace,
+	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: machineConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PlunderMachine")
 		os.Exit(1)
 	}
+	if err = (&controllers.PlunderHostReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("PlunderHost"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PlunderHost")
+		os.Exit(1)
+	}
+	if err = (&controllers.PlunderIPPoolReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("PlunderIPPool"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PlunderIPPool")
+		os.Exit(1)
+	}
+	if err = (&controllers.HostDiscovery{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("HostDiscovery"),
+		Namespace:        hostNamespace,
+		Interval:         hostDiscoveryInterval,
+		NewPlunderClient: plunderClients.NewClient,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create host discovery")
+		os.Exit(1)
+	}
+	if err = (&controllers.PlunderServerReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("PlunderServer"),
+		NewPlunderClient: plunderClients.NewClient,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PlunderServer")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
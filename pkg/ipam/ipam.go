@@ -0,0 +1,192 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrPoolExhausted is returned when every address in a pool is in use
+var ErrPoolExhausted = fmt.Errorf("No free addresses are left in the pool")
+
+// Range is an inclusive range of addresses
+type Range struct {
+	Start string
+	End   string
+}
+
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+// Pool is a set of addresses that can be allocated
+type Pool struct {
+	network    *net.IPNet
+	ranges     []ipRange
+	exclusions []*net.IPNet
+}
+
+// NewPool - creates a pool from a CIDR, if no ranges are passed then every host address in the CIDR can be
+// allocated. Exclusions can be either single addresses or CIDRs, the IPv4 network and broadcast addresses are
+// always excluded.
+func NewPool(cidr string, ranges []Range, exclusions []string) (*Pool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CIDR [%s]", cidr)
+	}
+	p := &Pool{network: network}
+
+	for _, r := range ranges {
+		start, end := net.ParseIP(r.Start), net.ParseIP(r.End)
+		if start == nil || end == nil {
+			return nil, fmt.Errorf("Invalid range [%s-%s]", r.Start, r.End)
+		}
+		start, end = normalize(start), normalize(end)
+		if !network.Contains(start) || !network.Contains(end) || bytes.Compare(start, end) > 0 {
+			return nil, fmt.Errorf("Range [%s-%s] isn't within %s", r.Start, r.End, cidr)
+		}
+		p.ranges = append(p.ranges, ipRange{start: start, end: end})
+	}
+
+	// Without any ranges every address in the network is used
+	if len(p.ranges) == 0 {
+		p.ranges = append(p.ranges, ipRange{start: firstAddress(network), end: lastAddress(network)})
+	}
+
+	// The network and broadcast addresses of an IPv4 network are never allocated, even if a range includes them
+	// (point to point /31 and single address /32 networks don't have them)
+	if network.IP.To4() != nil {
+		if ones, bits := network.Mask.Size(); bits-ones > 1 {
+			for _, ip := range []net.IP{firstAddress(network), lastAddress(network)} {
+				p.exclusions = append(p.exclusions, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		}
+	}
+
+	for _, e := range exclusions {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid exclusion [%s]", e)
+			}
+			ip = normalize(ip)
+			p.exclusions = append(p.exclusions, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, excluded, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid exclusion [%s]", e)
+		}
+		p.exclusions = append(p.exclusions, excluded)
+	}
+	return p, nil
+}
+
+// Contains - returns true if the address can be allocated from the pool
+func (p *Pool) Contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	ip = normalize(ip)
+	for _, e := range p.exclusions {
+		if e.Contains(ip) {
+			return false
+		}
+	}
+	for _, r := range p.ranges {
+		if bytes.Compare(ip, r.start) >= 0 && bytes.Compare(ip, r.end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Next - returns the first address in the pool that isn't in use
+func (p *Pool) Next(inUse map[string]bool) (string, error) {
+	for _, r := range p.ranges {
+		for ip := r.start; bytes.Compare(ip, r.end) <= 0; ip = next(ip) {
+			address := ip.String()
+			if !inUse[address] && p.Contains(address) {
+				return address, nil
+			}
+			// Wrapped around the end of the address space
+			if ip.Equal(r.end) {
+				break
+			}
+		}
+	}
+	return "", ErrPoolExhausted
+}
+
+// Netmask - returns the mask of the pool network in the dotted form (IPv4) or as a prefix length (IPv6)
+func (p *Pool) Netmask() string {
+	if len(p.network.Mask) == net.IPv4len {
+		return net.IP(p.network.Mask).String()
+	}
+	ones, _ := p.network.Mask.Size()
+	return fmt.Sprintf("%d", ones)
+}
+
+// normalize - returns IPv4 addresses in their 4 byte form so they can be compared with network addresses
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+func firstAddress(network *net.IPNet) net.IP {
+	return normalize(network.IP.Mask(network.Mask))
+}
+
+func lastAddress(network *net.IPNet) net.IP {
+	first := firstAddress(network)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	return last
+}
+
+func next(ip net.IP) net.IP {
+	n := make(net.IP, len(ip))
+	copy(n, ip)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+func prev(ip net.IP) net.IP {
+	n := make(net.IP, len(ip))
+	copy(n, ip)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]--
+		if n[i] != 0xff {
+			break
+		}
+	}
+	return n
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam_test
+
+import (
+	"testing"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/ipam"
+)
+
+func TestNewPoolInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidr       string
+		ranges     []ipam.Range
+		exclusions []string
+	}{
+		{name: "bad CIDR", cidr: "192.168.1.0"},
+		{name: "bad CIDR prefix", cidr: "192.168.1.0/33"},
+		{name: "bad range address", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1", End: "192.168.1.20"}}},
+		{name: "range outside the CIDR", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.10", End: "192.168.2.20"}}},
+		{name: "range backwards", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.20", End: "192.168.1.10"}}},
+		{name: "bad exclusion address", cidr: "192.168.1.0/24", exclusions: []string{"192.168.1.300"}},
+		{name: "bad exclusion CIDR", cidr: "192.168.1.0/24", exclusions: []string{"192.168.1.0/40"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ipam.NewPool(tt.cidr, tt.ranges, tt.exclusions); err == nil {
+				t.Error("expected the pool to be rejected")
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidr       string
+		ranges     []ipam.Range
+		exclusions []string
+		inUse      []string
+		want       string
+		exhausted  bool
+	}{
+		{name: "first host address", cidr: "192.168.1.0/29", want: "192.168.1.1"},
+		{name: "skips addresses in use", cidr: "192.168.1.0/29", inUse: []string{"192.168.1.1", "192.168.1.2"}, want: "192.168.1.3"},
+		{name: "last host address", cidr: "192.168.1.0/29", inUse: []string{"192.168.1.1", "192.168.1.2", "192.168.1.3", "192.168.1.4", "192.168.1.5"}, want: "192.168.1.6"},
+		{name: "broadcast address isn't allocated", cidr: "192.168.1.0/29", inUse: []string{"192.168.1.1", "192.168.1.2", "192.168.1.3", "192.168.1.4", "192.168.1.5", "192.168.1.6"}, exhausted: true},
+		{name: "range start", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.100", End: "192.168.1.102"}}, want: "192.168.1.100"},
+		{name: "range end", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.100", End: "192.168.1.102"}}, inUse: []string{"192.168.1.100", "192.168.1.101"}, want: "192.168.1.102"},
+		{name: "range exhausted", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.100", End: "192.168.1.102"}}, inUse: []string{"192.168.1.100", "192.168.1.101", "192.168.1.102"}, exhausted: true},
+		{name: "second range", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.10", End: "192.168.1.10"}, {Start: "192.168.1.20", End: "192.168.1.21"}}, inUse: []string{"192.168.1.10"}, want: "192.168.1.20"},
+		{name: "range including the network address", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.0", End: "192.168.1.5"}}, want: "192.168.1.1"},
+		{name: "range including the broadcast address", cidr: "192.168.1.0/24", ranges: []ipam.Range{{Start: "192.168.1.254", End: "192.168.1.255"}}, inUse: []string{"192.168.1.254"}, exhausted: true},
+		{name: "single exclusion", cidr: "192.168.1.0/29", exclusions: []string{"192.168.1.1"}, want: "192.168.1.2"},
+		{name: "CIDR exclusion", cidr: "192.168.1.0/29", exclusions: []string{"192.168.1.0/30"}, want: "192.168.1.4"},
+		{name: "everything excluded", cidr: "192.168.1.0/29", exclusions: []string{"192.168.1.0/29"}, exhausted: true},
+		{name: "point to point network", cidr: "192.168.1.0/31", inUse: []string{"192.168.1.0"}, want: "192.168.1.1"},
+		{name: "single address network", cidr: "192.168.1.5/32", want: "192.168.1.5"},
+		{name: "IPv6", cidr: "fd00::/126", exclusions: []string{"fd00::"}, inUse: []string{"fd00::1"}, want: "fd00::2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ipam.NewPool(tt.cidr, tt.ranges, tt.exclusions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inUse := map[string]bool{}
+			for _, a := range tt.inUse {
+				inUse[a] = true
+			}
+			got, err := p.Next(inUse)
+			if tt.exhausted {
+				if err != ipam.ErrPoolExhausted {
+					t.Errorf("expected the pool to be exhausted, got %q (%v)", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	p, err := ipam.NewPool("192.168.1.0/24", []ipam.Range{{Start: "192.168.1.0", End: "192.168.1.20"}}, []string{"192.168.1.5", "192.168.1.16/30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, want := range map[string]bool{
+		"192.168.1.0":  false,
+		"192.168.1.1":  true,
+		"192.168.1.5":  false,
+		"192.168.1.15": true,
+		"192.168.1.17": false,
+		"192.168.1.21": false,
+		"192.168.2.1":  false,
+		"not-an-ip":    false,
+	} {
+		if got := p.Contains(address); got != want {
+			t.Errorf("Contains(%s) = %t, expected %t", address, got, want)
+		}
+	}
+}
+
+func TestNetmask(t *testing.T) {
+	for cidr, want := range map[string]string{"192.168.1.0/24": "255.255.255.0", "10.0.0.0/20": "255.255.240.0", "fd00::/64": "64"} {
+		p, err := ipam.NewPool(cidr, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Netmask(); got != want {
+			t.Errorf("Netmask of %s = %s, expected %s", cidr, got, want)
+		}
+	}
+}
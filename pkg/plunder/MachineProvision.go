@@ -1,6 +1,7 @@
 package plunder
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,8 +13,16 @@ import (
 	"github.com/plunder-app/plunder/pkg/services"
 )
 
-// ProvisionMachine - will provision a new machine
-func (c *Client) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType string) (err error) {
+var (
+	// pollInitial is the first wait between checks of the parlay logs
+	pollInitial = 5 * time.Second
+
+	// pollMax is the longest wait between checks of the parlay logs
+	pollMax = time.Minute
+)
+
+// ProvisionMachine - will provision a new machine, the network configuration is optional
+func (c *Client) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType string, network *NetworkConfig) (err error) {
 
 	// define the deployment configuration options
 	d := services.DeploymentConfig{
@@ -24,11 +33,11 @@ func (c *Client) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType
 			ServerName: hostname,
 		},
 	}
+	network.applyHostConfig(ipAddress, &d.ConfigHost)
 
 	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "deployment", http.MethodPost)
-	if resp.Error != "" {
-		return fmt.Errorf(resp.Error)
-
+	if err := responseError(resp); err != nil {
+		return err
 	}
 
 	c.address.Path = ep.Path
@@ -42,158 +51,292 @@ func (c *Client) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType
 		return err
 	}
 	// If an error has been returned then handle the error gracefully and terminate
-	if response.FriendlyError != "" || response.Error != "" {
-		return fmt.Errorf(resp.Error)
-
+	if err := responseError(response); err != nil {
+		return err
 	}
 	return nil
 }
 
-// ProvisionMachineWait - This will watch the provisioning process
-func (c *Client) ProvisionMachineWait(ipAddress string) (result *string, err error) {
+// GetDeployment - will return the deployment for a MAC address if one exists on the plunder server, if the server
+// reports that there is no deployment then both the deployment and error will be nil. Any other error is returned,
+// so that a failed request isn't mistaken for a missing deployment.
+func (c *Client) GetDeployment(macAddress string) (*services.DeploymentConfig, error) {
+	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "deploymentID", http.MethodGet)
+	if err := responseError(resp); err != nil {
+		return nil, err
+	}
 
-	uptimeMap := uptimeCommand(ipAddress)
+	// The plunder API expects the MAC address with dashes instead of colons
+	id := strings.Replace(macAddress, ":", "-", -1)
+	c.address.Path = ep.Path + "/" + id
 
-	// Marshall the parlay submission (runs the uptime command)
-	b, err := json.Marshal(uptimeMap)
+	response, err := apiserver.ParsePlunderGet(c.address, c.server)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	// Create the string that will be used to get the logs
-	dashAddress := strings.Replace(ipAddress, ".", "-", -1)
+	if err := responseError(response); err != nil {
+		// Only a response saying that the deployment doesn't exist means there isn't one, any other error could
+		// be hiding a deployment that would be left behind
+		if deploymentNotFound(response, strings.Replace(id, "-", ":", -1)) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var d services.DeploymentConfig
+	err = json.Unmarshal(response.Payload, &d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// deploymentNotFound - returns true if the response to a request for the deployment of a MAC address says that it
+// doesn't exist. The Plunder API has no status code or error type for this (it answers 200 with only the error
+// set), so the exact message the server builds from the requested MAC address is matched.
+func deploymentNotFound(resp *apiserver.Response, macAddress string) bool {
+	return resp.FriendlyError == "" && len(resp.Payload) == 0 && resp.Error == fmt.Sprintf("Unable to find %s", macAddress)
+}
+
+// ProvisionMachineWait - This will watch the provisioning process, until the OS is up or the context ends. It is
+// the blocking form of ProvisionMachineStatus for callers that aren't driven by a reconcile loop, the controller
+// checks ProvisionMachineStatus once per reconcile instead.
+func (c *Client) ProvisionMachineWait(ctx context.Context, ipAddress string) (result *string, err error) {
 
 	// Get the time
 	t := time.Now()
 
-	for {
-		// Set Parlay API path and POST
-		ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlay", http.MethodPost)
-		if resp.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
+	err = poll(ctx, func() (bool, error) {
+		return c.ProvisionMachineStatus(ipAddress)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("The Operating System of [%s] wasn't provisioned after %s [%v]", ipAddress, time.Since(t).Round(time.Second), err)
+	}
 
-		}
-		c.address.Path = ep.Path
+	provisioningResult := fmt.Sprintf("Host has been succesfully provisioned OS in %s Seconds\n", time.Since(t).Round(time.Second))
+	return &provisioningResult, nil
+}
 
-		response, err := apiserver.ParsePlunderPost(c.address, c.server, b)
-		if err != nil {
-			return nil, err
+// ProvisionMachineStatus - will check (without blocking) if the OS provisioning has completed, if the OS isn't
+// available yet then a new test will be submitted so that the next check has an up to date result
+func (c *Client) ProvisionMachineStatus(ipAddress string) (complete bool, err error) {
+	logs, err := c.ParlayLogs(ipAddress)
+	if err == nil {
+		switch logs.State {
+		case "Completed":
+			return true, nil
+		case "Running":
+			// The previous test is still in progress
+			return false, nil
 		}
+	}
+	// There are no logs yet, or the previous test failed (the host isn't up yet) so submit a new test
+	return false, c.provisionMachineTest(ipAddress)
+}
 
-		// If an error has been returned then handle the error gracefully and terminate
-		if response.FriendlyError != "" || response.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
+// provisionMachineTest - submits the uptime command that is used to detect that the OS is up
+func (c *Client) provisionMachineTest(ipAddress string) error {
+	uptimeMap := uptimeCommand(ipAddress)
 
-		}
+	// Marshall the parlay submission (runs the uptime command)
+	b, err := json.Marshal(uptimeMap)
+	if err != nil {
+		return err
+	}
+	return c.parlaySubmit(b)
+}
+
+// ProvisionKubernetes = will handle all of the tasks associated with deploying Kubernetes, it waits until the
+// deployment has finished or the context ends. It is the blocking form of ProvisionKubernetesStart and
+// ProvisionKubernetesStatus for callers that aren't driven by a reconcile loop.
+func (c *Client) ProvisionKubernetes(ctx context.Context) (result *string, err error) {
 
-		// Sleep for five seconds
-		time.Sleep(5 * time.Second)
+	// Get the time
+	t := time.Now()
+	host := c.machineDeployment().Hosts[0]
 
-		// Set the parlay API get logs path and GET
-		ep, resp = apiserver.FindFunctionEndpoint(c.address, c.server, "parlayLog", http.MethodGet)
-		if resp.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
+	// Remove any logs from previous deployments so that their state isn't mistaken for this one
+	c.ParlayLogClear(host)
 
-		}
-		c.address.Path = ep.Path + "/" + dashAddress
+	err = c.ProvisionKubernetesStart()
+	if err != nil {
+		return nil, err
+	}
 
-		response, err = apiserver.ParsePlunderGet(c.address, c.server)
+	err = poll(ctx, func() (bool, error) {
+		state, err := c.ProvisionKubernetesStatus(host)
 		if err != nil {
-			return nil, err
+			return false, err
 		}
-		// If an error has been returned then handle the error gracefully and terminate
-		if response.FriendlyError != "" || response.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
-
+		switch state {
+		case "Completed":
+			return true, nil
+		case "Failed":
+			if failure, err := c.ProvisionKubernetesFailure(host); err == nil && failure != nil {
+				return false, fmt.Errorf("The action [%s] has failed: %s", failure.Action, failure.Output)
+			}
+			return false, fmt.Errorf("The deployment has failed")
 		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Task has failed after %s [%v]", time.Since(t).Round(time.Second), err)
+	}
 
-		var logs plunderlogging.JSONLog
+	// Report completion message
+	provisioningResult := fmt.Sprintf("Task has been succesfully completed in %s Seconds\n", time.Since(t).Round(time.Second))
+	return &provisioningResult, nil
+}
 
-		err = json.Unmarshal(response.Payload, &logs)
-		if err != nil {
-			return nil, err
+// poll - calls check until it is done, it returns an error or the context ends. The wait between checks starts at
+// pollInitial and doubles each time up to pollMax.
+func poll(ctx context.Context, check func() (done bool, err error)) error {
+	wait := pollInitial
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
 		}
 
-		if logs.State == "Completed" {
-			provisioningResult := fmt.Sprintf("Host has been succesfully provisioned OS in %s Seconds\n", time.Since(t).Round(time.Second))
-			//r.Recorder.Eventf(plunderMachine, corev1.EventTypeNormal, "PlunderProvision", provisioningResult)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
 
-			return &provisioningResult, nil
+		wait *= 2
+		if wait > pollMax {
+			wait = pollMax
 		}
 	}
 }
 
-// ProvisionKubernetes = will handle all of the tasks associated with deploying Kubernetes
-func (c *Client) ProvisionKubernetes() (result *string, err error) {
+// ProvisionKubernetesStart - will submit the Kubernetes deployment actions without waiting for them to complete,
+// any existing logs for the host should be removed beforehand with ParlayLogClear
+func (c *Client) ProvisionKubernetesStart() error {
+	if c.deploymentMap == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, it needs creating before it can be started")
+	}
 
-	// Marshall the parlay submission (runs the uptime command)
+	// Marshall the parlay submission
 	b, err := json.Marshal(c.deploymentMap)
 	if err != nil {
+		return err
+	}
+
+	return c.parlaySubmit(b)
+}
+
+// ProvisionKubernetesStatus - will return the state of the Kubernetes deployment (Running/Completed/Failed)
+func (c *Client) ProvisionKubernetesStatus(ipAddress string) (state string, err error) {
+	logs, err := c.ParlayLogs(ipAddress)
+	if err != nil {
+		return "", err
+	}
+	return logs.State, nil
+}
+
+// ParlayFailure is the action that failed in a parlay job, along with the error and output it produced
+type ParlayFailure struct {
+	// Action is the name of the action that failed
+	Action string
+	// Output is the error reported by parlay followed by any output from the action
+	Output string
+}
+
+// ProvisionKubernetesFailure - will return the action that failed in the parlay job for a host, nil is returned
+// if none of the actions have reported an error
+func (c *Client) ProvisionKubernetesFailure(ipAddress string) (*ParlayFailure, error) {
+	logs, err := c.ParlayLogs(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	return FailedAction(logs), nil
+}
+
+// RedactedOutput replaces the error and output of an action that handles secret material
+const RedactedOutput = "The output of this action has been redacted as it handles secret material"
+
+// FailedAction - returns the last action in a set of parlay logs that reported an error, nil is returned if none
+// of them did. The output of a SensitiveAction is replaced with RedactedOutput.
+func FailedAction(logs *plunderlogging.JSONLog) *ParlayFailure {
+	for i := len(logs.Entries) - 1; i >= 0; i-- {
+		e := logs.Entries[i]
+		if e.Err == "" {
+			continue
+		}
+		if SensitiveAction(e.TaskName) {
+			return &ParlayFailure{Action: e.TaskName, Output: RedactedOutput}
+		}
+		output := e.Err
+		if strings.TrimSpace(e.Entry) != "" {
+			output = fmt.Sprintf("%s\n%s", e.Err, strings.TrimSpace(e.Entry))
+		}
+		return &ParlayFailure{Action: e.TaskName, Output: output}
+	}
+	return nil
+}
+
+// ParlayLogClear - will remove the parlay logs for a host from the plunder server, errors are ignored as
+// there may be no logs to remove
+func (c *Client) ParlayLogClear(ipAddress string) {
+	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlayLog", http.MethodDelete)
+	if resp.Error != "" {
 		return
 	}
+	c.address.Path = ep.Path + "/" + strings.Replace(ipAddress, ".", "-", -1)
+	apiserver.ParsePlunderDelete(c.address, c.server)
+}
 
-	// Get the time
-	t := time.Now()
+// parlaySubmit - will POST a marshalled treasure map to the plunder server
+func (c *Client) parlaySubmit(b []byte) error {
 	// Set Parlay API path and POST
 	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlay", http.MethodPost)
-	if resp.Error != "" {
-		return nil, fmt.Errorf(resp.Error)
-
+	if err := responseError(resp); err != nil {
+		return err
 	}
 	c.address.Path = ep.Path
 
 	response, err := apiserver.ParsePlunderPost(c.address, c.server, b)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// If an error has been returned then handle the error gracefully and terminate
-	if response.FriendlyError != "" || response.Error != "" {
-		return result, fmt.Errorf(resp.Error)
-
+	if err := responseError(response); err != nil {
+		return err
 	}
-	// Create the string that will be used to get the logs
-	dashAddress := strings.Replace(c.deploymentMap.Deployments[0].Hosts[0], ".", "-", -1)
-
-	for {
-		// Sleep for five seconds
-		time.Sleep(5 * time.Second)
-		// Set the parlay API get logs path and GET
-		ep, resp = apiserver.FindFunctionEndpoint(c.address, c.server, "parlayLog", http.MethodGet)
-		if resp.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
-
-		}
-		c.address.Path = ep.Path + "/" + dashAddress
+	return nil
+}
 
-		response, err = apiserver.ParsePlunderGet(c.address, c.server)
-		if err != nil {
-			return nil, err
-		}
-		// If an error has been returned then handle the error gracefully and terminate
-		if response.FriendlyError != "" || response.Error != "" {
-			return nil, fmt.Errorf(resp.Error)
+// ParlayLogs - will retrieve the parlay logs for a host, they hold the state of the most recent job and an entry
+// for each of the actions that have ran
+func (c *Client) ParlayLogs(ipAddress string) (*plunderlogging.JSONLog, error) {
+	// Create the string that will be used to get the logs
+	dashAddress := strings.Replace(ipAddress, ".", "-", -1)
 
-		}
+	// Set the parlay API get logs path and GET
+	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlayLog", http.MethodGet)
+	if err := responseError(resp); err != nil {
+		return nil, err
+	}
+	c.address.Path = ep.Path + "/" + dashAddress
 
-		var logs plunderlogging.JSONLog
+	response, err := apiserver.ParsePlunderGet(c.address, c.server)
+	if err != nil {
+		return nil, err
+	}
+	// If an error has been returned then handle the error gracefully and terminate
+	if err := responseError(response); err != nil {
+		return nil, err
+	}
 
-		err = json.Unmarshal(response.Payload, &logs)
-		if err != nil {
-			return result, err
-		}
+	var logs plunderlogging.JSONLog
 
-		if logs.State == "Completed" {
-			// Report completion message
-			provisioningResult := fmt.Sprintf("Task has been succesfully completed in %s Seconds\n", time.Since(t).Round(time.Second))
-			result = &provisioningResult
-			break
-		} else if logs.State == "Failed" {
-			// Report error message
-			provisioningResult := fmt.Sprintf("Task has been failed after in %s Seconds\n", time.Since(t).Round(time.Second))
-			result = &provisioningResult
-			break
-		}
+	err = json.Unmarshal(response.Payload, &logs)
+	if err != nil {
+		return nil, err
 	}
-	return
+	return &logs, nil
 }
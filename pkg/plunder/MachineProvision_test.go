@@ -0,0 +1,278 @@
+package plunder_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder/plundertest"
+	"github.com/plunder-app/plunder/pkg/apiserver"
+)
+
+const (
+	testMAC     = "00:50:56:a5:b5:f1"
+	testAddress = "192.168.1.10"
+)
+
+// newTestClient - starts a plundertest server with a host waiting for an address and returns a client for it,
+// the parlay logs are polled every millisecond
+func newTestClient(t *testing.T, h plundertest.Host) (*plundertest.Server, *plunder.Client, func()) {
+	s := plundertest.NewServer()
+	h.MAC = testMAC
+	s.AddHost(h)
+	restore := plunder.SetPollIntervals(time.Millisecond, 5*time.Millisecond)
+
+	c, err := s.NewClient()
+	if err != nil {
+		s.Close()
+		restore()
+		t.Fatalf("Unable to create the client [%v]", err)
+	}
+	return s, c, func() {
+		restore()
+		s.Close()
+	}
+}
+
+// provision - registers the deployment for the test host
+func provision(t *testing.T, c *plunder.Client) {
+	if err := c.ProvisionMachine("host1", testMAC, testAddress, "preseed", nil); err != nil {
+		t.Fatalf("ProvisionMachine failed [%v]", err)
+	}
+}
+
+func TestProvisionMachine(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+
+	network := &plunder.NetworkConfig{Adapter: "ens160", Gateway: "192.168.1.1", NameServers: []string{"8.8.8.8", "8.8.4.4"}}
+	if err := c.ProvisionMachine("host1", testMAC, testAddress, "preseed", network); err != nil {
+		t.Fatalf("ProvisionMachine failed [%v]", err)
+	}
+
+	d, ok := s.Deployment(testMAC)
+	if !ok {
+		t.Fatalf("No deployment was registered for %s", testMAC)
+	}
+	if d.ConfigName != "preseed" || d.ConfigHost.IPAddress != testAddress || d.ConfigHost.ServerName != "host1" {
+		t.Errorf("Unexpected deployment %+v", d)
+	}
+	if d.ConfigHost.Gateway != "192.168.1.1" || d.ConfigHost.NameServer != "8.8.8.8 8.8.4.4" {
+		t.Errorf("The network configuration wasn't applied %+v", d.ConfigHost)
+	}
+
+	found, err := c.GetDeployment(testMAC)
+	if err != nil || found == nil || found.ConfigHost.IPAddress != testAddress {
+		t.Errorf("GetDeployment returned %+v [%v]", found, err)
+	}
+}
+
+func TestProvisionMachineFailure(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+
+	provision(t, c)
+	err := c.ProvisionMachine("host1", testMAC, testAddress, "preseed", nil)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("A second deployment for the same host should fail, got [%v]", err)
+	}
+
+	s.FailEndpoint("deployment", "POST", "Deployments are disabled")
+	err = c.ProvisionMachine("host2", "00:50:56:a5:b5:f2", "192.168.1.11", "preseed", nil)
+	if err == nil || err.Error() != "Deployments are disabled" {
+		t.Errorf("The error from the server should be returned, got [%v]", err)
+	}
+}
+
+func TestProvisionMachineTimeout(t *testing.T) {
+	s := plundertest.NewServer()
+	defer s.Close()
+	s.Delay = 200 * time.Millisecond
+
+	hc := s.Client()
+	hc.Timeout = 50 * time.Millisecond
+	c, err := plunder.NewClientFromURL(s.URL, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ProvisionMachine("host1", testMAC, testAddress, "preseed", nil); err == nil {
+		t.Errorf("An unresponsive server should return an error")
+	}
+}
+
+func TestProvisionMachineWait(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{Boots: 2})
+	defer done()
+	provision(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := c.ProvisionMachineWait(ctx, testAddress)
+	if err != nil {
+		t.Fatalf("ProvisionMachineWait failed [%v]", err)
+	}
+	if result == nil || !strings.Contains(*result, "succesfully provisioned") {
+		t.Errorf("Unexpected result %v", result)
+	}
+	// Each failed uptime test is submitted again, until the host is up
+	if n := len(s.Submitted()); n != 3 {
+		t.Errorf("Expected 3 uptime tests, %d were submitted", n)
+	}
+}
+
+func TestProvisionMachineWaitTimeout(t *testing.T) {
+	_, c, done := newTestClient(t, plundertest.Host{Unreachable: true})
+	defer done()
+	provision(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.ProvisionMachineWait(ctx, testAddress)
+	if err == nil || !strings.Contains(err.Error(), "wasn't provisioned") {
+		t.Errorf("An unreachable host should time out, got [%v]", err)
+	}
+}
+
+func TestProvisionKubernetes(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{RunningPolls: 2})
+	defer done()
+	provision(t, c)
+
+	c.ActionsKubernetes(testAddress, "v1.16.2", "5:19.03.4~3-0~ubuntu-bionic")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := c.ProvisionKubernetes(ctx)
+	if err != nil {
+		t.Fatalf("ProvisionKubernetes failed [%v]", err)
+	}
+	if result == nil || !strings.Contains(*result, "succesfully completed") {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if state := s.ParlayState(testAddress); state != plundertest.StateCompleted {
+		t.Errorf("The parlay job should be %s, it is %s", plundertest.StateCompleted, state)
+	}
+}
+
+func TestProvisionKubernetesFailure(t *testing.T) {
+	_, c, done := newTestClient(t, plundertest.Host{FailDeployment: true})
+	defer done()
+	provision(t, c)
+
+	c.ActionsKubernetes(testAddress, "v1.16.2", "5:19.03.4~3-0~ubuntu-bionic")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.ProvisionKubernetes(ctx)
+	if err == nil {
+		t.Fatalf("A failed deployment should return an error")
+	}
+	// The failed action is the last one in the deployment
+	if !strings.Contains(err.Error(), "Scripted deployment failure") || !strings.Contains(err.Error(), "enable Kubernetes Kubelet") {
+		t.Errorf("The error should name the failed action, got [%v]", err)
+	}
+}
+
+func TestProvisionKubernetesTimeout(t *testing.T) {
+	_, c, done := newTestClient(t, plundertest.Host{RunningPolls: 1000000})
+	defer done()
+	provision(t, c)
+
+	c.ActionsKubernetes(testAddress, "v1.16.2", "5:19.03.4~3-0~ubuntu-bionic")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.ProvisionKubernetes(ctx)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("A deployment that doesn't finish should time out, got [%v]", err)
+	}
+}
+
+func TestProvisionKubernetesWithoutDeployment(t *testing.T) {
+	_, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+
+	if err := c.ProvisionKubernetesStart(); err == nil {
+		t.Errorf("Starting without a deployment should fail")
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		resp apiserver.Response
+		want string
+	}{
+		{apiserver.Response{}, ""},
+		{apiserver.Response{Error: "error"}, "error"},
+		{apiserver.Response{FriendlyError: "friendly"}, "friendly"},
+		{apiserver.Response{FriendlyError: "friendly", Error: "error"}, "error"},
+		{apiserver.Response{Error: "100% broken"}, "100% broken"},
+	}
+	for _, test := range tests {
+		err := plunder.ResponseError(&test.resp)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("responseError(%+v) = %q, want %q", test.resp, got, test.want)
+		}
+	}
+}
+
+func TestGetDeploymentNotFound(t *testing.T) {
+	_, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+
+	found, err := c.GetDeployment(testMAC)
+	if err != nil || found != nil {
+		t.Errorf("A missing deployment should return nil without an error, got %+v [%v]", found, err)
+	}
+}
+
+// notFoundResponse is how the Plunder server answers GET /deployment/00-50-56-a5-b5-f1 when the MAC address has no
+// deployment, it is the body getSpecificDeployment in github.com/plunder-app/plunder/pkg/services (the version in
+// go.mod) encodes
+const notFoundResponse = `{"error":"Unable to find 00:50:56:a5:b5:f1"}` + "\n"
+
+func TestGetDeploymentNotFoundResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		notFound bool
+	}{
+		{name: "recorded response", body: notFoundResponse, notFound: true},
+		{name: "another MAC address", body: `{"error":"Unable to find 00:50:56:a5:b5:f2"}`},
+		{name: "friendly error", body: `{"friendlyError":"Error retrieving deployment Configuration","error":"Unable to find 00:50:56:a5:b5:f1"}`},
+		{name: "other error", body: `{"error":"Unable to find the deployment configuration"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c, done := newTestClient(t, plundertest.Host{})
+			defer done()
+
+			s.Respond("deploymentID", "GET", tt.body)
+			found, err := c.GetDeployment(testMAC)
+			if found != nil {
+				t.Fatalf("no deployment should be returned, got %+v", found)
+			}
+			if tt.notFound && err != nil {
+				t.Errorf("the response should mean there isn't a deployment, got [%v]", err)
+			}
+			if !tt.notFound && err == nil {
+				t.Error("the response should be returned as an error, not as a missing deployment")
+			}
+		})
+	}
+}
+
+func TestGetDeploymentFailure(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+
+	provision(t, c)
+	s.FailEndpoint("deploymentID", "GET", "Unable to read the configuration")
+	found, err := c.GetDeployment(testMAC)
+	if err == nil || found != nil || err.Error() != "Unable to read the configuration" {
+		t.Errorf("A failed request should return its error, got %+v [%v]", found, err)
+	}
+}
@@ -1,8 +1,12 @@
 package plunder
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/plunder-app/plunder/pkg/apiserver"
 	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
@@ -15,17 +19,97 @@ type Client struct {
 	deploymentMap *parlaytypes.TreasureMap
 }
 
+const (
+	// DefaultConfigPath is the Plunder client configuration that is used when no other configuration is given
+	DefaultConfigPath = "plunderclient.yaml"
+
+	// requestTimeout is how long a request to the Plunder server can take, so that an unresponsive server can't
+	// block the caller forever
+	requestTimeout = 30 * time.Second
+)
+
 // NewClient -  a  this will attempt to create a new client for interacting with Plunder
 func NewClient() (*Client, error) {
-	// Find a machine for provisioning
+	return NewClientFromConfig(DefaultConfigPath)
+}
 
-	// TODO - Make config path configurable.
-	u, c, err := apiserver.BuildEnvironmentFromConfig("plunderclient.yaml", "")
+// NewClientFromConfig - will create a new client from a Plunder client configuration (plunderclient.yaml)
+func NewClientFromConfig(path string) (*Client, error) {
+	u, c, err := apiserver.BuildEnvironmentFromConfig(path, "")
 	if err != nil {
 		return nil, err
 	}
+	if c.Timeout == 0 {
+		c.Timeout = requestTimeout
+	}
 	return &Client{
 		address: u,
 		server:  c,
 	}, nil
 }
+
+// NewClientFromURL - will create a new client for the Plunder server at an address, the http client is used to
+// connect to it (so that it can be given the certificates of the server)
+func NewClientFromURL(address string, server *http.Client) (*Client, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		address: u,
+		server:  server,
+	}, nil
+}
+
+// Clone - returns a new client for the same Plunder server, the connection is shared but the new client has its
+// own address and deployment so that it can be used at the same time as the original
+func (c *Client) Clone() *Client {
+	address := *c.address
+	return &Client{
+		address: &address,
+		server:  c.server,
+	}
+}
+
+// NewHTTPClient - will create the http client used to connect to a Plunder server, the server is trusted with its
+// certificate (caCert) and the client certificate and key are presented to it if they are set
+func NewHTTPClient(caCert, clientCert, clientKey []byte) (*http.Client, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("Unable to parse the certificate of the Plunder server")
+	}
+	config := &tls.Config{RootCAs: pool}
+
+	if len(clientCert) != 0 || len(clientKey) != 0 {
+		cert, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: config,
+		},
+		Timeout: requestTimeout,
+	}, nil
+}
+
+// Ping - will check that the Plunder server answers, by looking up one of its functions
+func (c *Client) Ping() error {
+	_, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlay", http.MethodPost)
+	return responseError(resp)
+}
+
+// responseError - returns the error in a response from the Plunder server, the server may only set one of the
+// error and friendly error so whichever is set is used. Nil is returned if the response isn't an error.
+func responseError(resp *apiserver.Response) error {
+	switch {
+	case resp.Error != "":
+		return fmt.Errorf("%s", resp.Error)
+	case resp.FriendlyError != "":
+		return fmt.Errorf("%s", resp.FriendlyError)
+	}
+	return nil
+}
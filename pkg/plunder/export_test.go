@@ -0,0 +1,28 @@
+package plunder
+
+import "time"
+
+// SetPollIntervals - changes the waits between checks of the parlay logs so that tests don't take minutes, the
+// returned function puts them back
+func SetPollIntervals(initial, max time.Duration) func() {
+	oldInitial, oldMax := pollInitial, pollMax
+	pollInitial, pollMax = initial, max
+	return func() {
+		pollInitial, pollMax = oldInitial, oldMax
+	}
+}
+
+// ResponseError - exposes responseError to the tests
+var ResponseError = responseError
+
+// UptimeCommand - exposes uptimeCommand to the tests
+var UptimeCommand = uptimeCommand
+
+// CapturedActions - returns the names of the actions whose output can be kept
+func CapturedActions() []string {
+	var names []string
+	for name := range capturedActions {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,385 @@
+// Package fake provides an in-memory Plunder server, so that the controllers can be ran without real hardware.
+// It simulates DHCP leases, the registration of deployments and the state of parlay jobs.
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+	"github.com/plunder-app/plunder/pkg/plunderlogging"
+	"github.com/plunder-app/plunder/pkg/services"
+)
+
+// The states of a parlay job, these match the states reported in the parlay logs
+const (
+	StateRunning   = "Running"
+	StateCompleted = "Completed"
+	StateFailed    = "Failed"
+)
+
+// Server is the state of the fake Plunder server, it is shared by all of the clients it creates
+type Server struct {
+	mu          sync.Mutex
+	leases      map[string]time.Time
+	deployments map[string]services.DeploymentConfig
+	logs        map[string]string
+	failures    map[string]plunder.ParlayFailure
+	entries     map[string][]plunderlogging.JSONLogEntry
+	submitted   []parlaytypes.TreasureMap
+	unreachable bool
+	errors      map[string]string
+
+	// AutoComplete moves a Running parlay job to Completed once its state has been checked, when it is false
+	// jobs stay Running until SetParlayState is called
+	AutoComplete bool
+}
+
+// NewServer - returns an empty fake Plunder server
+func NewServer() *Server {
+	return &Server{
+		leases:      map[string]time.Time{},
+		deployments: map[string]services.DeploymentConfig{},
+		logs:        map[string]string{},
+		failures:    map[string]plunder.ParlayFailure{},
+		entries:     map[string][]plunderlogging.JSONLogEntry{},
+		errors:      map[string]string{},
+	}
+}
+
+// NewClient - returns a client for the fake server, every Plunder server name is given a client for this server
+// so that it can be given to the controllers
+func (s *Server) NewClient(server string) (plunder.Interface, error) {
+	return &Client{server: s}, nil
+}
+
+// SetUnreachable - makes Ping fail, as if the server can't be reached
+func (s *Server) SetUnreachable(unreachable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unreachable = unreachable
+}
+
+// Fail - makes a method of the clients (such as "GetDeployment") return an error, as if the request to the server
+// failed. An empty message removes the failure.
+func (s *Server) Fail(method, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message == "" {
+		delete(s.errors, method)
+		return
+	}
+	s.errors[method] = message
+}
+
+// failure - returns the error set for a method with Fail
+func (s *Server) failure(method string) error {
+	if message, ok := s.errors[method]; ok {
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// AddLease - simulates a host asking the DHCP server for an address
+func (s *Server) AddLease(macAddress string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leases[strings.ToLower(macAddress)] = time.Now()
+}
+
+// Deployment - returns the deployment registered for a MAC address
+func (s *Server) Deployment(macAddress string) (services.DeploymentConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deployments[strings.ToLower(macAddress)]
+	return d, ok
+}
+
+// SetParlayState - sets the state of the parlay job for a host
+func (s *Server) SetParlayState(ipAddress, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[ipAddress] = state
+	if state != StateFailed {
+		delete(s.failures, ipAddress)
+	}
+}
+
+// SetParlayFailure - fails the parlay job for a host, reporting that an action failed with some output
+func (s *Server) SetParlayFailure(ipAddress, action, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[ipAddress] = StateFailed
+	s.failures[ipAddress] = plunder.ParlayFailure{Action: action, Output: output}
+}
+
+// SetActionOutput - sets what an action of the last parlay job for a host wrote to stdout
+func (s *Server) SetActionOutput(ipAddress, action, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries[ipAddress] {
+		if s.entries[ipAddress][i].TaskName == action {
+			s.entries[ipAddress][i].Entry = output
+		}
+	}
+}
+
+// ParlayState - returns the state of the parlay job for a host, an empty string is returned if there are no logs
+func (s *Server) ParlayState(ipAddress string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logs[ipAddress]
+}
+
+// Submitted - returns every parlay job that has been submitted, in the order they were submitted
+func (s *Server) Submitted() []parlaytypes.TreasureMap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]parlaytypes.TreasureMap(nil), s.submitted...)
+}
+
+// submit - records a parlay job and marks it as Running for its hosts, a host without a deployment never comes
+// up so its job fails
+func (s *Server) submit(m parlaytypes.TreasureMap) {
+	s.submitted = append(s.submitted, m)
+	for _, d := range m.Deployments {
+		for _, host := range d.Hosts {
+			s.logs[host] = StateRunning
+			delete(s.failures, host)
+			s.entries[host] = nil
+			for _, a := range d.Actions {
+				s.entries[host] = append(s.entries[host], plunderlogging.JSONLogEntry{Created: time.Now(), TaskName: a.Name})
+			}
+			if s.deploymentByAddress(host) == "" {
+				s.logs[host] = StateFailed
+				if len(d.Actions) != 0 {
+					s.failures[host] = plunder.ParlayFailure{
+						Action: d.Actions[len(d.Actions)-1].Name,
+						Output: fmt.Sprintf("Unable to connect to [%s]", host),
+					}
+				}
+			}
+		}
+	}
+}
+
+// state - returns the state of the parlay job for a host, moving it along if AutoComplete is set
+func (s *Server) state(ipAddress string) (string, bool) {
+	state, ok := s.logs[ipAddress]
+	if ok && state == StateRunning && s.AutoComplete {
+		s.logs[ipAddress] = StateCompleted
+	}
+	return state, ok
+}
+
+// deploymentByAddress - returns the MAC address of the deployment with an IP address
+func (s *Server) deploymentByAddress(ipAddress string) string {
+	for mac, d := range s.deployments {
+		if d.ConfigHost.IPAddress == ipAddress {
+			return mac
+		}
+	}
+	return ""
+}
+
+// Client is a plunder.Interface for the fake server, deployments are generated by a real plunder.Client which
+// is never connected to a server
+type Client struct {
+	plunder.Client
+	server *Server
+}
+
+var _ plunder.Interface = &Client{}
+
+// UnleasedMachines - returns the hosts that have asked for an address but don't have a deployment
+func (c *Client) UnleasedMachines() ([]services.Lease, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	var unleased []services.Lease
+	for mac, seen := range c.server.leases {
+		unleased = append(unleased, services.Lease{MAC: mac, Expiry: seen})
+	}
+	sort.Slice(unleased, func(i, j int) bool { return unleased[i].MAC < unleased[j].MAC })
+	return unleased, nil
+}
+
+// ProvisionMachine - registers a deployment, the host is given its address so it is no longer unleased
+func (c *Client) ProvisionMachine(hostname, macAddress, ipAddress, deploymenType string, network *plunder.NetworkConfig) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if err := c.server.failure("ProvisionMachine"); err != nil {
+		return err
+	}
+	mac := strings.ToLower(macAddress)
+	if _, ok := c.server.deployments[mac]; ok {
+		return fmt.Errorf("A deployment already exists for [%s]", macAddress)
+	}
+	c.server.deployments[mac] = services.DeploymentConfig{
+		ConfigName: deploymenType,
+		MAC:        mac,
+		ConfigHost: services.HostConfig{
+			IPAddress:  ipAddress,
+			ServerName: hostname,
+		},
+	}
+	delete(c.server.leases, mac)
+	return nil
+}
+
+// GetDeployment - returns the deployment for a MAC address, nil is returned if there isn't one
+func (c *Client) GetDeployment(macAddress string) (*services.DeploymentConfig, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if err := c.server.failure("GetDeployment"); err != nil {
+		return nil, err
+	}
+	d, ok := c.server.deployments[strings.ToLower(macAddress)]
+	if !ok {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+// ProvisionMachineStatus - reports if the Operating System is up, a new uptime test is submitted if the last one
+// didn't complete
+func (c *Client) ProvisionMachineStatus(ipAddress string) (bool, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	state, _ := c.server.state(ipAddress)
+	switch state {
+	case StateCompleted:
+		return true, nil
+	case StateRunning:
+		return false, nil
+	}
+	c.server.submit(parlaytypes.TreasureMap{
+		Deployments: []parlaytypes.Deployment{
+			parlaytypes.Deployment{Name: "Cluster-API OS Provisioned test", Hosts: []string{ipAddress}},
+		},
+	})
+	return false, nil
+}
+
+// ProvisionKubernetesStart - submits the generated deployment
+func (c *Client) ProvisionKubernetesStart() error {
+	m := c.DeploymentMap()
+	if m == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, it needs creating before it can be started")
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	c.server.submit(*m)
+	return nil
+}
+
+// ProvisionKubernetesStatus - returns the state of the parlay job for a host
+func (c *Client) ProvisionKubernetesStatus(ipAddress string) (string, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	state, ok := c.server.state(ipAddress)
+	if !ok {
+		return "", fmt.Errorf("No logs for [%s]", ipAddress)
+	}
+	return state, nil
+}
+
+// ProvisionKubernetesFailure - returns the action that failed in the parlay job for a host, it is found in the
+// parlay logs in the same way as the Plunder client
+func (c *Client) ProvisionKubernetesFailure(ipAddress string) (*plunder.ParlayFailure, error) {
+	logs, err := c.ParlayLogs(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	return plunder.FailedAction(logs), nil
+}
+
+// ParlayLogs - returns the parlay logs for a host, there is an entry for each action of the last job submitted to
+// the host and the action that failed has its error set
+func (c *Client) ParlayLogs(ipAddress string) (*plunderlogging.JSONLog, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	state, ok := c.server.logs[ipAddress]
+	if !ok {
+		return nil, fmt.Errorf("No logs for [%s]", ipAddress)
+	}
+	logs := &plunderlogging.JSONLog{
+		State:   state,
+		Entries: append([]plunderlogging.JSONLogEntry(nil), c.server.entries[ipAddress]...),
+	}
+	if failure, ok := c.server.failures[ipAddress]; ok {
+		found := false
+		for i := range logs.Entries {
+			if logs.Entries[i].TaskName == failure.Action {
+				logs.Entries[i].Err = failure.Output
+				found = true
+			}
+		}
+		if !found {
+			logs.Entries = append(logs.Entries, plunderlogging.JSONLogEntry{Created: time.Now(), TaskName: failure.Action, Err: failure.Output})
+		}
+	}
+	return logs, nil
+}
+
+// ParlayLogClear - removes the parlay logs for a host
+func (c *Client) ParlayLogClear(ipAddress string) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	delete(c.server.logs, ipAddress)
+	delete(c.server.failures, ipAddress)
+	delete(c.server.entries, ipAddress)
+}
+
+// DeprovisionMachine - submits the actions that clean a host
+func (c *Client) DeprovisionMachine(ipAddress string, d *plunder.DeprovisionConfig) error {
+	m, err := plunder.DeprovisionMap(ipAddress, d)
+	if err != nil {
+		return err
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.server.failure("DeprovisionMachine"); err != nil {
+		return err
+	}
+	c.server.submit(*m)
+	return nil
+}
+
+// DeleteDeployment - removes the deployment for a host
+func (c *Client) DeleteDeployment(ipAddress string) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if err := c.server.failure("DeleteDeployment"); err != nil {
+		return err
+	}
+
+	mac := c.server.deploymentByAddress(ipAddress)
+	if mac == "" {
+		return fmt.Errorf("No deployment exists for [%s]", ipAddress)
+	}
+	delete(c.server.deployments, mac)
+	return nil
+}
+
+// Ping - checks that the fake server is reachable
+func (c *Client) Ping() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.server.unreachable {
+		return fmt.Errorf("The Plunder server is unreachable")
+	}
+	return nil
+}
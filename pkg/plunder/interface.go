@@ -0,0 +1,72 @@
+package plunder
+
+import (
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+	"github.com/plunder-app/plunder/pkg/plunderlogging"
+	"github.com/plunder-app/plunder/pkg/services"
+)
+
+// Interface is the set of operations the controllers perform against Plunder, it is implemented by Client and
+// by the in-memory fake in pkg/plunder/fake
+type Interface interface {
+	// UnleasedMachines - will return the machines that have asked DHCP for an address
+	UnleasedMachines() ([]services.Lease, error)
+
+	// ProvisionMachine - will register a deployment for a machine
+	ProvisionMachine(hostname, macAddress, ipAddress, deploymenType string, network *NetworkConfig) error
+	// GetDeployment - will return the deployment for a MAC address, or nil if there isn't one
+	GetDeployment(macAddress string) (*services.DeploymentConfig, error)
+	// ProvisionMachineStatus - will check (without blocking) if the Operating System is up
+	ProvisionMachineStatus(ipAddress string) (complete bool, err error)
+
+	// ActionsKubernetes - starts a new deployment that installs Kubernetes
+	ActionsKubernetes(host, kubeVersion, dockerVersion string)
+	// ActionsKubernetesReset - adds the action that cleans up a previous Kubernetes installation to the deployment
+	ActionsKubernetesReset() error
+	// ActionsNetwork - adds the network configuration to the deployment
+	ActionsNetwork(ipAddress string, n *NetworkConfig) error
+	// ActionsControlPlane - adds the actions that initialise the control plane to the deployment
+	ActionsControlPlane(kubeversion, cidr string, j *JoinConfig, vip *KubeVIPConfig) error
+	// ActionsControlPlaneJoin - adds the actions that join a control plane to the deployment
+	ActionsControlPlaneJoin(initHost string, j *JoinConfig, vip *KubeVIPConfig) error
+	// ActionsWorker - adds the actions that join a worker to the deployment
+	ActionsWorker(initHost string, j *JoinConfig) error
+	// ActionsCloudInit - adds the actions that run the bootstrap data to the deployment
+	ActionsCloudInit(hostname, instanceID, bootstrapData string) error
+	// DeploymentName - returns the name of the deployment
+	DeploymentName() string
+	// DeploymentMap - returns the deployment that has been generated
+	DeploymentMap() *parlaytypes.TreasureMap
+
+	// ProvisionKubernetesStart - will submit the deployment to parlay
+	ProvisionKubernetesStart() error
+	// ProvisionKubernetesStatus - will return the state of the parlay job for a host (Running/Completed/Failed)
+	ProvisionKubernetesStatus(ipAddress string) (state string, err error)
+	// ProvisionKubernetesFailure - will return the action that failed in the parlay job for a host, or nil
+	ProvisionKubernetesFailure(ipAddress string) (*ParlayFailure, error)
+	// ParlayLogs - will return the parlay logs for a host
+	ParlayLogs(ipAddress string) (*plunderlogging.JSONLog, error)
+	// ParlayLogClear - will remove the parlay logs for a host
+	ParlayLogClear(ipAddress string)
+
+	// DeprovisionMachine - will submit the actions that clean a host
+	DeprovisionMachine(ipAddress string, d *DeprovisionConfig) error
+	// DeleteDeployment - will remove the deployment for a host
+	DeleteDeployment(ipAddress string) error
+
+	// Ping - will check that the Plunder server answers
+	Ping() error
+}
+
+// Client is the Interface that talks to a Plunder server
+var _ Interface = &Client{}
+
+// NewInterface - will create a new client for interacting with Plunder, returned as an Interface so that it can
+// be swapped for a fake
+func NewInterface() (Interface, error) {
+	c, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,89 @@
+package plunder
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+)
+
+// kubeVIPManifestPath is where the kube-vip static pod is written, so that it is started by the kubelet
+const kubeVIPManifestPath = "/etc/kubernetes/manifests/kube-vip.yaml"
+
+// KubeVIPConfig is the configuration for kube-vip to advertise the control plane virtual IP
+type KubeVIPConfig struct {
+	VIP       string
+	Port      int
+	Interface string
+	Image     string
+}
+
+// manifest - generates the static pod for kube-vip, leader election uses the admin kubeconfig of the control plane
+// which is pointed at the local API server (through the kubernetes host alias) as the VIP won't be up yet
+func (k *KubeVIPConfig) manifest() string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-vip
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-vip
+    image: %s
+    args:
+    - manager
+    env:
+    - name: vip_arp
+      value: "true"
+    - name: vip_interface
+      value: %s
+    - name: port
+      value: "%d"
+    - name: vip_cidr
+      value: "32"
+    - name: cp_enable
+      value: "true"
+    - name: cp_namespace
+      value: kube-system
+    - name: vip_leaderelection
+      value: "true"
+    - name: address
+      value: %s
+    securityContext:
+      capabilities:
+        add:
+        - NET_ADMIN
+        - NET_RAW
+    volumeMounts:
+    - mountPath: /etc/kubernetes/admin.conf
+      name: kubeconfig
+  hostAliases:
+  - hostnames:
+    - kubernetes
+    ip: 127.0.0.1
+  hostNetwork: true
+  volumes:
+  - name: kubeconfig
+    hostPath:
+      path: /etc/kubernetes/admin.conf
+`, k.Image, k.Interface, k.Port, k.VIP)
+}
+
+// kubeVIPActions - returns the actions that write the kube-vip static pod
+func kubeVIPActions(k *KubeVIPConfig) []parlaytypes.Action {
+	return []parlaytypes.Action{
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     "mkdir -p /etc/kubernetes/manifests",
+			Name:        "Cluster-API provisioning [create manifest directory]",
+			CommandSudo: "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        fmt.Sprintf("tee %s", kubeVIPManifestPath),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", base64.StdEncoding.EncodeToString([]byte(k.manifest()))),
+			Name:           "Cluster-API provisioning [write kube-vip manifest]",
+			CommandSudo:    "root",
+		},
+	}
+}
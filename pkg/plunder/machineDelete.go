@@ -2,17 +2,29 @@ package plunder
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/plunder-app/plunder/pkg/apiserver"
 )
 
-// DeleteMachine will remove a provisioned machine
+// DeleteMachine will remove a provisioned machine, the start of the disks are wiped and the host is rebooted
+// before its deployment is removed. It doesn't wait for the wipe to complete.
 func (c *Client) DeleteMachine(ipAddress string) error {
+	err := c.DeprovisionMachine(ipAddress, &DeprovisionConfig{Mode: DeprovisionQuick, Reboot: true})
+	if err != nil {
+		return err
+	}
+	return c.DeleteDeployment(ipAddress)
+}
 
-	destroyMap := destroyCommand(ipAddress)
+// DeprovisionMachine will submit the actions that clean a host, any existing logs for the host should be removed
+// beforehand with ParlayLogClear. The progress is found from the parlay logs for the host.
+func (c *Client) DeprovisionMachine(ipAddress string, d *DeprovisionConfig) error {
+	destroyMap, err := DeprovisionMap(ipAddress, d)
+	if err != nil {
+		return err
+	}
 
 	// Marshall the parlay submission (runs the set of destroy commands)
 	b, err := json.Marshal(destroyMap)
@@ -22,42 +34,39 @@ func (c *Client) DeleteMachine(ipAddress string) error {
 
 	// Set Parlay API path and POST
 	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "parlay", http.MethodPost)
-	if resp.Error != "" || resp.FriendlyError != "" {
-		return fmt.Errorf(resp.FriendlyError)
+	if err := responseError(resp); err != nil {
+		return err
 	}
 
 	c.address.Path = ep.Path
 	response, err := apiserver.ParsePlunderPost(c.address, c.server, b)
 	if err != nil {
-
-		return fmt.Errorf(response.Error)
+		return err
 	}
 
 	// If an error has been returned then handle the error gracefully and terminate
-	if response.FriendlyError != "" || response.Error != "" {
-		// TODO - if this error occurs it's because the machine doesn't exist
-		//plunderMachine.Finalizers = util.Filter(plunderMachine.Finalizers, infrav1.MachineFinalizer)
-		//logger.Info(fmt.Sprintf("Removing Machine with address [%s] from config, it may need removing manually", plunderM))
-		return fmt.Errorf(resp.FriendlyError)
-
+	if err := responseError(response); err != nil {
+		return err
 	}
+	return nil
+}
 
+// DeleteDeployment will remove the deployment for a host from the Plunder server
+func (c *Client) DeleteDeployment(ipAddress string) error {
 	// Set Parlay API path and POST
-	ep, resp = apiserver.FindFunctionEndpoint(c.address, c.server, "deploymentAddress", http.MethodDelete)
-	if resp.Error != "" {
-		return fmt.Errorf(resp.Error)
-
+	ep, resp := apiserver.FindFunctionEndpoint(c.address, c.server, "deploymentAddress", http.MethodDelete)
+	if err := responseError(resp); err != nil {
+		return err
 	}
 	c.address.Path = ep.Path + "/" + strings.Replace(ipAddress, ".", "-", -1)
-	response, err = apiserver.ParsePlunderDelete(c.address, c.server)
+	response, err := apiserver.ParsePlunderDelete(c.address, c.server)
 	if err != nil {
 		return err
 	}
 
 	// If an error has been returned then handle the error gracefully and terminate
-	if response.FriendlyError != "" || response.Error != "" {
-		return fmt.Errorf(resp.Error)
-
+	if err := responseError(response); err != nil {
+		return err
 	}
 	return nil
 }
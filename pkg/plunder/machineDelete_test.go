@@ -0,0 +1,116 @@
+package plunder_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder/plundertest"
+)
+
+func TestDeleteMachine(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+	provision(t, c)
+
+	if err := c.DeleteMachine(testAddress); err != nil {
+		t.Fatalf("DeleteMachine failed [%v]", err)
+	}
+	if _, ok := s.Deployment(testMAC); ok {
+		t.Errorf("The deployment should have been removed")
+	}
+
+	submitted := s.Submitted()
+	if len(submitted) != 1 || len(submitted[0].Deployments) != 1 {
+		t.Fatalf("Expected a single wipe to be submitted, got %+v", submitted)
+	}
+	wipe := submitted[0].Deployments[0]
+	if wipe.Hosts[0] != testAddress {
+		t.Errorf("The wipe was submitted for %v", wipe.Hosts)
+	}
+	last := wipe.Actions[len(wipe.Actions)-1]
+	if !strings.Contains(last.Command, "sysrq-trigger") || !last.IgnoreFailure {
+		t.Errorf("The host should be rebooted after the wipe, the last action is %+v", last)
+	}
+
+	found, err := c.GetDeployment(testMAC)
+	if err != nil || found != nil {
+		t.Errorf("GetDeployment of a removed deployment returned %+v [%v]", found, err)
+	}
+}
+
+func TestDeleteMachineFailure(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+	provision(t, c)
+
+	// A wipe that can't be submitted leaves the deployment in place
+	s.FailEndpoint("parlay", "POST", "Parlay is unavailable")
+	err := c.DeleteMachine(testAddress)
+	if err == nil || err.Error() != "Parlay is unavailable" {
+		t.Errorf("The error from the server should be returned, got [%v]", err)
+	}
+	if _, ok := s.Deployment(testMAC); !ok {
+		t.Errorf("The deployment shouldn't be removed when the wipe fails")
+	}
+
+	// A host without a deployment can't be removed
+	s.FailEndpoint("parlay", "POST", "")
+	err = c.DeleteMachine("192.168.1.99")
+	if err == nil || !strings.Contains(err.Error(), "Unable to find deployment") {
+		t.Errorf("Removing an unknown host should fail, got [%v]", err)
+	}
+}
+
+func TestDeleteMachineTimeout(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+	provision(t, c)
+
+	hc := s.Client()
+	hc.Timeout = 50 * time.Millisecond
+	slow, err := plunder.NewClientFromURL(s.URL, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Delay = 200 * time.Millisecond
+	if err := slow.DeleteMachine(testAddress); err == nil {
+		t.Errorf("An unresponsive server should return an error")
+	}
+}
+
+func TestDeprovisionMachine(t *testing.T) {
+	s, c, done := newTestClient(t, plundertest.Host{})
+	defer done()
+	provision(t, c)
+
+	if err := c.DeprovisionMachine(testAddress, &plunder.DeprovisionConfig{Mode: plunder.DeprovisionNone}); err == nil {
+		t.Errorf("The None mode has no actions to submit")
+	}
+	if err := c.DeprovisionMachine(testAddress, &plunder.DeprovisionConfig{Mode: plunder.DeprovisionFull, Disks: []string{"/dev/sda"}}); err != nil {
+		t.Fatalf("DeprovisionMachine failed [%v]", err)
+	}
+	if _, ok := s.Deployment(testMAC); !ok {
+		t.Errorf("DeprovisionMachine shouldn't remove the deployment")
+	}
+	logs, err := c.ParlayLogs(testAddress)
+	if err != nil || logs.State != plundertest.StateCompleted {
+		t.Errorf("The wipe should complete, got %+v [%v]", logs, err)
+	}
+}
+
+func TestDeprovisionSecureErase(t *testing.T) {
+	m, err := plunder.DeprovisionMap(testAddress, &plunder.DeprovisionConfig{Mode: plunder.DeprovisionSecureErase, Disks: []string{"/dev/sda"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	erase := m.Deployments[0].Actions[0].Command
+	if !strings.Contains(erase, "hdparm --user-master u --security-erase") || !strings.Contains(erase, "blkdiscard -s") {
+		t.Errorf("The erase should use the ATA security erase or a secure discard, got [%s]", erase)
+	}
+	// A plain discard leaves the data recoverable, so it mustn't be used when the secure erase fails
+	if strings.Contains(strings.Replace(erase, "blkdiscard -s", "", -1), "blkdiscard") {
+		t.Errorf("The erase shouldn't fall back to a plain discard, got [%s]", erase)
+	}
+}
@@ -0,0 +1,164 @@
+package plunder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+	"github.com/plunder-app/plunder/pkg/services"
+)
+
+// netplanConfigPath is the netplan configuration written by the Ubuntu installer, it is replaced when the host
+// needs networking that the installer can't configure
+const netplanConfigPath = "/etc/netplan/01-netcfg.yaml"
+
+// NetworkConfig is the network configuration for a host
+type NetworkConfig struct {
+	Adapter       string
+	Gateway       string
+	PrefixLength  int // -1 if not known
+	NameServers   []string
+	SearchDomains []string
+
+	VLANID         int // 0 for no VLAN
+	BondInterfaces []string
+	BondMode       string
+}
+
+// applyHostConfig - sets the parts of the network configuration that the Operating System installer understands
+func (n *NetworkConfig) applyHostConfig(ipAddress string, hc *services.HostConfig) {
+	if n == nil {
+		return
+	}
+	hc.Adapter = n.Adapter
+	hc.Gateway = n.Gateway
+	hc.NameServer = strings.Join(n.NameServers, " ")
+	if n.PrefixLength >= 0 {
+		ip := net.ParseIP(ipAddress)
+		if ip != nil && ip.To4() != nil {
+			hc.Subnet = net.IP(net.CIDRMask(n.PrefixLength, 32)).String()
+		} else {
+			hc.Subnet = fmt.Sprintf("%d", n.PrefixLength)
+		}
+	}
+}
+
+// NeedsNetplan - returns true if the network configuration needs to be applied once the Operating System has been
+// installed, as it uses features that the installer can't configure
+func (n *NetworkConfig) NeedsNetplan() bool {
+	return n != nil && (n.VLANID != 0 || len(n.BondInterfaces) != 0 || len(n.SearchDomains) != 0)
+}
+
+// Link - returns the name of the interface that the address is configured on, which is a bond or VLAN if the
+// host has them
+func (n *NetworkConfig) Link() string {
+	if n == nil {
+		return ""
+	}
+	link := n.Adapter
+	if len(n.BondInterfaces) != 0 {
+		link = "bond0"
+	}
+	if n.VLANID != 0 {
+		link = fmt.Sprintf("%s.%d", link, n.VLANID)
+	}
+	return link
+}
+
+// netplan - generates the netplan configuration for a host
+func (n *NetworkConfig) netplan(ipAddress string) string {
+	var b strings.Builder
+	addressing := func(indent string) {
+		fmt.Fprintf(&b, "%saddresses: [%s/%d]\n", indent, ipAddress, n.PrefixLength)
+		if n.Gateway != "" {
+			if ip := net.ParseIP(n.Gateway); ip != nil && ip.To4() == nil {
+				fmt.Fprintf(&b, "%sgateway6: %s\n", indent, n.Gateway)
+			} else {
+				fmt.Fprintf(&b, "%sgateway4: %s\n", indent, n.Gateway)
+			}
+		}
+		if len(n.NameServers) != 0 || len(n.SearchDomains) != 0 {
+			fmt.Fprintf(&b, "%snameservers:\n", indent)
+			if len(n.NameServers) != 0 {
+				fmt.Fprintf(&b, "%s  addresses: [%s]\n", indent, strings.Join(n.NameServers, ", "))
+			}
+			if len(n.SearchDomains) != 0 {
+				fmt.Fprintf(&b, "%s  search: [%s]\n", indent, strings.Join(n.SearchDomains, ", "))
+			}
+		}
+	}
+
+	// The interface that will have the address
+	link := n.Adapter
+	if len(n.BondInterfaces) != 0 {
+		link = "bond0"
+	}
+
+	b.WriteString("network:\n  version: 2\n  ethernets:\n")
+	physical := n.BondInterfaces
+	if len(physical) == 0 {
+		physical = []string{n.Adapter}
+	}
+	for _, nic := range physical {
+		fmt.Fprintf(&b, "    %s:\n      dhcp4: false\n", nic)
+		if len(n.BondInterfaces) == 0 && n.VLANID == 0 {
+			addressing("      ")
+		}
+	}
+
+	if len(n.BondInterfaces) != 0 {
+		fmt.Fprintf(&b, "  bonds:\n    %s:\n      interfaces: [%s]\n", link, strings.Join(n.BondInterfaces, ", "))
+		if n.BondMode != "" {
+			fmt.Fprintf(&b, "      parameters:\n        mode: %s\n", n.BondMode)
+		}
+		if n.VLANID == 0 {
+			addressing("      ")
+		}
+	}
+
+	if n.VLANID != 0 {
+		fmt.Fprintf(&b, "  vlans:\n    %s.%d:\n      id: %d\n      link: %s\n", link, n.VLANID, n.VLANID, link)
+		addressing("      ")
+	}
+	return b.String()
+}
+
+// ActionsNetwork - will add the actions that apply the network configuration to the start of the Kubernetes
+// deployment, the configuration is applied in the background as the connection may drop whilst it is applied
+func (c *Client) ActionsNetwork(ipAddress string, n *NetworkConfig) error {
+	if c.deploymentMap == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply network configuration commands")
+	}
+	if !n.NeedsNetplan() {
+		return nil
+	}
+
+	config := base64.StdEncoding.EncodeToString([]byte(n.netplan(ipAddress)))
+	network := []parlaytypes.Action{
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        fmt.Sprintf("tee %s", netplanConfigPath),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", config),
+			Name:           "Cluster-API provisioning [write network configuration]",
+			CommandSudo:    "root",
+		},
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     "nohup sh -c \"sleep 2 && netplan apply\" >/dev/null 2>&1 &",
+			Name:        "Cluster-API provisioning [apply network configuration]",
+			CommandSudo: "root",
+		},
+		parlaytypes.Action{
+			ActionType:    "command",
+			Command:       "sleep 15",
+			Name:          "Cluster-API provisioning [wait for network configuration]",
+			IgnoreFailure: true,
+		},
+	}
+
+	d := c.machineDeployment()
+	d.Actions = append(network, d.Actions...)
+	return nil
+}
@@ -1,6 +1,7 @@
 package plunder
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -26,39 +27,212 @@ func uptimeCommand(host string) parlaytypes.TreasureMap {
 	}
 }
 
-func destroyCommand(host string) parlaytypes.TreasureMap {
-	return parlaytypes.TreasureMap{
+// The ways that DeprovisionMachine can clean a host
+const (
+	// DeprovisionNone leaves the host as it is
+	DeprovisionNone = "None"
+	// DeprovisionQuick removes the partition tables and signatures and zeroes the start of each disk
+	DeprovisionQuick = "Quick"
+	// DeprovisionFull zeroes the whole of each disk
+	DeprovisionFull = "Full"
+	// DeprovisionSecureErase erases each disk with the ATA security erase, or a secure discard for disks that
+	// aren't ATA, a disk that supports neither fails
+	DeprovisionSecureErase = "SecureErase"
+	// DeprovisionCustom runs the actions of the configuration
+	DeprovisionCustom = "Custom"
+)
+
+// deprovisionDeploymentName is the name of the parlay deployment that cleans a host
+const deprovisionDeploymentName = "Cluster-API de-provisioning"
+
+// DeprovisionConfig is how a host is cleaned before it is removed from the Plunder server
+type DeprovisionConfig struct {
+	// Mode is one of the Deprovision modes, an empty mode is DeprovisionQuick
+	Mode string
+	// Disks are the devices that are cleaned, every disk reported by lsblk is cleaned if there are none
+	Disks []string
+	// Actions are the actions that are ran for DeprovisionCustom
+	Actions []parlaytypes.Action
+	// Reboot will reboot the host (with sysrq, as the disks may no longer be usable) once it has been cleaned
+	Reboot bool
+}
+
+// diskCommand - returns a command that runs a command against each disk in turn, the command refers to the disk
+// as \$d. It stops at the first disk that fails.
+func diskCommand(disks []string, command string) string {
+	list := "$(lsblk -dnpr -o NAME,TYPE | grep ' disk$' | cut -d' ' -f1)"
+	if len(disks) != 0 {
+		list = strings.Join(disks, " ")
+	}
+	return fmt.Sprintf("sh -c \"for d in %s; do %s || exit 1; done\"", list, command)
+}
+
+// secureEraseCommand erases the disk \$d. An ATA disk whose security isn't frozen has a temporary password set
+// and is erased by its firmware with hdparm, other disks (such as eMMC) have to support a secure discard. A disk
+// that can do neither fails, rather than falling back to an erase that leaves the data recoverable.
+const secureEraseCommand = "if hdparm -I \\$d 2>/dev/null | grep -q 'not[[:space:]]*frozen'; then " +
+	"hdparm --user-master u --security-set-pass plunder \\$d && hdparm --user-master u --security-erase plunder \\$d; " +
+	"elif blkdiscard -s \\$d; then true; " +
+	"else echo \\$d has no usable ATA security erase, it is unsupported or frozen, and no secure discard >&2; false; fi"
+
+// capturedActions are the names of the actions whose error and output can be kept (in the parlay logs captured by
+// the controller and the status of a machine), none of them handle secret material. Every other action is redacted,
+// so an action that is added without being listed here (or an action of a Custom deprovision policy) never has its
+// output kept.
+var capturedActions = map[string]bool{
+	"Cluster-API provisioning uptime command":                   true,
+	"Cluster-API machine [enable sysrq]":                        true,
+	"Cluster-API machine [remove disk signatures]":              true,
+	"Cluster-API machine [disk wipe]":                           true,
+	"Cluster-API machine [full disk wipe]":                      true,
+	"Cluster-API machine [secure erase]":                        true,
+	"Cluster-API machine [reset]":                               true,
+	"Cluster-API provisioning [reset Ubuntu repositories]":      true,
+	"Cluster-API provisioning [Ubuntu package update]":          true,
+	"Cluster-API provisioning [Ubuntu package installation]":    true,
+	"Cluster-API provisioning [set Docker Repository]":          true,
+	"Cluster-API provisioning [set Kubernetes Repository]":      true,
+	"Cluster-API provisioning [add Docker GPG Key]":             true,
+	"Cluster-API provisioning [add Kubernetes GPG Key]":         true,
+	"Cluster-API provisioning [install Kubernetes packages]":    true,
+	"Cluster-API provisioning [enable Kubernetes Kubelet]":      true,
+	"Cluster-API provisioning [write network configuration]":    true,
+	"Cluster-API provisioning [apply network configuration]":    true,
+	"Cluster-API provisioning [wait for network configuration]": true,
+	"Cluster-API provisioning [create manifest directory]":      true,
+	"Cluster-API provisioning [write kube-vip manifest]":        true,
+	"Cluster-API provisioning [create certificate directory]":   true,
+	"Cluster-API provisioning [reset kubeadm]":                  true,
+	"Cluster-API provisioning [install cloud-init]":             true,
+	"Cluster-API provisioning [create cloud-init seed]":         true,
+	"Cluster-API provisioning [set cloud-init datasource]":      true,
+	"Cluster-API provisioning [write cloud-init meta-data]":     true,
+}
+
+// SensitiveAction - returns true if the output of the action with a name can't be kept, as it isn't one of the
+// actions known not to handle secret material. Its output (and error, which may hold its command) mustn't be kept
+// anywhere that isn't as secret as the material itself.
+func SensitiveAction(name string) bool {
+	return !capturedActions[name]
+}
+
+// writeFileCommand - returns a command that writes its input to a file with a mode, the file is created with the
+// mode so it is never readable by anyone else and the input isn't echoed back (so that secrets such as keys and
+// bootstrap data don't end up in the parlay logs)
+func writeFileCommand(path, mode string) string {
+	return fmt.Sprintf("sh -c \"umask 077 && tee %s > /dev/null && chmod %s %s\"", path, mode, path)
+}
+
+// DeprovisionMap - returns the deployment that cleans a host with a deprovision configuration
+func DeprovisionMap(host string, d *DeprovisionConfig) (*parlaytypes.TreasureMap, error) {
+	var actions []parlaytypes.Action
+	if d.Reboot {
+		actions = append(actions, parlaytypes.Action{
+			ActionType:     "command",
+			Command:        "tee /proc/sys/kernel/sysrq",
+			CommandPipeCmd: "echo \"1\"",
+			Name:           "Cluster-API machine [enable sysrq]",
+			CommandSudo:    "root",
+		})
+	}
+
+	switch d.Mode {
+	case DeprovisionQuick, "":
+		actions = append(actions,
+			parlaytypes.Action{
+				ActionType:  "command",
+				Command:     diskCommand(d.Disks, "wipefs -af \\$d"),
+				Name:        "Cluster-API machine [remove disk signatures]",
+				CommandSudo: "root",
+			},
+			parlaytypes.Action{
+				ActionType:  "command",
+				Command:     diskCommand(d.Disks, "dd if=/dev/zero of=\\$d bs=1M count=100 oflag=direct"),
+				Name:        "Cluster-API machine [disk wipe]",
+				CommandSudo: "root",
+			})
+	case DeprovisionFull:
+		actions = append(actions, parlaytypes.Action{
+			ActionType:  "command",
+			Command:     diskCommand(d.Disks, "shred -n 0 -z \\$d"),
+			Name:        "Cluster-API machine [full disk wipe]",
+			CommandSudo: "root",
+		})
+	case DeprovisionSecureErase:
+		actions = append(actions,
+			parlaytypes.Action{
+				ActionType:  "command",
+				Command:     diskCommand(d.Disks, secureEraseCommand),
+				Name:        "Cluster-API machine [secure erase]",
+				CommandSudo: "root",
+			},
+			parlaytypes.Action{
+				ActionType:  "command",
+				Command:     diskCommand(d.Disks, "wipefs -af \\$d"),
+				Name:        "Cluster-API machine [remove disk signatures]",
+				CommandSudo: "root",
+			})
+	case DeprovisionCustom:
+		if len(d.Actions) == 0 {
+			return nil, fmt.Errorf("The Custom deprovision mode needs at least one action")
+		}
+		// The output of a custom action is never kept, so it can't use the name of one whose output is
+		for _, a := range d.Actions {
+			if capturedActions[a.Name] {
+				return nil, fmt.Errorf("The Custom deprovision action [%s] has the name of an action of the provider", a.Name)
+			}
+		}
+		actions = append(actions, d.Actions...)
+	case DeprovisionNone:
+		return nil, fmt.Errorf("The None deprovision mode doesn't run any actions")
+	default:
+		return nil, fmt.Errorf("Unknown deprovision mode [%s]", d.Mode)
+	}
+
+	if d.Reboot {
+		// The connection is lost as the host reboots, so the action can't succeed
+		actions = append(actions, parlaytypes.Action{
+			ActionType:     "command",
+			Command:        "tee /proc/sysrq-trigger",
+			CommandPipeCmd: "echo \"b\"",
+			Name:           "Cluster-API machine [reset]",
+			CommandSudo:    "root",
+			Timeout:        2,
+			IgnoreFailure:  true,
+		})
+	}
+
+	return &parlaytypes.TreasureMap{
 		Deployments: []parlaytypes.Deployment{
 			parlaytypes.Deployment{
-				Name:     "Cluster-API de-provisioning",
+				Name:     deprovisionDeploymentName,
 				Parallel: false,
 				Hosts:    []string{host},
-				Actions: []parlaytypes.Action{
-					parlaytypes.Action{
-						ActionType:     "command",
-						Command:        "tee /proc/sys/kernel/sysrq",
-						CommandPipeCmd: "echo \"1\"",
-						Name:           "Cluster-API machine [enable sysrq]",
-						CommandSudo:    "root",
-					},
-					parlaytypes.Action{
-						ActionType:  "command",
-						Command:     "dd if=/dev/zero of=/dev/sda bs=1024k count=1000",
-						Name:        "Cluster-API machine [disk wipe]",
-						CommandSudo: "root",
-					},
-					parlaytypes.Action{
-						ActionType:     "command",
-						Command:        "tee /proc/sysrq-trigger",
-						CommandPipeCmd: "echo \"b\"",
-						Name:           "Cluster-API machine [reset]",
-						CommandSudo:    "root",
-						Timeout:        2,
-					},
-				},
+				Actions:  actions,
 			},
 		},
+	}, nil
+}
+
+// DeploymentName - returns the name of the deployment that has been generated, an empty string is returned if
+// no deployment has been created. Any join preparation is ran first, so the deployment for the machine is last.
+func (c *Client) DeploymentName() string {
+	if c.deploymentMap == nil || len(c.deploymentMap.Deployments) == 0 {
+		return ""
 	}
+	return c.machineDeployment().Name
+}
+
+// DeploymentMap - returns the deployments that have been generated, nil is returned if nothing has been
+// generated
+func (c *Client) DeploymentMap() *parlaytypes.TreasureMap {
+	return c.deploymentMap
+}
+
+// machineDeployment - returns the deployment for the machine being provisioned, any join preparation is ran
+// first so the deployment for the machine is last
+func (c *Client) machineDeployment() *parlaytypes.Deployment {
+	return &c.deploymentMap.Deployments[len(c.deploymentMap.Deployments)-1]
 }
 
 // ActionsKubernetes - this will take the inputs and generate all of the deployment details needed to install a version of Kubernetes / Docker
@@ -130,7 +304,7 @@ func (c *Client) ActionsKubernetes(host, kubeVersion, dockerVersion string) {
 					parlaytypes.Action{
 						ActionType:  "command",
 						Command:     fmt.Sprintf("apt-get install -y docker-ce=%s kubelet=%s-00 kubeadm=%s-00 kubectl=%s-00 kubernetes-cni cri-tools", dockerVersion, kubeVersionFix, kubeVersionFix, kubeVersionFix),
-						Name:        fmt.Sprintf("Cluster-API provisioning [install Kubernetes (%s) packages]", kubeVersion),
+						Name:        "Cluster-API provisioning [install Kubernetes packages]",
 						CommandSudo: "root",
 					},
 					parlaytypes.Action{
@@ -145,16 +319,65 @@ func (c *Client) ActionsKubernetes(host, kubeVersion, dockerVersion string) {
 	}
 }
 
-// ActionsControlPlane will add the additional deployment actions for building the deployment plane for Kubernetes
-func (c *Client) ActionsControlPlane(kubeversion, cidr string) error {
+// JoinConfig is the shared configuration that lets machines join a cluster
+type JoinConfig struct {
+	// Endpoint is the address:port of the control plane
+	Endpoint string
+	// Token is the bootstrap token, the first control plane is initialised with it and every joining machine is
+	// given one of its own
+	Token string
+	// CACert and CAKey are the PEM encoded certificate authority of the cluster
+	CACert []byte
+	CAKey  []byte
+	// CACertHash is the hash used by joining machines to verify the certificate authority
+	CACertHash string
+	// CertificateKey encrypts the control plane certificates that are uploaded to the cluster
+	CertificateKey string
+}
+
+// ActionsControlPlane will add the additional deployment actions for building the first control plane of a
+// Kubernetes cluster, the certificate authority of the cluster is written before kubeadm is ran and the control
+// plane certificates are uploaded so that other control planes can join. If kube-vip is configured then it is
+// started with the control plane, as kubeadm needs the virtual IP to be available. The key of the certificate
+// authority isn't echoed back, and as kubeadm reports errors on stderr its standard output (which prints the join
+// token and certificate key) is discarded.
+func (c *Client) ActionsControlPlane(kubeversion, cidr string, j *JoinConfig, vip *KubeVIPConfig) error {
 	if c.deploymentMap == nil {
 		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply Control plane creation commands")
 	}
+	var preflight string
+	var cp []parlaytypes.Action
+	if vip != nil {
+		// The manifest directory won't be empty, which kubeadm would normally refuse
+		preflight = " --ignore-preflight-errors=DirAvailable--etc-kubernetes-manifests"
+		cp = append(cp, kubeVIPActions(vip)...)
+	}
+
 	// Generate the control plane actions
-	cp := []parlaytypes.Action{
+	cp = append(cp, []parlaytypes.Action{
 		parlaytypes.Action{
 			ActionType:  "command",
-			Command:     fmt.Sprintf("kubeadm init --kubernetes-version \"%s\" --pod-network-cidr=%s", kubeversion, cidr),
+			Command:     "mkdir -p /etc/kubernetes/pki",
+			Name:        "Cluster-API provisioning [create certificate directory]",
+			CommandSudo: "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        writeFileCommand("/etc/kubernetes/pki/ca.crt", "0644"),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", base64.StdEncoding.EncodeToString(j.CACert)),
+			Name:           "Cluster-API provisioning [write certificate authority]",
+			CommandSudo:    "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        writeFileCommand("/etc/kubernetes/pki/ca.key", "0600"),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", base64.StdEncoding.EncodeToString(j.CAKey)),
+			Name:           "Cluster-API provisioning [write certificate authority key]",
+			CommandSudo:    "root",
+		},
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     fmt.Sprintf("kubeadm init --kubernetes-version \"%s\" --pod-network-cidr=%s --control-plane-endpoint %s --token %s --upload-certs --certificate-key %s%s > /dev/null", kubeversion, cidr, j.Endpoint, j.Token, j.CertificateKey, preflight),
 			Name:        fmt.Sprintf("Cluster-API provisioning [Initialise Kubernetes %s Cluster]", kubeversion),
 			CommandSudo: "root",
 		},
@@ -164,21 +387,39 @@ func (c *Client) ActionsControlPlane(kubeversion, cidr string) error {
 			Name:        "Cluster-API provisioning [Set kubeconfig]",
 			CommandSudo: "root",
 		},
+	}...)
+	// Add to the deployment actions
+	c.machineDeployment().Actions = append(c.machineDeployment().Actions, cp...)
+	return nil
+}
+
+// ActionsControlPlaneJoin will add the deployment actions for joining an additional control plane to an existing
+// cluster, its join token is created and the certificates are uploaded again from the first control plane
+// (initHost) as they expire. If kube-vip
+// is configured it is started once the machine has joined, as it needs the admin kubeconfig from the join.
+func (c *Client) ActionsControlPlaneJoin(initHost string, j *JoinConfig, vip *KubeVIPConfig) error {
+	if c.deploymentMap == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply Control plane join commands")
+	}
+	join := []parlaytypes.Action{
 		parlaytypes.Action{
-			ActionType:       "command",
-			Command:          "kubeadm token create --print-join-command 2>/dev/null",
-			Name:             "Generate a join token for workers",
-			CommandSaveAsKey: "joinToken",
-			CommandSudo:      "root",
+			ActionType:  "command",
+			Command:     fmt.Sprintf("kubeadm join %s --token %s --discovery-token-ca-cert-hash %s --control-plane --certificate-key %s", j.Endpoint, j.Token, j.CACertHash, j.CertificateKey),
+			Name:        "Join Control Plane to cluster",
+			CommandSudo: "root",
 		},
 	}
-	// Add to the deployment actions
-	c.deploymentMap.Deployments[0].Actions = append(c.deploymentMap.Deployments[0].Actions, cp...)
+	if vip != nil {
+		join = append(join, kubeVIPActions(vip)...)
+	}
+	c.machineDeployment().Actions = append(c.machineDeployment().Actions, join...)
+	c.prepareJoin(initHost, j, true)
 	return nil
 }
 
-// ActionsWorker will add the additional deployment actions for adding a worker to an existing cluster
-func (c *Client) ActionsWorker() error {
+// ActionsWorker will add the additional deployment actions for adding a worker to an existing cluster, the join
+// token of the worker is created on the first control plane (initHost) before it joins
+func (c *Client) ActionsWorker(initHost string, j *JoinConfig) error {
 	if c.deploymentMap == nil {
 		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply Control plane creation commands")
 	}
@@ -186,25 +427,120 @@ func (c *Client) ActionsWorker() error {
 	wrkr := []parlaytypes.Action{
 		parlaytypes.Action{
 			ActionType:  "command",
-			KeyName:     "joinToken",
+			Command:     fmt.Sprintf("kubeadm join %s --token %s --discovery-token-ca-cert-hash %s", j.Endpoint, j.Token, j.CACertHash),
 			Name:        "Join Worker to cluster",
 			CommandSudo: "root",
 		},
 	}
 	// Add to the deployment actions
-	c.deploymentMap.Deployments[0].Actions = append(c.deploymentMap.Deployments[0].Actions, wrkr...)
+	c.machineDeployment().Actions = append(c.machineDeployment().Actions, wrkr...)
+	c.prepareJoin(initHost, j, false)
 	return nil
 }
 
-// TODO - will be needed if a worker needs a token after the main one has expired
-func createKubeToken() []parlaytypes.Action {
-	return []parlaytypes.Action{
+// ActionsKubernetesReset will add an action that removes anything left on the host by a previous attempt to
+// install Kubernetes, so that kubeadm can be ran again. It should be added before the control plane, join or
+// cloud-init actions.
+func (c *Client) ActionsKubernetesReset() error {
+	if c.deploymentMap == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply reset commands")
+	}
+	reset := parlaytypes.Action{
+		ActionType:    "command",
+		Command:       "kubeadm reset -f",
+		Name:          "Cluster-API provisioning [reset kubeadm]",
+		CommandSudo:   "root",
+		IgnoreFailure: true,
+	}
+	c.machineDeployment().Actions = append(c.machineDeployment().Actions, reset)
+	return nil
+}
+
+// prepareJoin - adds a deployment that runs on the first control plane before the machine joins, parlay runs
+// deployments in order so this is put in front of the deployment for the joining machine. The token is the joining
+// machine's own, so it is only ever created and left to expire, machines joining at the same time never remove a
+// token another is using. The standard output of kubeadm is discarded as it prints the token and certificate key.
+func (c *Client) prepareJoin(initHost string, j *JoinConfig, controlPlane bool) {
+	prepare := []parlaytypes.Action{
 		parlaytypes.Action{
-			ActionType:       "command",
-			Command:          "kubeadm token create --print-join-command 2>/dev/null",
-			Name:             "Generate a join token for workers",
-			CommandSaveAsKey: "joinToken",
-			CommandSudo:      "root",
+			ActionType:  "command",
+			Command:     fmt.Sprintf("kubeadm token create %s --ttl 2h > /dev/null", j.Token),
+			Name:        "Cluster-API join [create join token]",
+			CommandSudo: "root",
 		},
 	}
+	if controlPlane {
+		prepare = append(prepare, parlaytypes.Action{
+			ActionType:  "command",
+			Command:     fmt.Sprintf("kubeadm init phase upload-certs --upload-certs --certificate-key %s > /dev/null", j.CertificateKey),
+			Name:        "Cluster-API join [upload control plane certificates]",
+			CommandSudo: "root",
+		})
+	}
+
+	d := parlaytypes.Deployment{
+		Name:     "Cluster-API join preparation",
+		Parallel: false,
+		Hosts:    []string{initHost},
+		Actions:  prepare,
+	}
+	c.deploymentMap.Deployments = append([]parlaytypes.Deployment{d}, c.deploymentMap.Deployments...)
+}
+
+// ActionsCloudInit will add the deployment actions that run the Cluster API bootstrap data (base64 encoded
+// cloud-init) on the host, the data is written as a NoCloud seed so that cloud-init finds it without a metadata
+// service. The bootstrap data holds the certificates and join token of the cluster, so only root can read the
+// seed and it isn't echoed into the parlay logs.
+func (c *Client) ActionsCloudInit(hostname, instanceID, bootstrapData string) error {
+	if c.deploymentMap == nil {
+		return fmt.Errorf("The Kubernetes deployment couldn't be found, can't apply cloud-init commands")
+	}
+	metaData := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", instanceID, hostname)))
+	datasource := base64.StdEncoding.EncodeToString([]byte("datasource_list: [ NoCloud, None ]\n"))
+
+	ci := []parlaytypes.Action{
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     "apt-get install -y cloud-init",
+			Name:        "Cluster-API provisioning [install cloud-init]",
+			CommandSudo: "root",
+		},
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     "mkdir -p -m 0700 /var/lib/cloud/seed/nocloud",
+			Name:        "Cluster-API provisioning [create cloud-init seed]",
+			CommandSudo: "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        writeFileCommand("/etc/cloud/cloud.cfg.d/99-cluster-api.cfg", "0644"),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", datasource),
+			Name:           "Cluster-API provisioning [set cloud-init datasource]",
+			CommandSudo:    "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        writeFileCommand("/var/lib/cloud/seed/nocloud/meta-data", "0600"),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", metaData),
+			Name:           "Cluster-API provisioning [write cloud-init meta-data]",
+			CommandSudo:    "root",
+		},
+		parlaytypes.Action{
+			ActionType:     "command",
+			Command:        writeFileCommand("/var/lib/cloud/seed/nocloud/user-data", "0600"),
+			CommandPipeCmd: fmt.Sprintf("echo %s | base64 -d", bootstrapData),
+			Name:           "Cluster-API provisioning [write bootstrap data]",
+			CommandSudo:    "root",
+		},
+		// The bootstrap data runs kubeadm, which prints the join token
+		parlaytypes.Action{
+			ActionType:  "command",
+			Command:     "cloud-init clean --logs && cloud-init init --local && cloud-init init && cloud-init modules --mode=config && cloud-init modules --mode=final",
+			Name:        "Cluster-API provisioning [run bootstrap data]",
+			CommandSudo: "root",
+		},
+	}
+	// Add to the deployment actions
+	c.machineDeployment().Actions = append(c.machineDeployment().Actions, ci...)
+	return nil
 }
@@ -0,0 +1,395 @@
+// Package plundertest provides a stand-in for the Plunder API server that is built on httptest, so that the
+// plunder client can be exercised without a Plunder server or real hosts. The behaviour of each host (how long
+// it takes to boot, if its deployments fail) is scripted with Host.
+package plundertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/plunder"
+	"github.com/plunder-app/plunder/pkg/apiserver"
+	"github.com/plunder-app/plunder/pkg/parlay/parlaytypes"
+	"github.com/plunder-app/plunder/pkg/plunderlogging"
+	"github.com/plunder-app/plunder/pkg/services"
+)
+
+// The states of a parlay job, these match the states reported in the parlay logs
+const (
+	StateRunning   = "Running"
+	StateCompleted = "Completed"
+	StateFailed    = "Failed"
+)
+
+// endpoints are the functions of the Plunder API that the plunder client uses
+var endpoints = []apiserver.EndPoint{
+	{Name: "deployment", Method: http.MethodPost, Path: "/deployment"},
+	{Name: "deploymentID", Method: http.MethodGet, Path: "/deployment"},
+	{Name: "deploymentAddress", Method: http.MethodDelete, Path: "/deployment/address"},
+	{Name: "dhcp", Method: http.MethodGet, Path: "/dhcp"},
+	{Name: "parlay", Method: http.MethodPost, Path: "/parlay"},
+	{Name: "parlayLog", Method: http.MethodGet, Path: "/parlay/logs"},
+	{Name: "parlayLog", Method: http.MethodDelete, Path: "/parlay/logs"},
+}
+
+// Host is the scripted behaviour of a host
+type Host struct {
+	// MAC is the address the host asks DHCP for an address with
+	MAC string
+
+	// Boots is how many uptime tests fail before the Operating System is up
+	Boots int
+
+	// Unreachable hosts never come up, so every uptime test fails
+	Unreachable bool
+
+	// FailDeployment makes every deployment (other than uptime tests and wipes) fail
+	FailDeployment bool
+
+	// RunningPolls is how many times the logs of a job report it as Running before it finishes
+	RunningPolls int
+}
+
+// job is the parlay job for a host
+type job struct {
+	log   plunderlogging.JSONLog
+	polls int
+	final string
+}
+
+// Server is a stand-in for the Plunder API server
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	hosts       map[string]*Host
+	deployments map[string]services.DeploymentConfig
+	jobs        map[string]*job
+	failures    map[string]string
+	responses   map[string]string
+	submitted   []parlaytypes.TreasureMap
+	requests    []string
+
+	// Delay is added to every response, it can be used with a client timeout to simulate an unresponsive server
+	Delay time.Duration
+}
+
+// NewServer - starts a new TLS server, Close should be called once it is finished with
+func NewServer() *Server {
+	s := &Server{
+		hosts:       map[string]*Host{},
+		deployments: map[string]services.DeploymentConfig{},
+		jobs:        map[string]*job{},
+		failures:    map[string]string{},
+		responses:   map[string]string{},
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewClient - returns a plunder client that is connected to the server
+func (s *Server) NewClient() (*plunder.Client, error) {
+	return plunder.NewClientFromURL(s.URL, s.Client())
+}
+
+// AddHost - adds a host that is asking the DHCP server for an address
+func (s *Server) AddHost(h Host) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.MAC = strings.ToLower(h.MAC)
+	s.hosts[h.MAC] = &h
+}
+
+// FailEndpoint - makes every request to an endpoint return an error, an empty message removes the failure
+func (s *Server) FailEndpoint(name, method, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message == "" {
+		delete(s.failures, name+"/"+method)
+		return
+	}
+	s.failures[name+"/"+method] = message
+}
+
+// Respond - makes every request to an endpoint answer with a body, so that a response recorded from a Plunder
+// server can be replayed. An empty body removes the response.
+func (s *Server) Respond(name, method, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body == "" {
+		delete(s.responses, name+"/"+method)
+		return
+	}
+	s.responses[name+"/"+method] = body
+}
+
+// Deployment - returns the deployment registered for a MAC address
+func (s *Server) Deployment(macAddress string) (services.DeploymentConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deployments[strings.ToLower(macAddress)]
+	return d, ok
+}
+
+// ParlayState - returns the state of the parlay job for a host without moving it along, an empty string is
+// returned if there are no logs
+func (s *Server) ParlayState(ipAddress string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[dashed(ipAddress)]; ok {
+		return j.log.State
+	}
+	return ""
+}
+
+// Submitted - returns every parlay job that has been submitted, in the order they were submitted
+func (s *Server) Submitted() []parlaytypes.TreasureMap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]parlaytypes.TreasureMap(nil), s.submitted...)
+}
+
+// Requests - returns the method and path of every request that has been made, in the order they were made
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// serve - handles every request to the server
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Delay != 0 {
+		time.Sleep(s.Delay)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	w.Header().Set("Content-Type", "application/json")
+	if name, _ := s.endpoint(r.Method, r.URL.Path); name != "" {
+		if body, ok := s.responses[name+"/"+r.Method]; ok {
+			fmt.Fprint(w, body)
+			return
+		}
+	}
+	var rsp apiserver.Response
+	if err := s.route(r, &rsp); err != nil {
+		rsp.FriendlyError = err.Error()
+		rsp.Error = err.Error()
+	}
+	json.NewEncoder(w).Encode(rsp)
+}
+
+// route - finds the handler for a request, any error is returned in the response
+func (s *Server) route(r *http.Request, rsp *apiserver.Response) error {
+	path := r.URL.Path
+
+	// Function endpoint discovery i.e. /api/parlay/POST
+	if strings.HasPrefix(path, apiserver.FunctionPath()+"/") && r.Method == http.MethodGet {
+		parts := strings.Split(strings.TrimPrefix(path, apiserver.FunctionPath()+"/"), "/")
+		if len(parts) != 2 {
+			return fmt.Errorf("Unknown API path [%s]", path)
+		}
+		for i := range endpoints {
+			if endpoints[i].Name == parts[0] && endpoints[i].Method == parts[1] {
+				return payload(rsp, endpoints[i])
+			}
+		}
+		return fmt.Errorf("Unable to find HTTP method [%s] for function [%s]", parts[1], parts[0])
+	}
+
+	name, id := s.endpoint(r.Method, path)
+	if name == "" {
+		return fmt.Errorf("Unknown API path [%s %s]", r.Method, path)
+	}
+	if message, ok := s.failures[name+"/"+r.Method]; ok {
+		return fmt.Errorf("%s", message)
+	}
+
+	switch name + "/" + r.Method {
+	case "deployment/" + http.MethodPost:
+		return s.createDeployment(r)
+	case "deploymentID/" + http.MethodGet:
+		mac := strings.Replace(id, "-", ":", -1)
+		d, ok := s.deployments[mac]
+		if !ok {
+			// This is how the Plunder server answers, only the error is set
+			rsp.Error = fmt.Sprintf("Unable to find %s", mac)
+			return nil
+		}
+		return payload(rsp, d)
+	case "deploymentAddress/" + http.MethodDelete:
+		for mac, d := range s.deployments {
+			if dashed(d.ConfigHost.IPAddress) == id {
+				delete(s.deployments, mac)
+				return nil
+			}
+		}
+		return fmt.Errorf("Unable to find deployment with address [%s]", id)
+	case "dhcp/" + http.MethodGet:
+		return payload(rsp, s.unleased())
+	case "parlay/" + http.MethodPost:
+		return s.submit(r)
+	case "parlayLog/" + http.MethodGet:
+		j, ok := s.jobs[id]
+		if !ok {
+			return fmt.Errorf("No logs for [%s]", id)
+		}
+		// Each time the logs are read a job moves closer to finishing
+		if j.log.State == StateRunning {
+			if j.polls > 0 {
+				j.polls--
+			} else {
+				j.log.State = j.final
+			}
+		}
+		return payload(rsp, j.log)
+	case "parlayLog/" + http.MethodDelete:
+		delete(s.jobs, id)
+		return nil
+	}
+	return fmt.Errorf("Unknown API path [%s %s]", r.Method, path)
+}
+
+// endpoint - returns the name of the endpoint for a request and the ID at the end of the path (if there is one)
+func (s *Server) endpoint(method, path string) (name, id string) {
+	longest := 0
+	for i := range endpoints {
+		ep := endpoints[i]
+		if ep.Method != method || len(ep.Path) <= longest {
+			continue
+		}
+		if path == ep.Path || strings.HasPrefix(path, ep.Path+"/") {
+			name, longest = ep.Name, len(ep.Path)
+			id = strings.TrimPrefix(strings.TrimPrefix(path, ep.Path), "/")
+		}
+	}
+	if name == "dhcp" && id != "unleased" {
+		return "", ""
+	}
+	return name, id
+}
+
+// createDeployment - registers a deployment, the host is given its address so it is no longer unleased
+func (s *Server) createDeployment(r *http.Request) error {
+	var d services.DeploymentConfig
+	if err := decode(r, &d); err != nil {
+		return err
+	}
+	d.MAC = strings.ToLower(d.MAC)
+	if _, ok := s.deployments[d.MAC]; ok {
+		return fmt.Errorf("Deployment for [%s] already exists", d.MAC)
+	}
+	s.deployments[d.MAC] = d
+	return nil
+}
+
+// unleased - returns the hosts that don't have a deployment
+func (s *Server) unleased() []services.Lease {
+	var unleased []services.Lease
+	for mac := range s.hosts {
+		if _, ok := s.deployments[mac]; !ok {
+			unleased = append(unleased, services.Lease{MAC: mac, Expiry: time.Now()})
+		}
+	}
+	return unleased
+}
+
+// submit - starts a parlay job on every host of the deployments, how it will finish depends on the host
+func (s *Server) submit(r *http.Request) error {
+	var m parlaytypes.TreasureMap
+	if err := decode(r, &m); err != nil {
+		return err
+	}
+	s.submitted = append(s.submitted, m)
+
+	for _, d := range m.Deployments {
+		for _, address := range d.Hosts {
+			j := &job{log: plunderlogging.JSONLog{State: StateRunning}, final: StateCompleted}
+			h := s.hostByAddress(address)
+			if h != nil {
+				j.polls = h.RunningPolls
+			}
+
+			var failure string
+			switch {
+			case h == nil:
+				failure = fmt.Sprintf("Host [%s] has no deployment", address)
+			case isUptime(d):
+				if h.Unreachable || h.Boots > 0 {
+					if h.Boots > 0 {
+						h.Boots--
+					}
+					failure = fmt.Sprintf("Unable to connect to [%s]", address)
+				}
+			case isWipe(d):
+			case h.FailDeployment:
+				failure = "Scripted deployment failure"
+			}
+
+			for i, a := range d.Actions {
+				entry := plunderlogging.JSONLogEntry{Created: time.Now(), TaskName: a.Name}
+				if failure != "" && i == len(d.Actions)-1 {
+					entry.Err = failure
+				}
+				j.log.Entries = append(j.log.Entries, entry)
+			}
+			if failure != "" {
+				j.final = StateFailed
+			}
+			s.jobs[dashed(address)] = j
+		}
+	}
+	return nil
+}
+
+// hostByAddress - returns the host that has been given an address by a deployment
+func (s *Server) hostByAddress(address string) *Host {
+	for mac, d := range s.deployments {
+		if d.ConfigHost.IPAddress == address {
+			if h, ok := s.hosts[mac]; ok {
+				return h
+			}
+			// Hosts without a script always succeed
+			return &Host{MAC: mac}
+		}
+	}
+	return nil
+}
+
+func isUptime(d parlaytypes.Deployment) bool {
+	return len(d.Actions) == 1 && d.Actions[0].Command == "uptime"
+}
+
+func isWipe(d parlaytypes.Deployment) bool {
+	return d.Name == "Cluster-API de-provisioning"
+}
+
+// dashed - returns an address in the form used in the paths of the Plunder API
+func dashed(address string) string {
+	return strings.Replace(address, ".", "-", -1)
+}
+
+func decode(r *http.Request, v interface{}) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func payload(rsp *apiserver.Response, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	rsp.Payload = b
+	return nil
+}
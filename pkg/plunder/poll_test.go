@@ -0,0 +1,63 @@
+package plunder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollBackoff(t *testing.T) {
+	defer SetPollIntervals(time.Millisecond, 4*time.Millisecond)()
+
+	var checks []time.Time
+	err := poll(context.Background(), func() (bool, error) {
+		checks = append(checks, time.Now())
+		return len(checks) == 5, nil
+	})
+	if err != nil {
+		t.Fatalf("poll failed [%v]", err)
+	}
+	if len(checks) != 5 {
+		t.Fatalf("Expected 5 checks, there were %d", len(checks))
+	}
+	// The waits are 1, 2, 4 and then held at 4 milliseconds
+	minimum := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond}
+	for i, want := range minimum {
+		if got := checks[i+1].Sub(checks[i]); got < want {
+			t.Errorf("Wait %d was %s, it should be at least %s", i+1, got, want)
+		}
+	}
+}
+
+func TestPollError(t *testing.T) {
+	defer SetPollIntervals(time.Millisecond, time.Millisecond)()
+
+	failure := errors.New("check failed")
+	checks := 0
+	err := poll(context.Background(), func() (bool, error) {
+		checks++
+		if checks == 2 {
+			return false, failure
+		}
+		return false, nil
+	})
+	if err != failure || checks != 2 {
+		t.Errorf("poll should stop at the first error, returned [%v] after %d checks", err, checks)
+	}
+}
+
+func TestPollContext(t *testing.T) {
+	defer SetPollIntervals(time.Hour, time.Hour)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := poll(ctx, func() (bool, error) { return false, nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("poll should return the error of the context, returned [%v]", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("poll should stop waiting when the context ends")
+	}
+}
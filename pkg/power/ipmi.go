@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ipmitoolPath is the ipmitool binary used by the IPMI driver, it needs to be installed alongside the controller
+// (the controller image is distroless and doesn't include it)
+var ipmitoolPath = "ipmitool"
+
+// ipmi is the IPMI driver, it uses ipmitool as IPMI v2.0 needs the RMCP+ session handshake
+type ipmi struct {
+	host  string
+	port  string
+	creds Credentials
+}
+
+var _ Interface = &ipmi{}
+
+// newIPMI - returns the IPMI driver, which fails straight away when ipmitool isn't installed rather than on every
+// power operation
+func newIPMI(host, port string, creds Credentials) (*ipmi, error) {
+	if _, err := exec.LookPath(ipmitoolPath); err != nil {
+		return nil, fmt.Errorf("IPMI needs ipmitool, which isn't installed [%v]. The controller image doesn't include it, use a Redfish BMC address or an image with ipmitool installed", err)
+	}
+	return &ipmi{host: host, port: port, creds: creds}, nil
+}
+
+// ipmitool - runs an ipmitool command against the BMC, the password is passed in the environment so that it
+// doesn't appear in the process list
+func (i *ipmi) ipmitool(ctx context.Context, args ...string) (string, error) {
+	base := []string{"-I", "lanplus", "-H", i.host, "-p", i.port, "-U", i.creds.Username, "-E"}
+	cmd := exec.CommandContext(ctx, ipmitoolPath, append(base, args...)...)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+i.creds.Password)
+
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if output != "" {
+			err = fmt.Errorf("%v: %s", err, output)
+		}
+		return "", fmt.Errorf("ipmitool %s failed against [%s] [%v]", strings.Join(args, " "), hostPort(i.host, i.port), err)
+	}
+	return output, nil
+}
+
+// PowerState - returns the power state from "chassis power status"
+func (i *ipmi) PowerState(ctx context.Context) (State, error) {
+	out, err := i.ipmitool(ctx, "chassis", "power", "status")
+	if err != nil {
+		return StateUnknown, err
+	}
+	switch {
+	case strings.HasSuffix(out, " on"):
+		return StateOn, nil
+	case strings.HasSuffix(out, " off"):
+		return StateOff, nil
+	}
+	return StateUnknown, nil
+}
+
+// PowerOn - powers the host on
+func (i *ipmi) PowerOn(ctx context.Context) error {
+	state, err := i.PowerState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == StateOn {
+		return nil
+	}
+	_, err = i.ipmitool(ctx, "chassis", "power", "on")
+	return err
+}
+
+// PowerOff - forces the host off
+func (i *ipmi) PowerOff(ctx context.Context) error {
+	_, err := i.ipmitool(ctx, "chassis", "power", "off")
+	return err
+}
+
+// Reset - hard resets the host, a reset of a host that is off does nothing so it is powered on instead
+func (i *ipmi) Reset(ctx context.Context) error {
+	state, err := i.PowerState(ctx)
+	if err != nil {
+		return err
+	}
+	if state == StateOff {
+		_, err = i.ipmitool(ctx, "chassis", "power", "on")
+		return err
+	}
+	_, err = i.ipmitool(ctx, "chassis", "power", "reset")
+	return err
+}
+
+// SetPXEBoot - sets the boot device for the next boot to PXE, ipmitool only makes it persistent when asked
+func (i *ipmi) SetPXEBoot(ctx context.Context) error {
+	_, err := i.ipmitool(ctx, "chassis", "bootdev", "pxe")
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package power
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withIPMITool - makes the IPMI driver use a different ipmitool, the returned func puts back the previous one
+func withIPMITool(path string) func() {
+	previous := ipmitoolPath
+	ipmitoolPath = path
+	return func() { ipmitoolPath = previous }
+}
+
+func TestIPMIWithoutIPMITool(t *testing.T) {
+	defer withIPMITool("ipmitool-is-not-installed")()
+
+	p, err := New("ipmi://bmc.example.com", Credentials{Username: "admin", Password: "secret"}, false)
+	if err == nil {
+		t.Fatalf("New returned a driver without ipmitool")
+	}
+	if p != nil {
+		t.Errorf("New returned a driver [%#v] with the error", p)
+	}
+	if !strings.Contains(err.Error(), "ipmitool") || !strings.Contains(err.Error(), "Redfish") {
+		t.Errorf("error [%v] doesn't explain that ipmitool is missing", err)
+	}
+}
+
+func TestIPMIPowerState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipmitool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The stand-in ipmitool records its arguments and the password it was given
+	tool := filepath.Join(dir, "ipmitool")
+	script := "#!/bin/sh\necho \"$@ $IPMI_PASSWORD\" > " + filepath.Join(dir, "args") + "\necho 'Chassis Power is on'\n"
+	if err := ioutil.WriteFile(tool, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer withIPMITool(tool)()
+
+	p, err := New("ipmi://bmc.example.com", Credentials{Username: "admin", Password: "secret"}, false)
+	if err != nil {
+		t.Fatalf("New failed [%v]", err)
+	}
+	state, err := p.PowerState(context.Background())
+	if err != nil {
+		t.Fatalf("PowerState failed [%v]", err)
+	}
+	if state != StateOn {
+		t.Errorf("PowerState returned %s, expected %s", state, StateOn)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-I lanplus -H bmc.example.com -p 623 -U admin -E chassis power status secret"
+	if got := strings.TrimSpace(string(args)); got != expected {
+		t.Errorf("ipmitool was run with [%s], expected [%s]", got, expected)
+	}
+}
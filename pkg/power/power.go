@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package power controls the power of physical hosts through their baseboard management controllers (BMCs), it
+// has drivers for IPMI and Redfish.
+package power
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// State is the power state of a host
+type State string
+
+const (
+	// StateOn means the host is powered on (or powering on)
+	StateOn = State("On")
+
+	// StateOff means the host is powered off (or powering off)
+	StateOff = State("Off")
+
+	// StateUnknown means the BMC reported a state that isn't understood
+	StateUnknown = State("Unknown")
+)
+
+// Credentials are the username and password used to log in to a BMC
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Interface is the power management of a host
+type Interface interface {
+	// PowerState - returns if the host is powered on
+	PowerState(ctx context.Context) (State, error)
+	// PowerOn - powers the host on, nothing is done if it is already on
+	PowerOn(ctx context.Context) error
+	// PowerOff - forces the host off without waiting for the Operating System to shut down
+	PowerOff(ctx context.Context) error
+	// Reset - hard resets the host, a host that is off is powered on
+	Reset(ctx context.Context) error
+	// SetPXEBoot - makes the next boot (only) of the host boot from the network
+	SetPXEBoot(ctx context.Context) error
+}
+
+// New - returns the driver for the address of a BMC, the scheme of the address selects the driver:
+//
+//	ipmi://host[:port]                                  IPMI v2.0 (lanplus) with ipmitool
+//	redfish://host[:port][/redfish/v1/Systems/<id>]     Redfish over HTTPS
+//	redfish+http://host[:port][/redfish/v1/Systems/<id>] Redfish over HTTP
+//
+// IPMI needs ipmitool to be installed alongside the controller, which the published image doesn't include, so an
+// ipmi address returns an error when it can't be found. A Redfish address without a system uses the first system of
+// the BMC. When insecure is set the certificate of a Redfish BMC isn't verified.
+func New(address string, creds Credentials, insecure bool) (Interface, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse BMC address [%s] [%v]", address, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("The BMC address [%s] has no host", address)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "ipmi":
+		port := u.Port()
+		if port == "" {
+			port = "623"
+		}
+		i, err := newIPMI(u.Hostname(), port, creds)
+		if err != nil {
+			return nil, err
+		}
+		return i, nil
+	case "redfish":
+		return newRedfish("https", u.Host, u.Path, creds, insecure), nil
+	case "redfish+http":
+		return newRedfish("http", u.Host, u.Path, creds, insecure), nil
+	}
+	return nil, fmt.Errorf("Unknown BMC protocol [%s], it should be ipmi, redfish or redfish+http", u.Scheme)
+}
+
+// hostPort - joins a host and port, the port is left off if it is empty
+func hostPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
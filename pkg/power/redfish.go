@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package power
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// redfishTimeout is how long a single request to a Redfish BMC is allowed to take
+const redfishTimeout = 30 * time.Second
+
+// redfishSystems is the collection of computer systems on a Redfish BMC
+const redfishSystems = "/redfish/v1/Systems"
+
+// redfish is the Redfish driver
+type redfish struct {
+	scheme string
+	host   string
+	system string
+	creds  Credentials
+	client *http.Client
+}
+
+var _ Interface = &redfish{}
+
+func newRedfish(scheme, host, system string, creds Credentials, insecure bool) *redfish {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: insecure},
+	}
+	return &redfish{
+		scheme: scheme,
+		host:   host,
+		system: strings.TrimSuffix(system, "/"),
+		creds:  creds,
+		client: &http.Client{Transport: transport, Timeout: redfishTimeout},
+	}
+}
+
+// redfishLink is a reference to another resource
+type redfishLink struct {
+	ID string `json:"@odata.id"`
+}
+
+// redfishCollection is a Redfish resource collection
+type redfishCollection struct {
+	Members []redfishLink `json:"Members"`
+}
+
+// redfishSystem is the part of a ComputerSystem that the driver uses
+type redfishSystem struct {
+	PowerState string `json:"PowerState"`
+	Actions    struct {
+		Reset struct {
+			Target string `json:"target"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+// do - sends a request to the BMC and decodes the response into out (when it isn't nil)
+func (r *redfish) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	url := fmt.Sprintf("%s://%s%s", r.scheme, r.host, path)
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(r.creds.Username, r.creds.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Redfish %s %s failed [%v]", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Redfish %s %s failed reading the response [%v]", method, url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Redfish %s %s returned %s: %s", method, url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("Redfish %s %s returned an invalid response [%v]", method, url, err)
+	}
+	return nil
+}
+
+// systemPath - returns the path of the computer system, a BMC address without one uses the first system
+func (r *redfish) systemPath(ctx context.Context) (string, error) {
+	if r.system != "" {
+		return r.system, nil
+	}
+
+	var systems redfishCollection
+	if err := r.do(ctx, http.MethodGet, redfishSystems, nil, &systems); err != nil {
+		return "", err
+	}
+	if len(systems.Members) == 0 || systems.Members[0].ID == "" {
+		return "", fmt.Errorf("Redfish BMC [%s] has no computer systems", r.host)
+	}
+	r.system = strings.TrimSuffix(systems.Members[0].ID, "/")
+	return r.system, nil
+}
+
+// getSystem - returns the computer system and its path
+func (r *redfish) getSystem(ctx context.Context) (string, *redfishSystem, error) {
+	path, err := r.systemPath(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	var system redfishSystem
+	if err := r.do(ctx, http.MethodGet, path, nil, &system); err != nil {
+		return "", nil, err
+	}
+	return path, &system, nil
+}
+
+// reset - performs a ComputerSystem.Reset action
+func (r *redfish) reset(ctx context.Context, path string, system *redfishSystem, resetType string) error {
+	target := system.Actions.Reset.Target
+	if target == "" {
+		target = path + "/Actions/ComputerSystem.Reset"
+	}
+	return r.do(ctx, http.MethodPost, target, map[string]string{"ResetType": resetType}, nil)
+}
+
+// PowerState - returns the PowerState of the computer system
+func (r *redfish) PowerState(ctx context.Context) (State, error) {
+	_, system, err := r.getSystem(ctx)
+	if err != nil {
+		return StateUnknown, err
+	}
+	return redfishState(system.PowerState), nil
+}
+
+// PowerOn - powers the host on
+func (r *redfish) PowerOn(ctx context.Context) error {
+	path, system, err := r.getSystem(ctx)
+	if err != nil {
+		return err
+	}
+	if redfishState(system.PowerState) == StateOn {
+		return nil
+	}
+	return r.reset(ctx, path, system, "On")
+}
+
+// PowerOff - forces the host off
+func (r *redfish) PowerOff(ctx context.Context) error {
+	path, system, err := r.getSystem(ctx)
+	if err != nil {
+		return err
+	}
+	if redfishState(system.PowerState) == StateOff {
+		return nil
+	}
+	return r.reset(ctx, path, system, "ForceOff")
+}
+
+// Reset - hard resets the host, a host that is off is powered on
+func (r *redfish) Reset(ctx context.Context) error {
+	path, system, err := r.getSystem(ctx)
+	if err != nil {
+		return err
+	}
+	if redfishState(system.PowerState) == StateOff {
+		return r.reset(ctx, path, system, "On")
+	}
+	return r.reset(ctx, path, system, "ForceRestart")
+}
+
+// SetPXEBoot - sets a one time boot source override to PXE
+func (r *redfish) SetPXEBoot(ctx context.Context) error {
+	path, err := r.systemPath(ctx)
+	if err != nil {
+		return err
+	}
+	boot := map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideTarget":  "Pxe",
+			"BootSourceOverrideEnabled": "Once",
+		},
+	}
+	return r.do(ctx, http.MethodPatch, path, boot, nil)
+}
+
+// redfishState - converts a Redfish PowerState, the transitional states are treated as the state being moved to
+func redfishState(state string) State {
+	switch state {
+	case "On", "PoweringOn":
+		return StateOn
+	case "Off", "PoweringOff":
+		return StateOff
+	}
+	return StateUnknown
+}
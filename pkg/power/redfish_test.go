@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package power_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/power"
+	"github.com/plunder-app/cluster-api-plunder/pkg/power/redfishsim"
+)
+
+const (
+	testUsername = "admin"
+	testPassword = "secret"
+)
+
+// newRedfish - starts a simulated BMC with a system in a power state and returns the driver for it, the server
+// needs to be closed
+func newRedfish(t *testing.T, state power.State) (*redfishsim.Server, power.Interface) {
+	s := redfishsim.NewServer(testUsername, testPassword)
+	s.AddSystem("1", state)
+
+	p, err := power.New(s.Address("1"), power.Credentials{Username: testUsername, Password: testPassword}, true)
+	if err != nil {
+		s.Close()
+		t.Fatalf("New failed [%v]", err)
+	}
+	return s, p
+}
+
+func TestRedfishPowerState(t *testing.T) {
+	for _, state := range []power.State{power.StateOn, power.StateOff} {
+		s, p := newRedfish(t, state)
+		got, err := p.PowerState(context.Background())
+		if err != nil {
+			t.Fatalf("PowerState failed [%v]", err)
+		}
+		if got != state {
+			t.Errorf("PowerState returned %s, expected %s", got, state)
+		}
+		s.Close()
+	}
+}
+
+func TestRedfishPowerOn(t *testing.T) {
+	s, p := newRedfish(t, power.StateOff)
+	defer s.Close()
+	if err := p.PowerOn(context.Background()); err != nil {
+		t.Fatalf("PowerOn failed [%v]", err)
+	}
+	if s.PowerState("1") != power.StateOn {
+		t.Errorf("system is %s after PowerOn", s.PowerState("1"))
+	}
+
+	// Powering on a host that is already on does nothing
+	if err := p.PowerOn(context.Background()); err != nil {
+		t.Fatalf("PowerOn of a host that is on failed [%v]", err)
+	}
+	if resets := s.Resets("1"); !reflect.DeepEqual(resets, []string{"On"}) {
+		t.Errorf("resets are %v, expected [On]", resets)
+	}
+}
+
+func TestRedfishPowerOff(t *testing.T) {
+	s, p := newRedfish(t, power.StateOn)
+	defer s.Close()
+	if err := p.PowerOff(context.Background()); err != nil {
+		t.Fatalf("PowerOff failed [%v]", err)
+	}
+	if s.PowerState("1") != power.StateOff {
+		t.Errorf("system is %s after PowerOff", s.PowerState("1"))
+	}
+
+	if err := p.PowerOff(context.Background()); err != nil {
+		t.Fatalf("PowerOff of a host that is off failed [%v]", err)
+	}
+	if resets := s.Resets("1"); !reflect.DeepEqual(resets, []string{"ForceOff"}) {
+		t.Errorf("resets are %v, expected [ForceOff]", resets)
+	}
+}
+
+func TestRedfishReset(t *testing.T) {
+	tests := []struct {
+		state  power.State
+		resets []string
+	}{
+		{state: power.StateOn, resets: []string{"ForceRestart"}},
+		{state: power.StateOff, resets: []string{"On"}},
+	}
+	for _, test := range tests {
+		s, p := newRedfish(t, test.state)
+		if err := p.Reset(context.Background()); err != nil {
+			t.Fatalf("Reset of a host that is %s failed [%v]", test.state, err)
+		}
+		if s.PowerState("1") != power.StateOn {
+			t.Errorf("host that was %s is %s after Reset", test.state, s.PowerState("1"))
+		}
+		if resets := s.Resets("1"); !reflect.DeepEqual(resets, test.resets) {
+			t.Errorf("Reset of a host that is %s made resets %v, expected %v", test.state, resets, test.resets)
+		}
+		s.Close()
+	}
+}
+
+func TestRedfishPXEBoot(t *testing.T) {
+	s, p := newRedfish(t, power.StateOff)
+	defer s.Close()
+	if err := p.SetPXEBoot(context.Background()); err != nil {
+		t.Fatalf("SetPXEBoot failed [%v]", err)
+	}
+	if target, once := s.BootOverride("1"); target != "Pxe" || !once {
+		t.Errorf("boot override is %s (once %t), expected Pxe once", target, once)
+	}
+
+	if err := p.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset failed [%v]", err)
+	}
+	if boots := s.PXEBoots("1"); boots != 1 {
+		t.Errorf("host PXE booted %d times, expected 1", boots)
+	}
+
+	// The override is only for the next boot
+	if err := p.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset failed [%v]", err)
+	}
+	if boots := s.PXEBoots("1"); boots != 1 {
+		t.Errorf("host PXE booted %d times after a second reset, expected 1", boots)
+	}
+}
+
+func TestRedfishFirstSystem(t *testing.T) {
+	s := redfishsim.NewServer(testUsername, testPassword)
+	defer s.Close()
+	s.AddSystem("a", power.StateOff)
+	s.AddSystem("b", power.StateOff)
+
+	address := strings.TrimSuffix(s.Address("a"), "/redfish/v1/Systems/a")
+	p, err := power.New(address, power.Credentials{Username: testUsername, Password: testPassword}, true)
+	if err != nil {
+		t.Fatalf("New failed [%v]", err)
+	}
+	if err := p.PowerOn(context.Background()); err != nil {
+		t.Fatalf("PowerOn failed [%v]", err)
+	}
+	if s.PowerState("a") != power.StateOn || s.PowerState("b") != power.StateOff {
+		t.Errorf("systems are a %s and b %s, expected only the first system to be powered on", s.PowerState("a"), s.PowerState("b"))
+	}
+}
+
+func TestRedfishAuthFailure(t *testing.T) {
+	s := redfishsim.NewServer(testUsername, testPassword)
+	defer s.Close()
+	s.AddSystem("1", power.StateOff)
+
+	p, err := power.New(s.Address("1"), power.Credentials{Username: testUsername, Password: "wrong"}, true)
+	if err != nil {
+		t.Fatalf("New failed [%v]", err)
+	}
+	if err := p.PowerOn(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("PowerOn with the wrong password returned [%v], expected a 401 error", err)
+	}
+	if s.PowerState("1") != power.StateOff {
+		t.Errorf("system is %s after a failed PowerOn", s.PowerState("1"))
+	}
+}
+
+func TestRedfishCertificateVerification(t *testing.T) {
+	s := redfishsim.NewServer(testUsername, testPassword)
+	defer s.Close()
+	s.AddSystem("1", power.StateOn)
+
+	p, err := power.New(s.Address("1"), power.Credentials{Username: testUsername, Password: testPassword}, false)
+	if err != nil {
+		t.Fatalf("New failed [%v]", err)
+	}
+	if _, err := p.PowerState(context.Background()); err == nil {
+		t.Errorf("PowerState succeeded against a self signed certificate with verification enabled")
+	}
+}
+
+func TestNewAddress(t *testing.T) {
+	for _, address := range []string{"ftp://bmc.example.com", "redfish://", "bmc.example.com"} {
+		if _, err := power.New(address, power.Credentials{}, false); err == nil {
+			t.Errorf("New accepted the BMC address [%s]", address)
+		}
+	}
+}
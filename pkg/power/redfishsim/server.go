@@ -0,0 +1,282 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redfishsim provides a stand-in for a Redfish BMC that is built on httptest, so that the power management
+// of hosts can be exercised without real hardware. Each system keeps its power state and boot source override and
+// records the resets that have been made.
+package redfishsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/plunder-app/cluster-api-plunder/pkg/power"
+)
+
+// systemsPath is the collection of computer systems
+const systemsPath = "/redfish/v1/Systems"
+
+// system is a simulated computer system
+type system struct {
+	state    power.State
+	target   string
+	enabled  string
+	resets   []string
+	pxeBoots int
+}
+
+// Server is a stand-in for a Redfish BMC
+type Server struct {
+	*httptest.Server
+
+	username string
+	password string
+
+	mu       sync.Mutex
+	systems  map[string]*system
+	order    []string
+	requests []string
+}
+
+// NewServer - starts a new TLS server that accepts the username and password, Close should be called once it is
+// finished with
+func NewServer(username, password string) *Server {
+	s := &Server{
+		username: username,
+		password: password,
+		systems:  map[string]*system{},
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddSystem - adds a computer system that is in a power state
+func (s *Server) AddSystem(id string, state power.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.systems[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.systems[id] = &system{state: state, target: "None", enabled: "Disabled"}
+}
+
+// Address - returns the BMC address of a system for power.New, the certificate of the server is self signed so
+// certificate verification needs to be disabled
+func (s *Server) Address(id string) string {
+	return "redfish://" + strings.TrimPrefix(s.URL, "https://") + systemsPath + "/" + id
+}
+
+// PowerState - returns the power state of a system
+func (s *Server) PowerState(id string) power.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sys, ok := s.systems[id]; ok {
+		return sys.state
+	}
+	return power.StateUnknown
+}
+
+// BootOverride - returns the boot source override of a system and if it is for the next boot only
+func (s *Server) BootOverride(id string) (target string, once bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sys, ok := s.systems[id]; ok {
+		return sys.target, sys.enabled == "Once"
+	}
+	return "", false
+}
+
+// PXEBoots - returns how many times a system has booted from the network
+func (s *Server) PXEBoots(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sys, ok := s.systems[id]; ok {
+		return sys.pxeBoots
+	}
+	return 0
+}
+
+// Resets - returns the ResetType of every reset of a system, in the order they were made
+func (s *Server) Resets(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sys, ok := s.systems[id]; ok {
+		return append([]string(nil), sys.resets...)
+	}
+	return nil
+}
+
+// Requests - returns the method and path of every request that has been made, in the order they were made
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// serve - handles every request to the server
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if username, password, ok := r.BasicAuth(); !ok || username != s.username || password != s.password {
+		writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == systemsPath && r.Method == http.MethodGet {
+		var members []map[string]string
+		for _, id := range s.order {
+			members = append(members, map[string]string{"@odata.id": systemsPath + "/" + id})
+		}
+		writeJSON(w, map[string]interface{}{"Members": members, "Members@odata.count": len(members)})
+		return
+	}
+
+	if !strings.HasPrefix(path, systemsPath+"/") {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown path [%s]", path))
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path, systemsPath+"/"), "/", 2)
+	sys, ok := s.systems[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown system [%s]", parts[0]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, s.resource(parts[0], sys))
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		s.patch(w, r, sys)
+	case len(parts) == 2 && parts[1] == "Actions/ComputerSystem.Reset" && r.Method == http.MethodPost:
+		s.reset(w, r, sys)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Unsupported request [%s %s]", r.Method, path))
+	}
+}
+
+// resource - returns the ComputerSystem resource of a system
+func (s *Server) resource(id string, sys *system) map[string]interface{} {
+	return map[string]interface{}{
+		"@odata.id":  systemsPath + "/" + id,
+		"Id":         id,
+		"PowerState": string(sys.state),
+		"Boot": map[string]string{
+			"BootSourceOverrideTarget":  sys.target,
+			"BootSourceOverrideEnabled": sys.enabled,
+		},
+		"Actions": map[string]interface{}{
+			"#ComputerSystem.Reset": map[string]interface{}{
+				"target":                            systemsPath + "/" + id + "/Actions/ComputerSystem.Reset",
+				"ResetType@Redfish.AllowableValues": []string{"On", "ForceOff", "ForceRestart"},
+			},
+		},
+	}
+}
+
+// patch - updates the boot source override of a system
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, sys *system) {
+	var body struct {
+		Boot struct {
+			BootSourceOverrideTarget  string
+			BootSourceOverrideEnabled string
+		}
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Boot.BootSourceOverrideTarget != "" {
+		sys.target = body.Boot.BootSourceOverrideTarget
+	}
+	if body.Boot.BootSourceOverrideEnabled != "" {
+		sys.enabled = body.Boot.BootSourceOverrideEnabled
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reset - performs a ComputerSystem.Reset, a system that is powered on boots (using up a one time override)
+func (s *Server) reset(w http.ResponseWriter, r *http.Request, sys *system) {
+	var body struct {
+		ResetType string
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch body.ResetType {
+	case "On":
+		if sys.state == power.StateOn {
+			writeError(w, http.StatusConflict, "System is already powered on")
+			return
+		}
+		sys.boot()
+	case "ForceRestart":
+		if sys.state != power.StateOn {
+			writeError(w, http.StatusConflict, "System is not powered on")
+			return
+		}
+		sys.boot()
+	case "ForceOff":
+		sys.state = power.StateOff
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported ResetType [%s]", body.ResetType))
+		return
+	}
+	sys.resets = append(sys.resets, body.ResetType)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// boot - powers on the system, the boot source override is used up if it is only for this boot
+func (sys *system) boot() {
+	sys.state = power.StateOn
+	if sys.enabled != "Disabled" && sys.target == "Pxe" {
+		sys.pxeBoots++
+	}
+	if sys.enabled == "Once" {
+		sys.target, sys.enabled = "None", "Disabled"
+	}
+}
+
+func decode(r *http.Request, v interface{}) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError - writes a Redfish error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": "Base.1.0.GeneralError", "message": message},
+	})
+}